@@ -5,10 +5,12 @@ go 1.13
 require (
 	cloud.google.com/go/bigquery v1.17.0
 	cloud.google.com/go/pubsub v1.15.0
+	cloud.google.com/go/storage v1.15.0
 	github.com/dustin/go-humanize v1.0.0
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/slack-go/slack v0.9.0
 	github.com/stretchr/testify v1.7.0
 	google.golang.org/api v0.54.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,162 @@
+package gcp_cost_notification
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/datetime"
+	"github.com/tatamiya/gcp-cost-notification/src/db"
+	"github.com/tatamiya/gcp-cost-notification/src/notification"
+	"github.com/tatamiya/gcp-cost-notification/src/query"
+	"github.com/tatamiya/gcp-cost-notification/src/trigger"
+)
+
+// The function called by Cloud Functions with an HTTP trigger.
+// Get GCP cost from BigQuery on demand and
+// return the report in the response.
+//
+// The report is selected and narrowed down by the query parameters (see trigger.ParseQuery),
+// and returned as JSON, HTML or plain text (default) depending on the `Accept` header.
+func CostReport(w http.ResponseWriter, r *http.Request) {
+	settings, configError := config.Load()
+	if configError != nil {
+		log.Println("Invalid configuration!: ", configError.Error())
+		http.Error(w, configError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tzConverter := datetime.NewTimeZoneConverterWith(settings.Location())
+	handler := reportHandler{
+		settings: settings,
+		now:      tzConverter.From(time.Now()),
+		newBQClient: func(settings config.BigQuery) bqClientInterface {
+			client := db.NewBQClientWith(settings)
+			return &client
+		},
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// Content types of the report in the response.
+const (
+	contentTypeJSON = "application/json"
+	contentTypeHTML = "text/html"
+	contentTypeText = "text/plain"
+)
+
+type reportHandler struct {
+	settings    *config.Config
+	now         time.Time
+	newBQClient func(settings config.BigQuery) bqClientInterface
+}
+
+func (h *reportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType := negotiateContentType(r.Header.Get("Accept"))
+	if contentType == "" {
+		http.Error(w, "Acceptable types are application/json, text/html and text/plain", http.StatusNotAcceptable)
+		return
+	}
+
+	request, err := trigger.ParseQuery(r.URL.Query())
+	var report config.Report
+	if err == nil {
+		err = request.ValidatePeriod(h.now)
+	}
+	if err == nil {
+		report, err = request.SelectOne(h.settings)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reportingPeriod := request.ReportingPeriod(h.now, report)
+	queryBuilder := query.NewQueryBuilderWith(report.BigQuery, report.Query)
+	invoice, err := buildInvoice(report, reportingPeriod, queryBuilder, h.newBQClient(report.BigQuery))
+	if err != nil {
+		log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, renderError := renderInvoice(invoice, contentType)
+	if renderError != nil {
+		log.Print(renderError)
+		http.Error(w, renderError.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Header().Set("Vary", "Accept")
+	w.Write(body)
+}
+
+func renderInvoice(invoice *billing.Invoice, contentType string) ([]byte, error) {
+	switch contentType {
+	case contentTypeJSON:
+		return notification.MarshalMessage(invoice)
+	case contentTypeHTML:
+		html, err := notification.InvoiceHTML(invoice)
+		return []byte(html), err
+	default:
+		return []byte(invoice.AsMessage()), nil
+	}
+}
+
+// negotiateContentType selects the content type of the response from the `Accept` header
+// in the order of the quality values. Plain text is selected for an empty header or a wildcard.
+// It returns an empty string if none of the content types is acceptable.
+func negotiateContentType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeText
+	}
+
+	type acceptedType struct {
+		mediaType string
+		quality   float64
+	}
+	var acceptedTypes []acceptedType
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			acceptedTypes = append(acceptedTypes, acceptedType{mediaType, quality})
+		}
+	}
+	sort.SliceStable(acceptedTypes, func(i, j int) bool {
+		return acceptedTypes[i].quality > acceptedTypes[j].quality
+	})
+
+	for _, accepted := range acceptedTypes {
+		switch accepted.mediaType {
+		case contentTypeJSON, contentTypeHTML, contentTypeText:
+			return accepted.mediaType
+		case "text/*", "*/*":
+			return contentTypeText
+		case "application/*":
+			return contentTypeJSON
+		}
+	}
+	return ""
+}
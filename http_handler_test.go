@@ -0,0 +1,132 @@
+package gcp_cost_notification
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+)
+
+func newReportHandlerWith(BQClientStub *bqClientStub) *reportHandler {
+	return &reportHandler{
+		settings: &config.Config{Report: config.Report{
+			BigQuery: config.BigQuery{ProjectID: "my-project", DatasetName: "billing", TableName: "export"},
+			Query:    config.Query{Grouping: "service"},
+			Period:   "month_to_date",
+		}},
+		now: InputReportingDateTime,
+		newBQClient: func(settings config.BigQuery) bqClientInterface {
+			return BQClientStub
+		},
+	}
+}
+
+func serveReport(handler *reportHandler, method string, target string, accept string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, nil)
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestReturnReportAsPlainTextByDefault(t *testing.T) {
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	handler := newReportHandlerWith(&BQClientStub)
+
+	response := serveReport(handler, http.MethodGet, "/", "")
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.EqualValues(t, "text/plain; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(response.Body.String(), "＜8/1 ~ 8/6 の GCP 利用料金＞"), response.Body.String())
+}
+
+func TestReturnReportOfExplicitPeriodWithFilters(t *testing.T) {
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	handler := newReportHandlerWith(&BQClientStub)
+
+	response := serveReport(handler, http.MethodGet,
+		"/?from=2021-07-26&to=2021-08-01&grouping=project&project=project-x&label=team:data", "application/json")
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.EqualValues(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.True(t, strings.Contains(response.Body.String(), `"period":{"from":"2021-07-26","to":"2021-08-01"}`), response.Body.String())
+	assert.True(t, strings.Contains(response.Body.String(), `"total":{"name":"Total","monthly":1000.07`), response.Body.String())
+
+	sentQuery := BQClientStub.queries[0]
+	assert.True(t, strings.Contains(sentQuery, "my-project.billing.export"), sentQuery)
+	assert.True(t, strings.Contains(sentQuery, "AND IFNULL(project.id, '(no project)') IN ('project-x')"), sentQuery)
+	assert.True(t, strings.Contains(sentQuery, "l.key = 'team' AND l.value IN ('data')"), sentQuery)
+	assert.True(t, strings.Contains(sentQuery, "    project,\n    ANY_VALUE(project_name)"), sentQuery)
+}
+
+func TestReturnReportAsHTML(t *testing.T) {
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	handler := newReportHandlerWith(&BQClientStub)
+
+	response := serveReport(handler, http.MethodGet, "/?period=previous_month", "text/html,application/xhtml+xml;q=0.9")
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.EqualValues(t, "text/html; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(response.Body.String(), "<html>"), response.Body.String())
+	assert.True(t, strings.Contains(response.Body.String(), "7/1 ~ 7/31"), response.Body.String())
+}
+
+func TestRejectInvalidReportRequests(t *testing.T) {
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	handler := newReportHandlerWith(&BQClientStub)
+
+	response := serveReport(handler, http.MethodPost, "/", "")
+	assert.EqualValues(t, http.StatusMethodNotAllowed, response.Code)
+
+	response = serveReport(handler, http.MethodGet, "/", "image/png")
+	assert.EqualValues(t, http.StatusNotAcceptable, response.Code)
+
+	response = serveReport(handler, http.MethodGet, "/?from=2021-08-01&limit=10&report=unknown", "")
+	assert.EqualValues(t, http.StatusBadRequest, response.Code)
+	assert.EqualValues(t,
+		"Error in Trigger Message. Invalid query parameters!: unknown parameter: 'limit'; from and to must be set together\n",
+		response.Body.String())
+
+	response = serveReport(handler, http.MethodGet, "/?from=2021-08-01&to=2021-08-07", "")
+	assert.EqualValues(t, http.StatusBadRequest, response.Code)
+	assert.EqualValues(t,
+		"Error in Trigger Message. Invalid reporting period!: to must not be later than yesterday (2021-08-06): '2021-08-07'\n",
+		response.Body.String())
+
+	response = serveReport(handler, http.MethodGet, "/?report=unknown", "")
+	assert.EqualValues(t, http.StatusBadRequest, response.Code)
+	assert.True(t, strings.HasPrefix(response.Body.String(), "Error in Trigger Message. Unknown report!"), response.Body.String())
+
+	assert.Empty(t, BQClientStub.queries)
+}
+
+func TestReturnServerErrorWhenQueryFails(t *testing.T) {
+	BQClientStub := newBQClientStub(nil, fmt.Errorf("Something Happened!"))
+	handler := newReportHandlerWith(&BQClientStub)
+
+	response := serveReport(handler, http.MethodGet, "/", "")
+
+	assert.EqualValues(t, http.StatusInternalServerError, response.Code)
+	assert.True(t, strings.HasPrefix(response.Body.String(), "Error in Query Execution."), response.Body.String())
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	for accept, expected := range map[string]string{
+		"":                                   contentTypeText,
+		"*/*":                                contentTypeText,
+		"application/json":                   contentTypeJSON,
+		"text/plain;q=0.5, application/json": contentTypeJSON,
+		"text/html;q=0.8, text/plain;q=0.9":  contentTypeText,
+		"application/*":                      contentTypeJSON,
+		"application/json;q=0, text/*":       contentTypeText,
+		"image/png":                          "",
+	} {
+		assert.EqualValues(t, expected, negotiateContentType(accept), accept)
+	}
+}
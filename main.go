@@ -10,15 +10,20 @@ package gcp_cost_notification
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/tatamiya/gcp-cost-notification/src/analysis"
 	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
 	"github.com/tatamiya/gcp-cost-notification/src/datetime"
 	"github.com/tatamiya/gcp-cost-notification/src/db"
 	"github.com/tatamiya/gcp-cost-notification/src/notification"
 	"github.com/tatamiya/gcp-cost-notification/src/query"
+	"github.com/tatamiya/gcp-cost-notification/src/trigger"
 	"github.com/tatamiya/gcp-cost-notification/src/utils"
 )
 
@@ -31,67 +36,291 @@ import (
 // upto one day before the execution date.
 // If the execution date is the first date of the month,
 // the period is the previous month.
+//
+// The settings are loaded by the config package
+// and the function fails before the process if any of them is invalid.
+// All the reports in the settings are run in one invocation.
+//
+// The data of the Pub/Sub message can control the run (see trigger package).
+// If it is malformed, the error is notified to the default destinations.
+// The message published by SlashCommand runs a report and posts it to the `response_url` of the command.
 func CostNotifier(ctx context.Context, m pubsub.Message) error {
-	tzConverter := datetime.NewTimeZoneConverter()
+	settings, configError := config.Load()
+	if configError != nil {
+		log.Println("Invalid configuration!: ", configError.Error())
+		return configError
+	}
+
+	tzConverter := datetime.NewTimeZoneConverterWith(settings.Location())
 	currentDateTime := tzConverter.From(time.Now())
 
-	BQClient := db.NewBQClient()
+	request, requestError := trigger.Parse(m.Data)
+	if requestError == nil && request.ResponseURL != "" {
+		// Only the slash commands published by SlashCommand are responded to their response URLs.
+		requestError = trigger.VerifySignature(m.Data, m.Attributes[trigger.SignatureAttribute], settings.Slack.SigningSecret)
+		if requestError != nil {
+			request.ResponseURL = ""
+		}
+	}
+	var reports []config.Report
+	if requestError == nil {
+		requestError = request.ValidatePeriod(currentDateTime)
+	}
+	if requestError == nil && request.ResponseURL != "" {
+		var report config.Report
+		report, requestError = request.SelectOne(settings)
+		reports = []config.Report{report}
+	} else if requestError == nil {
+		reports, requestError = request.Select(settings)
+	}
+	if requestError != nil {
+		log.Print(requestError)
+		localizer := billing.NewLocalizerWith(settings.Message)
+		var notifier slackClientInterface
+		if request != nil && request.ResponseURL != "" {
+			notifier = newNotifierOf(request, settings.Report)
+		} else {
+			multiNotifier := notification.NewMultiNotifierFromConfig(settings.Report)
+			notifier = &multiNotifier
+		}
+		_, notificationError := notifier.Send(localizer.ErrorNotice(requestError))
+		if notificationError != nil {
+			log.Println("Error notification also failed!: ", notificationError.Error())
+		}
+		return requestError
+	}
+
+	reportingPeriodOf := func(report config.Report) datetime.ReportingPeriod {
+		return request.ReportingPeriod(currentDateTime, report)
+	}
 
-	slackClient := notification.NewSlackClient()
+	return runReports(reportingPeriodOf, reports, func(report config.Report, reportingPeriod datetime.ReportingPeriod) (string, error) {
+		BQClient := db.NewBQClientWith(report.BigQuery)
+		queryBuilder := query.NewQueryBuilderWith(report.BigQuery, report.Query)
+		return mainProcess(report, reportingPeriod, queryBuilder, &BQClient, newNotifierOf(request, report))
+	})
+}
 
-	message, err := mainProcess(currentDateTime, &BQClient, &slackClient)
-	if err == nil {
-		log.Println("Message was successfully sent to Slack!: ", message)
-	} else {
-		log.Println("Failed in sending message!: ", err.Error())
+// newNotifierOf constructs the client to send the report as the request designates.
+// The slash commands are responded to their response URLs,
+// and only the scheduled reports record the budget alerts.
+func newNotifierOf(request *trigger.Request, report config.Report) slackClientInterface {
+	switch {
+	case request.ResponseURL != "":
+		// The response URL accepts the same messages as an incoming webhook.
+		responder := notification.NewSlackClientWith(config.Slack{
+			WebhookURL:    request.ResponseURL,
+			MessageFormat: report.Slack.MessageFormat,
+		})
+		return &responder
+	case request.DryRun:
+		return &notification.DryRunNotifier{}
+	default:
+		notifier := notification.NewMultiNotifierFromConfig(report)
+		if request.HasExplicitDate() {
+			// The incidents are about the current costs and not triggered or resolved by the backfills.
+			notifier.Skip("pagerduty")
+		}
+		return &budgetRecordingNotifier{notifier: &notifier, settings: report}
 	}
-	return err
+}
+
+func NewReportsError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Reports",
+		Message: message,
+		Err:     err,
+	}
+}
+
+type reportProcess func(report config.Report, reportingPeriod datetime.ReportingPeriod) (string, error)
+
+// runReports runs the process of each report independently,
+// so that a failure of a report does not stop the others.
+//
+// With a single report, its error is returned as it is.
+// Otherwise, the error lists the failed reports.
+func runReports(reportingPeriodOf func(report config.Report) datetime.ReportingPeriod, reports []config.Report, process reportProcess) error {
+	var failures []string
+	var lastError error
+	for _, report := range reports {
+		name := report.Name
+		if name == "" {
+			name = "default"
+		}
+
+		reportingPeriod := reportingPeriodOf(report)
+		message, err := runReport(process, report, reportingPeriod)
+		if err == nil {
+			log.Printf("Report '%s' was successfully sent!: %s", name, message)
+			continue
+		}
+		log.Printf("Failed in sending report '%s'!: %s", name, err.Error())
+		failures = append(failures, fmt.Sprintf("%s: %s", name, err.Error()))
+		lastError = err
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	if len(reports) == 1 {
+		return lastError
+	}
+	return NewReportsError(
+		fmt.Sprintf("Failed in %d of %d reports!", len(failures), len(reports)),
+		fmt.Errorf("%s", strings.Join(failures, "; ")),
+	)
+}
+
+// runReport runs the process of a report and recovers from a panic in it.
+func runReport(process reportProcess, report config.Report, reportingPeriod datetime.ReportingPeriod) (message string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return process(report, reportingPeriod)
 }
 
 type bqClientInterface interface {
 	SendQuery(query string) ([]*db.QueryResult, *utils.CustomError)
+	SendDailyQuery(query string) ([]*db.DailyCost, *utils.CustomError)
 }
 
 type slackClientInterface interface {
 	Send(messenger notification.Messenger) (string, *utils.CustomError)
 }
 
+// budgetRecordingNotifier records the budget thresholds alerted in an Invoice
+// after it is successfully sent, so that they are not alerted again.
+// Only the scheduled reports record them; the on-demand and dry runs do not.
+type budgetRecordingNotifier struct {
+	notifier slackClientInterface
+	settings config.Report
+}
+
+func (n *budgetRecordingNotifier) Send(messenger notification.Messenger) (string, *utils.CustomError) {
+	sentMessage, err := n.notifier.Send(messenger)
+	if err != nil {
+		return sentMessage, err
+	}
+
+	invoice, ok := messenger.(*billing.Invoice)
+	if !ok || !invoice.HasBudgetAlert() {
+		return sentMessage, nil
+	}
+	budgetEvaluator, recordError := billing.NewBudgetEvaluatorWith(n.settings)
+	if recordError == nil {
+		recordError = budgetEvaluator.Record(invoice)
+	}
+	if recordError != nil {
+		log.Println("Failed in recording the budget alert!: ", recordError.Error())
+	}
+	return sentMessage, nil
+}
+
 func mainProcess(
-	reportingDateTime time.Time,
+	settings config.Report,
+	reportingPeriod datetime.ReportingPeriod,
+	queryBuilder query.QueryBuilder,
 	BQClient bqClientInterface,
 	slackClient slackClientInterface,
 ) (string, error) {
 
-	reportingPeriod := datetime.NewReportingPeriod(reportingDateTime)
-
-	queryBuilder := query.NewQueryBuilder()
-	query := queryBuilder.Build(reportingPeriod)
-
-	queryResult, err := BQClient.SendQuery(query)
+	invoice, err := buildInvoice(settings, reportingPeriod, queryBuilder, BQClient)
 	if err != nil {
 		log.Print(err)
-		_, slackError := slackClient.Send(err)
+		localizer := billing.NewLocalizerWith(settings.Message)
+		_, slackError := slackClient.Send(localizer.ErrorNotice(err))
 		if slackError != nil {
 			log.Println("Error notification to Slack also failed!: ", slackError.Error())
 		}
 		return "", err
 	}
 
-	invoice, err := billing.NewInvoice(&reportingPeriod, queryResult)
+	sentMessage, err := slackClient.Send(invoice)
 	if err != nil {
 		log.Print(err)
-		_, slackError := slackClient.Send(err)
-		if slackError != nil {
-			log.Println("Error notification to Slack also failed!: ", slackError.Error())
-		}
 		return "", err
 	}
 
-	sentMessage, err := slackClient.Send(invoice)
+	return sentMessage, nil
+}
+
+// buildInvoice retrieves the costs in the reporting period from BigQuery
+// and creates the Invoice to report with the settings of the report.
+func buildInvoice(
+	settings config.Report,
+	reportingPeriod datetime.ReportingPeriod,
+	queryBuilder query.QueryBuilder,
+	BQClient bqClientInterface,
+) (*billing.Invoice, *utils.CustomError) {
+
+	localizer := billing.NewLocalizerWith(settings.Message)
+
+	query := queryBuilder.Build(reportingPeriod)
+
+	queryResult, err := BQClient.SendQuery(query)
 	if err != nil {
-		log.Print(err)
-		return "", err
+		return nil, err
 	}
 
-	return sentMessage, nil
+	invoice, err := billing.NewInvoice(&reportingPeriod, queryResult)
+	if err != nil {
+		return nil, err
+	}
+
+	// The forecast and the budgets are of the month-end costs,
+	// so they are only for the month-to-date period
+	// and not for the previous month, the last 7 days or other explicit periods.
+	monthToDate := settings.Period == datetime.PeriodMonthToDate && reportingPeriod.IsMonthToDate()
+
+	// The anomaly detection and the forecast are supplementary,
+	// so the report is sent without them if they fail.
+	// They share the daily costs of the days needed by either of them.
+	anomalyDetector := analysis.NewDetectorFromConfig(settings.Anomaly)
+	forecaster := analysis.NewForecasterFromConfig(settings.Forecast)
+	forecastEnabled := forecaster.Enabled() && monthToDate
+	if anomalyDetector.Enabled() || forecastEnabled {
+		windowDays := 0
+		if anomalyDetector.Enabled() {
+			windowDays = anomalyDetector.WindowDays()
+		}
+		if days := analysis.DaysBetween(reportingPeriod.From, reportingPeriod.To); forecastEnabled && days > windowDays {
+			windowDays = days
+		}
+		dailyCosts, err := BQClient.SendDailyQuery(queryBuilder.BuildDaily(reportingPeriod, windowDays))
+		if err != nil {
+			log.Print(err)
+		} else {
+			if anomalyDetector.Enabled() {
+				invoice.Anomalies = anomalyDetector.Detect(dailyCosts, reportingPeriod.To)
+			}
+			if forecastEnabled {
+				invoice.Forecast = forecaster.Forecast(dailyCosts, reportingPeriod.From, reportingPeriod.To)
+			}
+		}
+	}
+
+	currencyConverter := billing.NewCurrencyConverterWith(settings.Message)
+	currencyConverter.Convert(invoice)
+	localizer.Localize(invoice)
+
+	if monthToDate {
+		budgetEvaluator, err := billing.NewBudgetEvaluatorWith(settings)
+		if err != nil {
+			return nil, err
+		}
+		budgetEvaluator.Evaluate(invoice)
+	}
+
+	messageTemplate, err := billing.NewMessageTemplateWith(settings.Message, settings.Query.FileDirectory)
+	if err == nil {
+		err = messageTemplate.Apply(invoice)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return invoice, nil
 }
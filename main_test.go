@@ -1,20 +1,34 @@
 package gcp_cost_notification
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/pubsub"
 	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/datetime"
 	"github.com/tatamiya/gcp-cost-notification/src/db"
 	"github.com/tatamiya/gcp-cost-notification/src/notification"
+	"github.com/tatamiya/gcp-cost-notification/src/query"
 	"github.com/tatamiya/gcp-cost-notification/src/utils"
 )
 
 type bqClientStub struct {
-	records []*db.QueryResult
-	err     *utils.CustomError
+	records    []*db.QueryResult
+	err        *utils.CustomError
+	dailyCosts []*db.DailyCost
+	dailyErr   *utils.CustomError
+	queries    []string
+
+	dailyQueries []string
 }
 
 func newBQClientStub(results []*db.QueryResult, err error) bqClientStub {
@@ -30,9 +44,15 @@ func newBQClientStub(results []*db.QueryResult, err error) bqClientStub {
 	}
 }
 func (c *bqClientStub) SendQuery(query string) ([]*db.QueryResult, *utils.CustomError) {
+	c.queries = append(c.queries, query)
 	return c.records, c.err
 }
 
+func (c *bqClientStub) SendDailyQuery(query string) ([]*db.DailyCost, *utils.CustomError) {
+	c.dailyQueries = append(c.dailyQueries, query)
+	return c.dailyCosts, c.dailyErr
+}
+
 type slackClientStub struct {
 	err *utils.CustomError
 }
@@ -74,7 +94,7 @@ Total: ¥ 1,000.07 (¥ 400)
 Cloud SQL: ¥ 1,000 (¥ 400)
 BigQuery: ¥ 0.07 (¥ 0)`
 
-	actualMessage, err := mainProcess(reportingDateTime, &BQClientStub, &SlackClientStub)
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(reportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
 
 	assert.Nil(t, err)
 	assert.EqualValues(t, expectedMessage, actualMessage)
@@ -87,7 +107,7 @@ func TestDisplayPreviousMonthConstsOnFirstDayOfMonth(t *testing.T) {
 	BQClientStub := newBQClientStub(InputQueryResults, nil)
 	SlackClientStub := newSlackClientStub(nil)
 
-	actualMessage, err := mainProcess(reportingDateTime, &BQClientStub, &SlackClientStub)
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(reportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
 
 	assert.Nil(t, err)
 	assert.True(t, strings.Contains(actualMessage, "＜7/1 ~ 7/31 の GCP 利用料金＞"), actualMessage)
@@ -104,7 +124,7 @@ func TestNotDisplayServiceCostsWhenQueryResultHasNoServiceCosts(t *testing.T) {
 	expectedMessage :=
 		"＜8/1 ~ 8/6 の GCP 利用料金＞ ※ () 内は前日分\n\nTotal: ¥ 1,000.07 (¥ 400)"
 
-	actualMessage, err := mainProcess(InputReportingDateTime, &BQClientStub, &SlackClientStub)
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
 
 	assert.Nil(t, err)
 	assert.EqualValues(t, expectedMessage, actualMessage)
@@ -119,7 +139,7 @@ func TestDisplayZeroTotalCostWhenQueryResultIsEmpty(t *testing.T) {
 	expectedMessage :=
 		"＜8/1 ~ 8/6 の GCP 利用料金＞ ※ () 内は前日分\n\nTotal: ¥ 0 (¥ 0)"
 
-	actualMessage, err := mainProcess(InputReportingDateTime, &BQClientStub, &SlackClientStub)
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
 
 	assert.Nil(t, err)
 	assert.EqualValues(t, expectedMessage, actualMessage)
@@ -135,7 +155,7 @@ func TestReturnErrorWhenQueryResultIsUnexpectedlyOrdered(t *testing.T) {
 	BQClientStub := newBQClientStub(inputQueryResults, nil)
 	SlackClientStub := newSlackClientStub(nil)
 
-	actualMessage, err := mainProcess(InputReportingDateTime, &BQClientStub, &SlackClientStub)
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
 
 	assert.NotNil(t, err)
 	assert.True(t, strings.Contains(err.Error(), "Error in Query Results Validation."), err)
@@ -147,7 +167,7 @@ func TestReturnErrorWhenBQFailed(t *testing.T) {
 	BQClientStub := newBQClientStub([]*db.QueryResult{}, fmt.Errorf("Something Happened!"))
 	SlackClientStub := newSlackClientStub(nil)
 
-	actualMessage, err := mainProcess(InputReportingDateTime, &BQClientStub, &SlackClientStub)
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
 
 	assert.NotNil(t, err)
 	assert.True(t, strings.Contains(err.Error(), "Error in Query Execution."), err)
@@ -159,9 +179,286 @@ func TestReturnErrorWhenSlackNotificationFailed(t *testing.T) {
 	BQClientStub := newBQClientStub(InputQueryResults, nil)
 	SlackClientStub := newSlackClientStub(fmt.Errorf("Something Happened!"))
 
-	actualMessage, err := mainProcess(InputReportingDateTime, &BQClientStub, &SlackClientStub)
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
 
 	assert.NotNil(t, err)
 	assert.True(t, strings.Contains(err.Error(), "Error in Slack Notification."), err)
 	assert.EqualValues(t, "", actualMessage)
 }
+
+func TestRunWholeProcessInEnglish(t *testing.T) {
+	os.Setenv("MESSAGE_LANGUAGE", "en")
+	defer os.Unsetenv("MESSAGE_LANGUAGE")
+
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	SlackClientStub := newSlackClientStub(nil)
+
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(actualMessage, "<GCP costs for Aug 1 - Aug 6>"), actualMessage)
+	assert.True(t, strings.Contains(actualMessage, "----- Breakdown -----"), actualMessage)
+}
+
+func TestReturnErrorWhenMessageTemplateIsInvalid(t *testing.T) {
+	templateFile, _ := ioutil.TempFile("", "message*.tmpl")
+	templateFile.WriteString("{{range .Services}}")
+	templateFile.Close()
+	defer os.Remove(templateFile.Name())
+
+	os.Setenv("MESSAGE_TEMPLATE_FILE", templateFile.Name())
+	defer os.Unsetenv("MESSAGE_TEMPLATE_FILE")
+
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	SlackClientStub := newSlackClientStub(nil)
+
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "Error in Message Template Rendering."), err)
+	assert.EqualValues(t, "", actualMessage)
+}
+
+func newDailyCostsOfCloudSQL() []*db.DailyCost {
+	var dailyCosts []*db.DailyCost
+	for i := 28; i > 0; i-- {
+		date := time.Date(2021, 8, 6, 0, 0, 0, 0, time.Local).AddDate(0, 0, -i)
+		dailyCosts = append(dailyCosts, &db.DailyCost{Service: "Cloud SQL", Date: date.Format("2006-01-02"), Cost: 100.0})
+	}
+	return append(dailyCosts, &db.DailyCost{Service: "Cloud SQL", Date: "2021-08-06", Cost: 400.0})
+}
+
+func TestRunWholeProcessWithAnomalies(t *testing.T) {
+	os.Setenv("ANOMALY_DETECTION", "mad")
+	defer os.Unsetenv("ANOMALY_DETECTION")
+
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	BQClientStub.dailyCosts = newDailyCostsOfCloudSQL()
+	SlackClientStub := newSlackClientStub(nil)
+
+	expectedMessage :=
+		`＜8/1 ~ 8/6 の GCP 利用料金＞ ※ () 内は前日分
+
+Total: ¥ 1,000.07 (¥ 400)
+
+⚠️ ----- 異常値 -----
+Cloud SQL: ¥ 400 ↑ (通常 ¥ 100)
+
+----- 内訳 -----
+Cloud SQL: ¥ 1,000 (¥ 400)
+BigQuery: ¥ 0.07 (¥ 0)`
+
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, expectedMessage, actualMessage)
+}
+
+func TestSendReportWithoutAnomaliesWhenDailyQueryFails(t *testing.T) {
+	os.Setenv("ANOMALY_DETECTION", "mad")
+	defer os.Unsetenv("ANOMALY_DETECTION")
+
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	BQClientStub.dailyErr = db.NewQueryError("Failed", fmt.Errorf("timeout"))
+	SlackClientStub := newSlackClientStub(nil)
+
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(actualMessage, "異常値"), actualMessage)
+}
+
+func TestRunWholeProcessWithForecast(t *testing.T) {
+	os.Setenv("FORECAST_METHOD", "linear")
+	defer os.Unsetenv("FORECAST_METHOD")
+
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	for day := 1; day <= 6; day++ {
+		date := time.Date(2021, 8, day, 0, 0, 0, 0, time.Local).Format("2006-01-02")
+		BQClientStub.dailyCosts = append(BQClientStub.dailyCosts, &db.DailyCost{Service: "Cloud SQL", Date: date, Cost: 100.0})
+	}
+	SlackClientStub := newSlackClientStub(nil)
+
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(actualMessage, "Total: ¥ 1,000.07 (¥ 400) | 月末予測: ¥ 3,100\n"), actualMessage)
+	assert.True(t, strings.Contains(actualMessage, "----- 月末予測 -----\nCloud SQL: ¥ 3,100"), actualMessage)
+}
+
+func TestShareDailyCostsBetweenAnomalyDetectionAndForecast(t *testing.T) {
+	os.Setenv("ANOMALY_DETECTION", "mad")
+	defer os.Unsetenv("ANOMALY_DETECTION")
+	os.Setenv("FORECAST_METHOD", "linear")
+	defer os.Unsetenv("FORECAST_METHOD")
+
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	BQClientStub.dailyCosts = newDailyCostsOfCloudSQL()
+	SlackClientStub := newSlackClientStub(nil)
+
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+
+	assert.Nil(t, err)
+	assert.Len(t, BQClientStub.dailyQueries, 1)
+	assert.True(t, strings.Contains(BQClientStub.dailyQueries[0], "INTERVAL 28 DAY"), BQClientStub.dailyQueries[0])
+	assert.True(t, strings.Contains(actualMessage, "Cloud SQL: ¥ 400 ↑ (通常 ¥ 100)"), actualMessage)
+	assert.True(t, strings.Contains(actualMessage, "月末予測: ¥ 4,650"), actualMessage)
+}
+
+func TestRunWholeProcessWithBudgetAlert(t *testing.T) {
+	budgetFile, _ := ioutil.TempFile("", "budgets*.json")
+	budgetFile.WriteString(`[{"scope": "total", "amount": 1200}]`)
+	budgetFile.Close()
+	defer os.Remove(budgetFile.Name())
+
+	os.Setenv("BUDGET_FILE", budgetFile.Name())
+	defer os.Unsetenv("BUDGET_FILE")
+
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	SlackClientStub := newSlackClientStub(nil)
+
+	expectedMessage :=
+		`🚨 ----- 予算アラート -----
+Total: 予算の 80% を超えました (¥ 1,000.07 / ¥ 1,200, 83.3%)
+
+＜8/1 ~ 8/6 の GCP 利用料金＞ ※ () 内は前日分
+
+Total: ¥ 1,000.07 (¥ 400)
+
+----- 予算 -----
+Total: ¥ 1,000.07 / ¥ 1,200 (83.3%) 🟠
+
+----- 内訳 -----
+Cloud SQL: ¥ 1,000 (¥ 400)
+BigQuery: ¥ 0.07 (¥ 0)`
+
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, expectedMessage, actualMessage)
+}
+
+func TestReturnErrorWhenBudgetFileIsInvalid(t *testing.T) {
+	budgetFile, _ := ioutil.TempFile("", "budgets*.json")
+	budgetFile.WriteString(`[{"scope": "total"}]`)
+	budgetFile.Close()
+	defer os.Remove(budgetFile.Name())
+
+	os.Setenv("BUDGET_FILE", budgetFile.Name())
+	defer os.Unsetenv("BUDGET_FILE")
+
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+	SlackClientStub := newSlackClientStub(nil)
+
+	actualMessage, err := mainProcess(config.FromEnv(), datetime.NewReportingPeriod(InputReportingDateTime), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "Error in Budget Evaluation."), err)
+	assert.EqualValues(t, "", actualMessage)
+}
+
+func TestSkipForecastAndBudgetsExceptForMonthToDate(t *testing.T) {
+	budgetFile, _ := ioutil.TempFile("", "budgets*.json")
+	budgetFile.WriteString(`[{"scope": "total", "amount": 1200}]`)
+	budgetFile.Close()
+	defer os.Remove(budgetFile.Name())
+
+	os.Setenv("BUDGET_FILE", budgetFile.Name())
+	defer os.Unsetenv("BUDGET_FILE")
+	os.Setenv("FORECAST_METHOD", "linear")
+	defer os.Unsetenv("FORECAST_METHOD")
+
+	for _, rule := range []string{datetime.PeriodPreviousMonth, datetime.PeriodLast7Days} {
+		settings := config.FromEnv()
+		settings.Period = rule
+		BQClientStub := newBQClientStub(InputQueryResults, nil)
+		SlackClientStub := newSlackClientStub(nil)
+
+		actualMessage, err := mainProcess(settings, datetime.NewReportingPeriodByRule(InputReportingDateTime, rule), query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+
+		assert.Nil(t, err)
+		assert.Empty(t, BQClientStub.dailyQueries, rule)
+		assert.False(t, strings.Contains(actualMessage, "予算"), actualMessage)
+		assert.False(t, strings.Contains(actualMessage, "月末予測"), actualMessage)
+	}
+}
+
+func periodAsOf(reportingDateTime time.Time) func(report config.Report) datetime.ReportingPeriod {
+	return func(report config.Report) datetime.ReportingPeriod {
+		return datetime.NewReportingPeriodByRule(reportingDateTime, report.Period)
+	}
+}
+
+func TestRunAllReportsEvenIfOneFails(t *testing.T) {
+	reports := []config.Report{
+		{Name: "finance", Period: datetime.PeriodPreviousMonth},
+		{Name: "team-a"},
+		{Name: "team-b"},
+	}
+
+	var periods []datetime.ReportingPeriod
+	err := runReports(periodAsOf(InputReportingDateTime), reports, func(report config.Report, reportingPeriod datetime.ReportingPeriod) (string, error) {
+		periods = append(periods, reportingPeriod)
+		BQClientStub := newBQClientStub(InputQueryResults, nil)
+		if report.Name == "team-a" {
+			BQClientStub = newBQClientStub(nil, fmt.Errorf("Something Happened!"))
+		}
+		SlackClientStub := newSlackClientStub(nil)
+		return mainProcess(config.FromEnv(), reportingPeriod, query.NewQueryBuilder(), &BQClientStub, &SlackClientStub)
+	})
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Reports. Failed in 1 of 3 reports!: team-a: Error in Query Execution."), err)
+	assert.Len(t, periods, 3)
+	assert.EqualValues(t, time.Date(2021, 7, 1, 0, 0, 0, 0, time.Local), periods[0].From)
+	assert.EqualValues(t, time.Date(2021, 8, 1, 0, 0, 0, 0, time.Local), periods[1].From)
+}
+
+func TestRecoverFromPanicInReport(t *testing.T) {
+	reports := []config.Report{{Name: "broken"}, {Name: "working"}}
+
+	var succeeded []string
+	err := runReports(periodAsOf(InputReportingDateTime), reports, func(report config.Report, reportingPeriod datetime.ReportingPeriod) (string, error) {
+		if report.Name == "broken" {
+			panic("no credentials")
+		}
+		succeeded = append(succeeded, report.Name)
+		return "sent", nil
+	})
+
+	assert.EqualValues(t, "Error in Reports. Failed in 1 of 2 reports!: broken: panic: no credentials", err.Error())
+	assert.EqualValues(t, []string{"working"}, succeeded)
+}
+
+func TestReturnErrorOfSingleReportAsItIs(t *testing.T) {
+	reportError := fmt.Errorf("Something Happened!")
+
+	err := runReports(periodAsOf(InputReportingDateTime), []config.Report{{}}, func(report config.Report, reportingPeriod datetime.ReportingPeriod) (string, error) {
+		return "", reportError
+	})
+
+	assert.Equal(t, reportError, err)
+}
+
+func TestNotifyErrorWhenTriggerMessageIsMalformed(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+	}))
+	defer server.Close()
+
+	for name, value := range map[string]string{
+		"GCP_PROJECT": "my-project", "DATASET_NAME": "billing", "TABLE_NAME": "export",
+		"SLACK_WEBHOOK_URL": server.URL, "NOTIFIER": "slack",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	err := CostNotifier(context.Background(), pubsub.Message{Data: []byte(`{"dryrun": true}`)})
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Trigger Message. Malformed message payload!"), err)
+	assert.True(t, strings.Contains(received, "Trigger Message"), received)
+}
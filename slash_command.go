@@ -0,0 +1,135 @@
+package gcp_cost_notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/datetime"
+	"github.com/tatamiya/gcp-cost-notification/src/trigger"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+// The function called by Cloud Functions with an HTTP trigger
+// from a Slack slash command `/gcpcost [project] [period]` (see trigger.ParseCommand).
+//
+// The request is verified with the signing secret of the Slack app.
+// The function publishes the command with its `response_url` to the Pub/Sub topic of CostNotifier
+// and acknowledges it immediately, within 3 seconds required by Slack.
+// CostNotifier posts the report to the `response_url` afterwards.
+//
+// The report is not run in the background of this function,
+// since Cloud Functions throttles the instance after the response.
+func SlashCommand(w http.ResponseWriter, r *http.Request) {
+	settings, configError := config.Load()
+	if configError != nil {
+		log.Println("Invalid configuration!: ", configError.Error())
+		http.Error(w, configError.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tzConverter := datetime.NewTimeZoneConverterWith(settings.Location())
+	publisher := trigger.NewPublisherWith(settings.BigQuery.ProjectID, settings.Slack.CommandTopic, settings.Slack.SigningSecret)
+	handler := slashCommandHandler{
+		settings: settings,
+		now:      tzConverter.From(time.Now()),
+		publish:  publisher.Publish,
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// Slack sends the slash command requests in a form of a few kilobytes.
+const maxSlashCommandBytes = 1 << 20
+
+type slashCommandHandler struct {
+	settings *config.Config
+	now      time.Time
+	publish  func(request *trigger.Request) *utils.CustomError // hands the request over to CostNotifier
+}
+
+func (h *slashCommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.settings.Slack.SigningSecret == "" {
+		log.Println("Slack signing secret is not set!")
+		http.Error(w, "Slack signing secret is not set", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSlashCommandBytes))
+	if err != nil {
+		http.Error(w, "Could not read the request", http.StatusBadRequest)
+		return
+	}
+	verifier, err := slack.NewSecretsVerifier(r.Header, h.settings.Slack.SigningSecret)
+	if err == nil {
+		verifier.Write(body)
+		err = verifier.Ensure()
+	}
+	if err != nil {
+		log.Println("Invalid slash command signature!: ", err.Error())
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	command, err := slack.SlashCommandParse(r)
+	if err != nil || command.ResponseURL == "" {
+		http.Error(w, "Invalid slash command", http.StatusBadRequest)
+		return
+	}
+
+	localizer := billing.NewLocalizerWith(h.settings.Message)
+	catalog := localizer.Catalog()
+	usage := fmt.Sprintf(catalog.CommandUsage, command.Command)
+	if strings.EqualFold(strings.TrimSpace(command.Text), "help") {
+		respondToCommand(w, usage)
+		return
+	}
+
+	request, requestError := trigger.ParseCommand(command.Text)
+	if requestError == nil {
+		requestError = request.ValidatePeriod(h.now)
+	}
+	if requestError == nil {
+		_, requestError = request.SelectOne(h.settings)
+	}
+	if requestError != nil {
+		respondToCommand(w, fmt.Sprintf(catalog.CommandInvalid, requestError.Err)+"\n"+usage)
+		return
+	}
+
+	log.Printf("Slash command '%s %s' from %s", command.Command, command.Text, command.UserID)
+	request.ResponseURL = command.ResponseURL
+	if err := h.publish(request); err != nil {
+		log.Println("Failed in publishing slash command!: ", err.Error())
+		respondToCommand(w, catalog.CommandFailed)
+		return
+	}
+	respondToCommand(w, catalog.CommandAcknowledgement)
+}
+
+// commandResponse is the immediate response to a slash command.
+// slack.Msg is not used because it also marshals unset fields such as `"blocks": null`.
+type commandResponse struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// respondToCommand writes the immediate response visible only to the user of the command.
+func respondToCommand(w http.ResponseWriter, text string) {
+	body, _ := json.Marshal(commandResponse{ResponseType: slack.ResponseTypeEphemeral, Text: text})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,199 @@
+package gcp_cost_notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/query"
+	"github.com/tatamiya/gcp-cost-notification/src/trigger"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+const testResponseURL = "https://hooks.slack.com/commands/T/1/x"
+
+func newSlashCommandSettings() *config.Config {
+	return &config.Config{Report: config.Report{
+		BigQuery: config.BigQuery{ProjectID: "my-project", DatasetName: "billing", TableName: "export"},
+		Query:    config.Query{Grouping: "service"},
+		Period:   "month_to_date",
+		Slack:    config.Slack{SigningSecret: testSigningSecret},
+	}}
+}
+
+// newSlashCommandHandlerWith records the published requests instead of publishing them.
+func newSlashCommandHandlerWith(published *[]*trigger.Request, publishError *utils.CustomError) *slashCommandHandler {
+	return &slashCommandHandler{
+		settings: newSlashCommandSettings(),
+		now:      InputReportingDateTime,
+		publish: func(request *trigger.Request) *utils.CustomError {
+			if publishError != nil {
+				return publishError
+			}
+			*published = append(*published, request)
+			return nil
+		},
+	}
+}
+
+// newResponseURLServer records the messages posted to the response URL.
+func newResponseURLServer(posted *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		*posted = append(*posted, string(body))
+	}))
+}
+
+func postSlashCommand(handler *slashCommandHandler, text string, responseURL string, secret string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	form.Set("command", "/gcpcost")
+	form.Set("text", text)
+	form.Set("user_id", "U2147483697")
+	form.Set("response_url", responseURL)
+	body := form.Encode()
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	request.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAcknowledgeSlashCommandAndPublishRequest(t *testing.T) {
+	var published []*trigger.Request
+	handler := newSlashCommandHandlerWith(&published, nil)
+
+	response := postSlashCommand(handler, "project-x last_7_days", testResponseURL, testSigningSecret)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.EqualValues(t, "application/json", response.Header().Get("Content-Type"))
+	assert.EqualValues(t, `{"response_type":"ephemeral","text":"⏳ GCP 利用料金を集計しています…"}`, response.Body.String())
+	assert.EqualValues(t, []*trigger.Request{{
+		Period:      "last_7_days",
+		Filters:     &config.Filters{Projects: []string{"project-x"}},
+		ResponseURL: testResponseURL,
+	}}, published)
+}
+
+func TestRespondFailureWhenSlashCommandCannotBePublished(t *testing.T) {
+	var published []*trigger.Request
+	handler := newSlashCommandHandlerWith(&published, trigger.NewPublishError("Failed in publishing the request", fmt.Errorf("Something Happened!")))
+
+	response := postSlashCommand(handler, "", testResponseURL, testSigningSecret)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.True(t, strings.Contains(response.Body.String(), "⚠️ 集計を開始できませんでした"), response.Body.String())
+	assert.Empty(t, published)
+}
+
+func TestPostReportOfPublishedCommandToResponseURL(t *testing.T) {
+	var posted []string
+	server := newResponseURLServer(&posted)
+	defer server.Close()
+	BQClientStub := newBQClientStub(InputQueryResults, nil)
+
+	request := &trigger.Request{Period: "last_7_days", Filters: &config.Filters{Projects: []string{"project-x"}}, ResponseURL: server.URL}
+	report, _ := request.SelectOne(newSlashCommandSettings())
+	queryBuilder := query.NewQueryBuilderWith(report.BigQuery, report.Query)
+	_, err := mainProcess(report, request.ReportingPeriod(InputReportingDateTime, report), queryBuilder, &BQClientStub, newNotifierOf(request, report))
+
+	assert.Nil(t, err)
+	sentQuery := BQClientStub.queries[0]
+	assert.True(t, strings.Contains(sentQuery, "SET date_from = DATE(TIMESTAMP('2021-07-31T00:00:00Z'), timezone);"), sentQuery)
+	assert.True(t, strings.Contains(sentQuery, "AND IFNULL(project.id, '(no project)') IN ('project-x')"), sentQuery)
+
+	assert.Len(t, posted, 1)
+	assert.True(t, strings.Contains(posted[0], "＜7/31 ~ 8/6 の GCP 利用料金＞"), posted[0])
+}
+
+func TestPostErrorNoticeToResponseURLWhenQueryFails(t *testing.T) {
+	var posted []string
+	server := newResponseURLServer(&posted)
+	defer server.Close()
+	BQClientStub := newBQClientStub(nil, fmt.Errorf("Something Happened!"))
+
+	request := &trigger.Request{ResponseURL: server.URL}
+	report, _ := request.SelectOne(newSlashCommandSettings())
+	queryBuilder := query.NewQueryBuilderWith(report.BigQuery, report.Query)
+	_, err := mainProcess(report, request.ReportingPeriod(InputReportingDateTime, report), queryBuilder, &BQClientStub, newNotifierOf(request, report))
+
+	assert.NotNil(t, err)
+	assert.Len(t, posted, 1)
+	assert.True(t, strings.Contains(posted[0], "Query Execution"), posted[0])
+}
+
+func TestRespondUsageToSlashCommandWithInvalidArguments(t *testing.T) {
+	var published []*trigger.Request
+	handler := newSlashCommandHandlerWith(&published, nil)
+
+	response := postSlashCommand(handler, "project-x yesterday", testResponseURL, testSigningSecret)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.True(t, strings.Contains(response.Body.String(), `"response_type":"ephemeral"`), response.Body.String())
+	assert.True(t, strings.Contains(response.Body.String(), "⚠️ 引数が正しくありません"), response.Body.String())
+	assert.True(t, strings.Contains(response.Body.String(), "使い方: /gcpcost"), response.Body.String())
+	assert.Empty(t, published)
+}
+
+func TestRespondUsageToSlashCommandWithPeriodEndingToday(t *testing.T) {
+	var published []*trigger.Request
+	handler := newSlashCommandHandlerWith(&published, nil)
+
+	response := postSlashCommand(handler, "2021-08-01..2021-08-07", testResponseURL, testSigningSecret)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.True(t, strings.Contains(response.Body.String(), "to must not be later than yesterday (2021-08-06)"), response.Body.String())
+	assert.Empty(t, published)
+}
+
+func TestRespondUsageToSlashCommandHelp(t *testing.T) {
+	var published []*trigger.Request
+	handler := newSlashCommandHandlerWith(&published, nil)
+
+	response := postSlashCommand(handler, "help", testResponseURL, testSigningSecret)
+
+	assert.EqualValues(t, http.StatusOK, response.Code)
+	assert.True(t, strings.Contains(response.Body.String(), "使い方: /gcpcost [プロジェクトID] [期間]"), response.Body.String())
+	assert.Empty(t, published)
+}
+
+func TestRejectSlashCommandWithInvalidSignature(t *testing.T) {
+	var published []*trigger.Request
+	handler := newSlashCommandHandlerWith(&published, nil)
+
+	response := postSlashCommand(handler, "", testResponseURL, "wrong-secret")
+
+	assert.EqualValues(t, http.StatusUnauthorized, response.Code)
+	assert.Empty(t, published)
+}
+
+func TestRejectSlashCommandWithoutPost(t *testing.T) {
+	var published []*trigger.Request
+	handler := newSlashCommandHandlerWith(&published, nil)
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+
+	assert.EqualValues(t, http.StatusMethodNotAllowed, response.Code)
+	assert.EqualValues(t, "POST", response.Header().Get("Allow"))
+}
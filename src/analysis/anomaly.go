@@ -0,0 +1,244 @@
+// analysis package implements the detection of anomalous daily costs.
+package analysis
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/db"
+)
+
+// Methods to measure how far the cost is from the recent history.
+const (
+	MethodMAD    = "mad"    // modified z-score with the median absolute deviation
+	MethodZScore = "zscore" // z-score with the mean and standard deviation
+)
+
+// Default settings of the detection.
+const (
+	DefaultWindowDays = 28
+	minHistoryDays    = 7 // minimum number of days with costs in the history to judge
+
+	minRelativeDeviation = 0.01 // minimum deviation relative to the baseline
+)
+
+var defaultThresholds = map[string]float64{
+	MethodMAD:    3.5,
+	MethodZScore: 3.0,
+}
+
+// Anomaly is a service whose cost on the most recent date is unusual.
+//
+// Baseline is the usual daily cost: the median (MAD) or the mean (z-score)
+// of the history, and Score is how far the cost is from it.
+type Anomaly struct {
+	Service   string
+	Cost      float32
+	Baseline  float32
+	Score     float64
+	Direction int // 1 if the cost is higher than usual, -1 if lower
+}
+
+// Detector is an object to find anomalous daily costs of services.
+type Detector struct {
+	method     string  // detection method (empty: disabled)
+	windowDays int     // number of days of the history
+	threshold  float64 // minimum score regarded as anomalous
+	minCost    float32 // minimum difference from the baseline regarded as anomalous
+}
+
+// NewDetector constructs a Detector from the environment variables.
+//
+// `ANOMALY_DETECTION` ... the method, `mad` or `zscore`. If it is empty, the detection is disabled.
+//
+// `ANOMALY_WINDOW_DAYS` ... the number of days of the history (default: 28).
+//
+// `ANOMALY_THRESHOLD` ... the minimum score regarded as anomalous (default: 3.5 for mad, 3.0 for zscore).
+//
+// `ANOMALY_MIN_COST` ... the minimum difference from the usual cost regarded as anomalous (default: 0),
+// to ignore small fluctuations of inexpensive services.
+func NewDetector() Detector {
+	return NewDetectorFromConfig(config.FromEnv().Anomaly)
+}
+
+// NewDetectorFromConfig constructs a Detector with the settings of a report.
+// The unset settings are the defaults, and the invalid ones are logged and replaced with the defaults.
+func NewDetectorFromConfig(settings config.Anomaly) Detector {
+	method := strings.ToLower(settings.Method)
+	switch method {
+	case "", MethodMAD, MethodZScore:
+	default:
+		log.Printf("Unknown anomaly detection method '%s'. '%s' is used instead.", method, MethodMAD)
+		method = MethodMAD
+	}
+
+	windowDays := DefaultWindowDays
+	if settings.WindowDays != 0 {
+		if settings.WindowDays < minHistoryDays {
+			log.Printf("Invalid anomaly window days '%d'. %d is set instead.", settings.WindowDays, DefaultWindowDays)
+		} else {
+			windowDays = settings.WindowDays
+		}
+	}
+
+	threshold := defaultThresholds[method]
+	if settings.Threshold != 0 {
+		if settings.Threshold < 0 {
+			log.Printf("Invalid anomaly threshold '%g'. %.1f is set instead.", settings.Threshold, threshold)
+		} else {
+			threshold = settings.Threshold
+		}
+	}
+
+	var minCost float32
+	if settings.MinCost < 0 {
+		log.Printf("Invalid minimum anomaly cost '%g'. 0 is set instead.", settings.MinCost)
+	} else {
+		minCost = float32(settings.MinCost)
+	}
+
+	return NewDetectorWith(method, windowDays, threshold, minCost)
+}
+
+// NewDetectorWith constructs a Detector with the settings.
+func NewDetectorWith(method string, windowDays int, threshold float64, minCost float32) Detector {
+	return Detector{method: method, windowDays: windowDays, threshold: threshold, minCost: minCost}
+}
+
+// Enabled reports whether the detection is enabled.
+func (d *Detector) Enabled() bool {
+	return d.method != ""
+}
+
+// WindowDays returns the number of days of the history to retrieve.
+func (d *Detector) WindowDays() int {
+	return d.windowDays
+}
+
+// Detect method finds the services whose cost on the date is anomalous
+// compared with the costs in the window days before the date.
+//
+// The days without a cost of a service are regarded as 0.
+// Services with costs on fewer than 7 days of the history are skipped.
+// The anomalies are sorted by the difference from the usual cost in descending order.
+func (d *Detector) Detect(dailyCosts []*db.DailyCost, date time.Time) []*Anomaly {
+	target := date.Format("2006-01-02")
+	historyIndex := map[string]int{}
+	for i := 0; i < d.windowDays; i++ {
+		historyIndex[date.AddDate(0, 0, -d.windowDays+i).Format("2006-01-02")] = i
+	}
+
+	var services []string
+	histories := map[string][]float64{}
+	costs := map[string]float64{}
+	for _, dailyCost := range dailyCosts {
+		if _, ok := histories[dailyCost.Service]; !ok {
+			services = append(services, dailyCost.Service)
+			histories[dailyCost.Service] = make([]float64, d.windowDays)
+		}
+		if dailyCost.Date == target {
+			costs[dailyCost.Service] += float64(dailyCost.Cost)
+		} else if i, ok := historyIndex[dailyCost.Date]; ok {
+			histories[dailyCost.Service][i] += float64(dailyCost.Cost)
+		}
+	}
+
+	var anomalies []*Anomaly
+	for _, service := range services {
+		history := histories[service]
+		if countNonZero(history) < minHistoryDays {
+			continue
+		}
+		cost := costs[service]
+		baseline, score := d.score(history, cost)
+		if math.Abs(score) < d.threshold || math.Abs(cost-baseline) < float64(d.minCost) {
+			continue
+		}
+		direction := 1
+		if cost < baseline {
+			direction = -1
+		}
+		anomalies = append(anomalies, &Anomaly{
+			Service:   service,
+			Cost:      float32(cost),
+			Baseline:  float32(baseline),
+			Score:     score,
+			Direction: direction,
+		})
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return math.Abs(float64(anomalies[i].Cost-anomalies[i].Baseline)) > math.Abs(float64(anomalies[j].Cost-anomalies[j].Baseline))
+	})
+	return anomalies
+}
+
+// score returns the baseline of the history and the score of the cost.
+// The score is 0 if the history does not vary at all.
+//
+// The deviation is at least 1% of the baseline,
+// so that a tiny change of a constant cost is not regarded as anomalous.
+func (d *Detector) score(history []float64, cost float64) (float64, float64) {
+	var baseline, deviation float64
+	switch d.method {
+	case MethodZScore:
+		baseline = mean(history)
+		deviation = standardDeviation(history, baseline)
+	default:
+		baseline = median(history)
+		absoluteDeviations := make([]float64, len(history))
+		for i, value := range history {
+			absoluteDeviations[i] = math.Abs(value - baseline)
+		}
+		// 0.6745 is the 0.75 quantile of the standard normal distribution,
+		// which makes the score comparable to the z-score.
+		deviation = median(absoluteDeviations) / 0.6745
+	}
+
+	deviation = math.Max(deviation, math.Abs(baseline)*minRelativeDeviation)
+	if deviation == 0 {
+		// The history is too sparse to judge.
+		return baseline, 0
+	}
+	return baseline, (cost - baseline) / deviation
+}
+
+func countNonZero(values []float64) int {
+	count := 0
+	for _, value := range values {
+		if value != 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+func standardDeviation(values []float64, mean float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += (value - mean) * (value - mean)
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
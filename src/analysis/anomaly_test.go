@@ -0,0 +1,133 @@
+package analysis
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/db"
+)
+
+var InputDate = time.Date(2021, 5, 29, 0, 0, 0, 0, time.UTC)
+
+// newDailyCosts creates the daily costs of a service
+// from 28 days before InputDate to InputDate.
+func newDailyCosts(service string, history []float32, cost float32) []*db.DailyCost {
+	var dailyCosts []*db.DailyCost
+	for i, value := range history {
+		date := InputDate.AddDate(0, 0, -len(history)+i)
+		dailyCosts = append(dailyCosts, &db.DailyCost{Service: service, Date: date.Format("2006-01-02"), Cost: value})
+	}
+	return append(dailyCosts, &db.DailyCost{Service: service, Date: InputDate.Format("2006-01-02"), Cost: cost})
+}
+
+func repeat(values []float32, n int) []float32 {
+	var repeated []float32
+	for len(repeated) < n {
+		repeated = append(repeated, values...)
+	}
+	return repeated[:n]
+}
+
+func TestDetectSpikeWithMAD(t *testing.T) {
+	detector := NewDetectorWith(MethodMAD, 28, 3.5, 0)
+	history := repeat([]float32{90, 100, 110, 100}, 28)
+	dailyCosts := append(newDailyCosts("Cloud SQL", history, 300), newDailyCosts("BigQuery", history, 105)...)
+
+	anomalies := detector.Detect(dailyCosts, InputDate)
+
+	assert.Len(t, anomalies, 1)
+	assert.EqualValues(t, "Cloud SQL", anomalies[0].Service)
+	assert.EqualValues(t, 300, anomalies[0].Cost)
+	assert.EqualValues(t, 100, anomalies[0].Baseline)
+	assert.EqualValues(t, 1, anomalies[0].Direction)
+	assert.InDelta(t, 26.98, anomalies[0].Score, 0.01)
+}
+
+func TestDetectDropWithZScore(t *testing.T) {
+	detector := NewDetectorWith(MethodZScore, 28, 3.0, 0)
+	history := repeat([]float32{90, 100, 110, 100}, 28)
+
+	anomalies := detector.Detect(newDailyCosts("Cloud SQL", history, 0), InputDate)
+
+	assert.Len(t, anomalies, 1)
+	assert.EqualValues(t, -1, anomalies[0].Direction)
+	assert.EqualValues(t, 100, anomalies[0].Baseline)
+}
+
+func TestRegardMissingDaysAsZero(t *testing.T) {
+	detector := NewDetectorWith(MethodMAD, 28, 3.5, 0)
+	dailyCosts := newDailyCosts("Cloud Run", repeat([]float32{100}, 28), 100)
+	// The service has no cost on the date.
+	dailyCosts = dailyCosts[:len(dailyCosts)-1]
+
+	anomalies := detector.Detect(dailyCosts, InputDate)
+
+	assert.Len(t, anomalies, 1)
+	assert.EqualValues(t, 0, anomalies[0].Cost)
+}
+
+func TestIgnoreTinyChangeOfConstantCost(t *testing.T) {
+	detector := NewDetectorWith(MethodMAD, 28, 3.5, 0)
+
+	anomalies := detector.Detect(newDailyCosts("Cloud SQL", repeat([]float32{100}, 28), 102), InputDate)
+
+	assert.Empty(t, anomalies)
+}
+
+func TestSkipServicesWithShortHistory(t *testing.T) {
+	detector := NewDetectorWith(MethodMAD, 28, 3.5, 0)
+	history := append(repeat([]float32{0}, 22), repeat([]float32{100}, 6)...)
+
+	anomalies := detector.Detect(newDailyCosts("Vertex AI", history, 1000), InputDate)
+
+	assert.Empty(t, anomalies)
+}
+
+func TestIgnoreAnomaliesSmallerThanMinCost(t *testing.T) {
+	detector := NewDetectorWith(MethodMAD, 28, 3.5, 500)
+	history := repeat([]float32{90, 100, 110, 100}, 28)
+
+	anomalies := detector.Detect(newDailyCosts("Cloud SQL", history, 300), InputDate)
+
+	assert.Empty(t, anomalies)
+}
+
+func TestSortAnomaliesByDifferenceFromBaseline(t *testing.T) {
+	detector := NewDetectorWith(MethodMAD, 28, 3.5, 0)
+	history := repeat([]float32{90, 100, 110, 100}, 28)
+	var dailyCosts []*db.DailyCost
+	for i, cost := range []float32{300, 1000, 500} {
+		dailyCosts = append(dailyCosts, newDailyCosts(fmt.Sprintf("Service %d", i), history, cost)...)
+	}
+
+	anomalies := detector.Detect(dailyCosts, InputDate)
+
+	assert.Len(t, anomalies, 3)
+	assert.EqualValues(t, "Service 1", anomalies[0].Service)
+	assert.EqualValues(t, "Service 2", anomalies[1].Service)
+	assert.EqualValues(t, "Service 0", anomalies[2].Service)
+}
+
+func TestConstructDetectorFromEnvironmentVariables(t *testing.T) {
+	os.Setenv("ANOMALY_DETECTION", "ZScore")
+	os.Setenv("ANOMALY_WINDOW_DAYS", "14")
+	os.Setenv("ANOMALY_THRESHOLD", "invalid")
+	defer os.Unsetenv("ANOMALY_DETECTION")
+	defer os.Unsetenv("ANOMALY_WINDOW_DAYS")
+	defer os.Unsetenv("ANOMALY_THRESHOLD")
+
+	detector := NewDetector()
+
+	assert.True(t, detector.Enabled())
+	assert.EqualValues(t, NewDetectorWith(MethodZScore, 14, 3.0, 0), detector)
+}
+
+func TestDisableDetectorByDefault(t *testing.T) {
+	detector := NewDetector()
+
+	assert.False(t, detector.Enabled())
+	assert.EqualValues(t, DefaultWindowDays, detector.WindowDays())
+}
@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/db"
+)
+
+// Methods to forecast the month-end cost.
+const (
+	ForecastLinear  = "linear"  // run-rate: the daily average so far continues
+	ForecastWeekday = "weekday" // the average of each weekday so far continues
+)
+
+// Forecast contains the projected month-end costs.
+type Forecast struct {
+	Total    float32
+	Services []*ServiceForecast
+}
+
+// ServiceForecast contains the projected month-end cost of a service.
+type ServiceForecast struct {
+	Service string
+	Amount  float32
+}
+
+// Forecaster is an object to project the month-end costs
+// from the daily costs of the month to date.
+type Forecaster struct {
+	method string // forecasting method (empty: disabled)
+}
+
+// NewForecaster constructs a Forecaster with the method designated in
+// the environment variable `FORECAST_METHOD` (`linear` or `weekday`).
+// If it is empty, the forecast is disabled.
+func NewForecaster() Forecaster {
+	return NewForecasterFromConfig(config.FromEnv().Forecast)
+}
+
+// NewForecasterFromConfig constructs a Forecaster with the settings of a report.
+// An unknown method is logged and replaced with the linear forecast.
+func NewForecasterFromConfig(settings config.Forecast) Forecaster {
+	method := strings.ToLower(settings.Method)
+	switch method {
+	case "", ForecastLinear, ForecastWeekday:
+	default:
+		log.Printf("Unknown forecast method '%s'. '%s' is used instead.", method, ForecastLinear)
+		method = ForecastLinear
+	}
+	return NewForecasterWith(method)
+}
+
+// NewForecasterWith constructs a Forecaster with the method.
+func NewForecasterWith(method string) Forecaster {
+	return Forecaster{method: method}
+}
+
+// Enabled reports whether the forecast is enabled.
+func (f *Forecaster) Enabled() bool {
+	return f.method != ""
+}
+
+// Forecast method projects the month-end costs from the daily costs
+// from the first day of the month (from) to the most recent date (to).
+//
+// It returns nil if the month is already over.
+// The services are sorted by the projected cost in descending order.
+func (f *Forecaster) Forecast(dailyCosts []*db.DailyCost, from time.Time, to time.Time) *Forecast {
+	monthEnd := time.Date(from.Year(), from.Month()+1, 0, 0, 0, 0, 0, from.Location())
+	elapsedDays := DaysBetween(from, to) + 1
+	if !to.Before(monthEnd) || elapsedDays < 1 {
+		return nil
+	}
+
+	dayIndex := map[string]int{}
+	for i := 0; i < elapsedDays; i++ {
+		dayIndex[from.AddDate(0, 0, i).Format("2006-01-02")] = i
+	}
+
+	var services []string
+	series := map[string][]float64{}
+	for _, dailyCost := range dailyCosts {
+		i, ok := dayIndex[dailyCost.Date]
+		if !ok {
+			continue
+		}
+		if _, ok := series[dailyCost.Service]; !ok {
+			services = append(services, dailyCost.Service)
+			series[dailyCost.Service] = make([]float64, elapsedDays)
+		}
+		series[dailyCost.Service][i] += float64(dailyCost.Cost)
+	}
+
+	var remainingDays []time.Time
+	for date := to.AddDate(0, 0, 1); !date.After(monthEnd); date = date.AddDate(0, 0, 1) {
+		remainingDays = append(remainingDays, date)
+	}
+
+	forecast := &Forecast{}
+	for _, service := range services {
+		amount := float32(f.project(series[service], from, remainingDays))
+		forecast.Total += amount
+		forecast.Services = append(forecast.Services, &ServiceForecast{Service: service, Amount: amount})
+	}
+	sort.SliceStable(forecast.Services, func(i, j int) bool {
+		return forecast.Services[i].Amount > forecast.Services[j].Amount
+	})
+	return forecast
+}
+
+// project returns the sum of the daily costs so far
+// and the projected daily costs on the remaining days.
+func (f *Forecaster) project(series []float64, from time.Time, remainingDays []time.Time) float64 {
+	actual := 0.0
+	for _, cost := range series {
+		actual += cost
+	}
+	average := actual / float64(len(series))
+
+	if f.method != ForecastWeekday {
+		return actual + average*float64(len(remainingDays))
+	}
+
+	var weekdaySums, weekdayCounts [7]float64
+	for i, cost := range series {
+		weekday := from.AddDate(0, 0, i).Weekday()
+		weekdaySums[weekday] += cost
+		weekdayCounts[weekday]++
+	}
+	projected := actual
+	for _, date := range remainingDays {
+		weekday := date.Weekday()
+		if weekdayCounts[weekday] == 0 {
+			// The weekday has not come yet in the month.
+			projected += average
+			continue
+		}
+		projected += weekdaySums[weekday] / weekdayCounts[weekday]
+	}
+	return projected
+}
+
+// DaysBetween returns the number of days from a date to another date.
+func DaysBetween(from time.Time, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
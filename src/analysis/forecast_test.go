@@ -0,0 +1,79 @@
+package analysis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/db"
+)
+
+// newMonthToDateCosts creates the daily costs of a service from 2021/5/1.
+// 2021/5/1 is Saturday.
+func newMonthToDateCosts(service string, costs []float32) []*db.DailyCost {
+	var dailyCosts []*db.DailyCost
+	for i, cost := range costs {
+		date := time.Date(2021, 5, 1+i, 0, 0, 0, 0, time.UTC)
+		dailyCosts = append(dailyCosts, &db.DailyCost{Service: service, Date: date.Format("2006-01-02"), Cost: cost})
+	}
+	return dailyCosts
+}
+
+var MonthStart = time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func TestForecastMonthEndCostWithLinearRunRate(t *testing.T) {
+	forecaster := NewForecasterWith(ForecastLinear)
+	dailyCosts := append(
+		newMonthToDateCosts("Cloud SQL", repeat([]float32{100}, 10)),
+		newMonthToDateCosts("BigQuery", repeat([]float32{10, 30}, 10))...,
+	)
+
+	forecast := forecaster.Forecast(dailyCosts, MonthStart, time.Date(2021, 5, 10, 0, 0, 0, 0, time.UTC))
+
+	assert.EqualValues(t, 3720, forecast.Total)
+	assert.EqualValues(t, []*ServiceForecast{
+		{Service: "Cloud SQL", Amount: 3100},
+		{Service: "BigQuery", Amount: 620},
+	}, forecast.Services)
+}
+
+func TestForecastMonthEndCostWithWeekdayAverage(t *testing.T) {
+	forecaster := NewForecasterWith(ForecastWeekday)
+	// 100 on weekdays and 10 on weekends from Saturday 5/1 to Sunday 5/9.
+	costs := []float32{10, 10, 100, 100, 100, 100, 100, 10, 10}
+
+	forecast := forecaster.Forecast(newMonthToDateCosts("Compute Engine", costs), MonthStart, time.Date(2021, 5, 9, 0, 0, 0, 0, time.UTC))
+
+	// The remaining 22 days from 5/10 to 5/31 have 16 weekdays and 6 weekend days.
+	assert.EqualValues(t, 540+16*100+6*10, forecast.Total)
+}
+
+func TestUseAverageForWeekdaysNotComeYet(t *testing.T) {
+	forecaster := NewForecasterWith(ForecastWeekday)
+
+	forecast := forecaster.Forecast(newMonthToDateCosts("Compute Engine", []float32{10, 30}), MonthStart, time.Date(2021, 5, 2, 0, 0, 0, 0, time.UTC))
+
+	// 4 Saturdays and 4 Sundays out of 29 remaining days, and 21 other days with the average 20.
+	assert.EqualValues(t, 40+4*10+4*30+21*20, forecast.Total)
+}
+
+func TestNotForecastWhenMonthIsOver(t *testing.T) {
+	forecaster := NewForecasterWith(ForecastLinear)
+
+	forecast := forecaster.Forecast(newMonthToDateCosts("Cloud SQL", repeat([]float32{100}, 31)), MonthStart, time.Date(2021, 5, 31, 0, 0, 0, 0, time.UTC))
+
+	assert.Nil(t, forecast)
+}
+
+func TestConstructForecasterFromEnvironmentVariable(t *testing.T) {
+	forecaster := NewForecaster()
+	assert.False(t, forecaster.Enabled())
+
+	os.Setenv("FORECAST_METHOD", "Weekday")
+	defer os.Unsetenv("FORECAST_METHOD")
+
+	forecaster = NewForecaster()
+	assert.True(t, forecaster.Enabled())
+	assert.EqualValues(t, NewForecasterWith(ForecastWeekday), forecaster)
+}
@@ -0,0 +1,344 @@
+package billing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/db"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func newBudgetError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Budget Evaluation",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// Scopes of a budget.
+const (
+	BudgetScopeTotal   = "total"   // the total cost
+	BudgetScopeProject = "project" // the cost of a project
+	BudgetScopeService = "service" // the cost of a service (summed over the projects)
+)
+
+// BudgetThresholds are the percentages of a budget to flag when crossed.
+var BudgetThresholds = []float32{50, 80, 100}
+
+// Budget is the monthly budget amount for a scope
+// in the currency the costs are reported in.
+type Budget struct {
+	Scope  string  `json:"scope"`
+	Name   string  `json:"name"` // Project ID or service name (empty for the total)
+	Amount float32 `json:"amount"`
+}
+
+func (b *Budget) label(catalog *Catalog) string {
+	if b.Scope == BudgetScopeTotal {
+		return catalog.Total
+	}
+	return b.Name
+}
+
+// BudgetStatus contains how much of a budget is consumed.
+//
+// Reached is the highest threshold the cost has reached (0 if none),
+// and Crossed is the threshold first crossed on this run (0 if none).
+type BudgetStatus struct {
+	Budget  Budget
+	Spent   float32
+	Percent float32
+	Reached float32
+	Crossed float32
+}
+
+// BudgetStateStore keeps the budget alert state between the runs.
+// Read returns nil if nothing is stored yet.
+type BudgetStateStore interface {
+	Read() ([]byte, *utils.CustomError)
+	Write(content []byte) *utils.CustomError
+}
+
+// BudgetEvaluator is an object to evaluate the costs in an Invoice against the budgets.
+type BudgetEvaluator struct {
+	budgets []Budget
+	state   BudgetStateStore
+	report  string // name of the report in the keys of the alert state
+}
+
+// NewBudgetEvaluator constructs a BudgetEvaluator from the JSON file
+// designated in the environment variable `BUDGET_FILE`.
+// A relative path is resolved under `FILE_DIRECTORY` in the same way as the query template.
+//
+// The file contains a list of budgets, e.g.
+// `[{"scope": "total", "amount": 100000}, {"scope": "project", "name": "my-project", "amount": 50000}]`.
+//
+// If the variable is empty, the BudgetEvaluator does nothing.
+//
+// The thresholds already alerted are kept in the Cloud Storage object
+// designated in `BUDGET_STATE_OBJECT` (e.g. `gs://my-bucket/budget-state.json`) if it is set.
+func NewBudgetEvaluator() (BudgetEvaluator, *utils.CustomError) {
+	return NewBudgetEvaluatorWith(config.FromEnv())
+}
+
+// NewBudgetEvaluatorWith constructs a BudgetEvaluator from the budget file and the state object
+// in the settings of a report.
+// A relative path is resolved under the file directory of the query.
+//
+// The alerted thresholds are kept per report,
+// since the reports can share the state object and the budgets with different costs.
+func NewBudgetEvaluatorWith(settings config.Report) (BudgetEvaluator, *utils.CustomError) {
+	budgetPath := settings.Budget.File
+	if budgetPath == "" {
+		return BudgetEvaluator{}, nil
+	}
+	if !filepath.IsAbs(budgetPath) {
+		budgetPath = "./" + settings.Query.FileDirectory + budgetPath
+	}
+
+	content, err := ioutil.ReadFile(budgetPath)
+	if err != nil {
+		return BudgetEvaluator{}, newBudgetError("Could not read the budget file!", err)
+	}
+	evaluator, customErr := ParseBudgets(content)
+	if customErr != nil {
+		return BudgetEvaluator{}, customErr
+	}
+
+	if settings.Budget.StateObject != "" {
+		object, customErr := db.NewGCSObject(settings.Budget.StateObject)
+		if customErr != nil {
+			return BudgetEvaluator{}, customErr
+		}
+		evaluator.state = &object
+	}
+	evaluator.report = settings.Name
+	return evaluator, nil
+}
+
+// WithState returns a copy of the BudgetEvaluator keeping the alerted thresholds of the report in the store.
+func (e BudgetEvaluator) WithState(store BudgetStateStore, report string) BudgetEvaluator {
+	e.state = store
+	e.report = report
+	return e
+}
+
+// ParseBudgets constructs a BudgetEvaluator from the budgets in JSON.
+func ParseBudgets(content []byte) (BudgetEvaluator, *utils.CustomError) {
+	var budgets []Budget
+	err := json.Unmarshal(content, &budgets)
+	if err != nil {
+		return BudgetEvaluator{}, newBudgetError("Invalid budget file!", err)
+	}
+
+	var invalid []string
+	for i := range budgets {
+		budget := &budgets[i]
+		budget.Scope = strings.ToLower(budget.Scope)
+		switch {
+		case budget.Scope != BudgetScopeTotal && budget.Scope != BudgetScopeProject && budget.Scope != BudgetScopeService:
+			invalid = append(invalid, fmt.Sprintf("#%d: unknown scope '%s'", i+1, budget.Scope))
+		case budget.Scope != BudgetScopeTotal && budget.Name == "":
+			invalid = append(invalid, fmt.Sprintf("#%d: name is required for %s scope", i+1, budget.Scope))
+		case budget.Amount <= 0:
+			invalid = append(invalid, fmt.Sprintf("#%d: amount must be positive", i+1))
+		}
+	}
+	if len(invalid) > 0 {
+		return BudgetEvaluator{}, newBudgetError("Invalid budget file!", fmt.Errorf("%s", strings.Join(invalid, ", ")))
+	}
+	return BudgetEvaluator{budgets: budgets}, nil
+}
+
+// Evaluate method compares the monthly costs in the Invoice with the budgets
+// and sets the results on the Invoice.
+//
+// With a state store, a threshold is regarded as first crossed on this run
+// if it is higher than the threshold alerted last in the month (see Record method).
+//
+// Without it, a threshold is regarded as first crossed if the cost up to the day before
+// was below it and the cost including the most recent date is not.
+// This is inferred from the current data only,
+// so a crossing is missed if the billing data of the earlier days arrives late
+// and the cost up to the day before has already reached the threshold.
+//
+// Budgets for scopes missing in the Invoice (e.g. a project budget without project breakdown) are skipped.
+func (e *BudgetEvaluator) Evaluate(invoice *Invoice) {
+	alerted, err := e.alertedThresholds()
+	if err != nil {
+		log.Printf("Could not read the budget alert state. The crossings are inferred from the costs: %s", err.Error())
+	}
+
+	invoice.Budgets = nil
+	for _, budget := range e.budgets {
+		monthly, yesterday, ok := budgetCost(invoice, budget)
+		if !ok {
+			log.Printf("No cost for the %s budget '%s' in the invoice. It is skipped.", budget.Scope, budget.Name)
+			continue
+		}
+
+		percent := monthly / budget.Amount * 100
+		previousPercent := (monthly - yesterday) / budget.Amount * 100
+		status := &BudgetStatus{Budget: budget, Spent: monthly, Percent: percent}
+		for _, threshold := range BudgetThresholds {
+			if percent >= threshold {
+				status.Reached = threshold
+				if previousPercent < threshold {
+					status.Crossed = threshold
+				}
+			}
+		}
+		if alerted != nil {
+			status.Crossed = 0
+			if status.Reached > alerted[e.stateKey(invoice, budget)] {
+				status.Crossed = status.Reached
+			}
+		}
+		invoice.Budgets = append(invoice.Budgets, status)
+	}
+}
+
+// Record method stores the thresholds crossed in the Invoice as alerted,
+// so that they are not alerted again in the month.
+// It should be called after the Invoice is notified.
+// It does nothing without a state store.
+func (e *BudgetEvaluator) Record(invoice *Invoice) *utils.CustomError {
+	if e.state == nil || !invoice.HasBudgetAlert() {
+		return nil
+	}
+	alerted, err := e.alertedThresholds()
+	if err != nil {
+		return err
+	}
+	for _, status := range invoice.Budgets {
+		key := e.stateKey(invoice, status.Budget)
+		if status.Crossed > alerted[key] {
+			alerted[key] = status.Crossed
+		}
+	}
+
+	content, jsonErr := json.Marshal(alerted)
+	if jsonErr != nil {
+		return newBudgetError("Could not encode the budget alert state!", jsonErr)
+	}
+	return e.state.Write(content)
+}
+
+// alertedThresholds reads the thresholds alerted last for each budget and month.
+// It returns nil without a state store.
+func (e *BudgetEvaluator) alertedThresholds() (map[string]float32, *utils.CustomError) {
+	if e.state == nil {
+		return nil, nil
+	}
+	content, err := e.state.Read()
+	if err != nil {
+		return nil, err
+	}
+	alerted := map[string]float32{}
+	if len(content) == 0 {
+		return alerted, nil
+	}
+	if jsonErr := json.Unmarshal(content, &alerted); jsonErr != nil {
+		return nil, newBudgetError("Invalid budget alert state!", jsonErr)
+	}
+	return alerted, nil
+}
+
+// stateKey identifies a budget of the report in the month of the Invoice in the alert state,
+// e.g. "finance/2021-05/total/".
+func (e *BudgetEvaluator) stateKey(invoice *Invoice, budget Budget) string {
+	report := e.report
+	if report == "" {
+		report = "default"
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", report, invoice.BillingPeriod.To.Format("2006-01"), budget.Scope, budget.Name)
+}
+
+// budgetCost returns the monthly cost and the cost on the most recent date of the budget scope.
+func budgetCost(invoice *Invoice, budget Budget) (float32, float32, bool) {
+	switch budget.Scope {
+	case BudgetScopeTotal:
+		return invoice.Total.Monthly, invoice.Total.Yesterday, true
+	case BudgetScopeProject:
+		for _, project := range invoice.Projects {
+			if project.Project == budget.Name {
+				return project.Monthly, project.Yesterday, true
+			}
+		}
+	case BudgetScopeService:
+		for _, cost := range invoice.Services {
+			if cost.Service == budget.Name {
+				return cost.Monthly, cost.Yesterday, true
+			}
+		}
+		var monthly, yesterday float32
+		found := false
+		for _, project := range invoice.Projects {
+			for _, cost := range project.Services {
+				if cost.Service == budget.Name {
+					monthly += cost.Monthly
+					yesterday += cost.Yesterday
+					found = true
+				}
+			}
+		}
+		return monthly, yesterday, found
+	}
+	return 0, 0, false
+}
+
+// HasBudgetAlert reports whether any budget threshold is first crossed on this run.
+func (b *Invoice) HasBudgetAlert() bool {
+	for _, status := range b.Budgets {
+		if status.Crossed > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// budgetAlertSection creates the section to escalate the budget thresholds crossed on this run.
+func (b *Invoice) budgetAlertSection() *MessageSection {
+	currency := b.currency()
+	catalog := b.catalog()
+	section := &MessageSection{Header: catalog.BudgetAlertHeader}
+	for _, status := range b.Budgets {
+		if status.Crossed == 0 {
+			continue
+		}
+		section.Items = append(section.Items, MessageItem{
+			Name: status.Budget.label(catalog),
+			Value: fmt.Sprintf(catalog.BudgetCrossed,
+				status.Crossed, currency.Format(status.Spent), currency.Format(status.Budget.Amount), status.Percent,
+			),
+		})
+	}
+	return section
+}
+
+// budgetSection creates the section of percent consumed of the budgets.
+func (b *Invoice) budgetSection() *MessageSection {
+	currency := b.currency()
+	catalog := b.catalog()
+	section := &MessageSection{Header: catalog.BudgetsHeader}
+	for _, status := range b.Budgets {
+		value := fmt.Sprintf("%s / %s (%.1f%%)",
+			currency.Format(status.Spent), currency.Format(status.Budget.Amount), status.Percent)
+		switch {
+		case status.Reached >= 100:
+			value += " 🔴"
+		case status.Reached >= 80:
+			value += " 🟠"
+		case status.Reached >= 50:
+			value += " 🟡"
+		}
+		section.Items = append(section.Items, MessageItem{Name: status.Budget.label(catalog), Value: value})
+	}
+	return section
+}
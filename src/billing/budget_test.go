@@ -0,0 +1,233 @@
+package billing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func newBudgetInputInvoice() *Invoice {
+	return &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total: &Cost{Service: "Total", Monthly: 8500.0, Yesterday: 1000.0},
+		Projects: []*ProjectCost{
+			{Project: "project-a", Monthly: 6000.0, Yesterday: 1000.0, Services: []*Cost{
+				{Service: "Cloud SQL", Monthly: 5000.0, Yesterday: 1000.0},
+				{Service: "BigQuery", Monthly: 1000.0, Yesterday: 0.0},
+			}},
+			{Project: "project-b", Monthly: 2500.0, Yesterday: 0.0, Services: []*Cost{
+				{Service: "Cloud SQL", Monthly: 2500.0, Yesterday: 0.0},
+			}},
+		},
+	}
+}
+
+func ExampleBudgetEvaluator_Evaluate() {
+	budgetEvaluator, _ := ParseBudgets([]byte(`[
+		{"scope": "total", "amount": 10000},
+		{"scope": "project", "name": "project-b", "amount": 2000},
+		{"scope": "service", "name": "Cloud SQL", "amount": 20000}
+	]`))
+	invoice := newBudgetInputInvoice()
+
+	budgetEvaluator.Evaluate(invoice)
+
+	fmt.Println(invoice.SummaryMessage())
+	// Output:
+	// 🚨 ----- 予算アラート -----
+	// Total: 予算の 80% を超えました (¥ 8,500 / ¥ 10,000, 85.0%)
+	//
+	// ＜5/1 ~ 5/8 の GCP 利用料金＞ ※ () 内は前日分
+	//
+	// Total: ¥ 8,500 (¥ 1,000)
+	//
+	// ----- 予算 -----
+	// Total: ¥ 8,500 / ¥ 10,000 (85.0%) 🟠
+	// project-b: ¥ 2,500 / ¥ 2,000 (125.0%) 🔴
+	// Cloud SQL: ¥ 7,500 / ¥ 20,000 (37.5%)
+}
+
+func TestFlagOnlyThresholdsFirstCrossedOnThisRun(t *testing.T) {
+	budgetEvaluator, _ := ParseBudgets([]byte(`[{"scope": "total", "amount": 10000}]`))
+
+	// 75% to 85%: 80% is crossed.
+	invoice := newBudgetInputInvoice()
+	budgetEvaluator.Evaluate(invoice)
+	assert.EqualValues(t, 80, invoice.Budgets[0].Reached)
+	assert.EqualValues(t, 80, invoice.Budgets[0].Crossed)
+	assert.True(t, invoice.HasBudgetAlert())
+
+	// 81% to 85%: 80% was already crossed the day before.
+	invoice = newBudgetInputInvoice()
+	invoice.Total.Yesterday = 400.0
+	budgetEvaluator.Evaluate(invoice)
+	assert.EqualValues(t, 80, invoice.Budgets[0].Reached)
+	assert.EqualValues(t, 0, invoice.Budgets[0].Crossed)
+	assert.False(t, invoice.HasBudgetAlert())
+	assert.False(t, strings.Contains(invoice.SummaryMessage(), "予算アラート"), invoice.SummaryMessage())
+}
+
+// Without a state store, the crossing is inferred from the costs,
+// so it is missed when the cost of the earlier days arrives late.
+func TestMissCrossingByLateCostWithoutState(t *testing.T) {
+	budgetEvaluator, _ := ParseBudgets([]byte(`[{"scope": "total", "amount": 10000}]`))
+
+	// The cost up to the day before reached 80% only after the data of the earlier days arrived.
+	invoice := newBudgetInputInvoice()
+	invoice.Total.Yesterday = 100.0
+	budgetEvaluator.Evaluate(invoice)
+
+	assert.EqualValues(t, 80, invoice.Budgets[0].Reached)
+	assert.EqualValues(t, 0, invoice.Budgets[0].Crossed)
+}
+
+type budgetStateStub struct {
+	content []byte
+	writes  int
+}
+
+func (s *budgetStateStub) Read() ([]byte, *utils.CustomError) {
+	return s.content, nil
+}
+
+func (s *budgetStateStub) Write(content []byte) *utils.CustomError {
+	s.content = content
+	s.writes++
+	return nil
+}
+
+func TestAlertThresholdOnceWithState(t *testing.T) {
+	state := &budgetStateStub{}
+	budgetEvaluator, _ := ParseBudgets([]byte(`[{"scope": "total", "amount": 10000}]`))
+	budgetEvaluator = budgetEvaluator.WithState(state, "finance")
+
+	// The crossing is not missed even if the cost up to the day before has already reached 80%.
+	invoice := newBudgetInputInvoice()
+	invoice.Total.Yesterday = 100.0
+	budgetEvaluator.Evaluate(invoice)
+	assert.EqualValues(t, 80, invoice.Budgets[0].Crossed)
+
+	assert.Nil(t, budgetEvaluator.Record(invoice))
+	assert.JSONEq(t, `{"finance/2021-05/total/": 80}`, string(state.content))
+
+	// 80% is not alerted again in the month.
+	invoice = newBudgetInputInvoice()
+	budgetEvaluator.Evaluate(invoice)
+	assert.EqualValues(t, 0, invoice.Budgets[0].Crossed)
+	assert.Nil(t, budgetEvaluator.Record(invoice))
+	assert.EqualValues(t, 1, state.writes)
+
+	// 100% is alerted.
+	invoice = newBudgetInputInvoice()
+	invoice.Total.Monthly = 10500.0
+	budgetEvaluator.Evaluate(invoice)
+	assert.EqualValues(t, 100, invoice.Budgets[0].Crossed)
+
+	// 80% is alerted again in the next month.
+	invoice = newBudgetInputInvoice()
+	invoice.BillingPeriod.From = time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)
+	invoice.BillingPeriod.To = time.Date(2021, 6, 8, 0, 0, 0, 0, time.Local)
+	budgetEvaluator.Evaluate(invoice)
+	assert.EqualValues(t, 80, invoice.Budgets[0].Crossed)
+}
+
+func TestAlertThresholdOfEachReportSharingState(t *testing.T) {
+	state := &budgetStateStub{}
+	budgets, _ := ParseBudgets([]byte(`[{"scope": "total", "amount": 10000}]`))
+	finance := budgets.WithState(state, "finance")
+	teamA := budgets.WithState(state, "team-a")
+
+	invoice := newBudgetInputInvoice()
+	finance.Evaluate(invoice)
+	assert.Nil(t, finance.Record(invoice))
+
+	// The crossing recorded by another report does not suppress the alert.
+	invoice = newBudgetInputInvoice()
+	teamA.Evaluate(invoice)
+	assert.EqualValues(t, 80, invoice.Budgets[0].Crossed)
+	assert.Nil(t, teamA.Record(invoice))
+	assert.JSONEq(t, `{"finance/2021-05/total/": 80, "team-a/2021-05/total/": 80}`, string(state.content))
+}
+
+func TestFlagHighestThresholdCrossedAtOnce(t *testing.T) {
+	budgetEvaluator, _ := ParseBudgets([]byte(`[{"scope": "total", "amount": 8000}]`))
+	invoice := newBudgetInputInvoice()
+	invoice.Total.Yesterday = 5000.0
+
+	budgetEvaluator.Evaluate(invoice)
+
+	assert.EqualValues(t, 100, invoice.Budgets[0].Crossed)
+}
+
+func TestSkipBudgetOfScopeMissingInInvoice(t *testing.T) {
+	budgetEvaluator, _ := ParseBudgets([]byte(`[
+		{"scope": "project", "name": "project-c", "amount": 1000},
+		{"scope": "service", "name": "BigQuery", "amount": 1000}
+	]`))
+	invoice := newBudgetInputInvoice()
+
+	budgetEvaluator.Evaluate(invoice)
+
+	assert.Len(t, invoice.Budgets, 1)
+	assert.EqualValues(t, "BigQuery", invoice.Budgets[0].Budget.Name)
+	assert.EqualValues(t, 100, invoice.Budgets[0].Reached)
+	assert.EqualValues(t, 0, invoice.Budgets[0].Crossed)
+}
+
+func TestShowBudgetAlertInEnglish(t *testing.T) {
+	budgetEvaluator, _ := ParseBudgets([]byte(`[{"scope": "TOTAL", "amount": 16000}]`))
+	invoice := newBudgetInputInvoice()
+	invoice.Language = "en"
+
+	budgetEvaluator.Evaluate(invoice)
+
+	assert.True(t, strings.HasPrefix(invoice.SummaryMessage(),
+		"🚨 ----- Budget alert -----\nTotal: crossed 50% of the budget (¥ 8,500 / ¥ 16,000, 53.1%)\n\n"), invoice.SummaryMessage())
+}
+
+func TestReturnErrorWhenBudgetsAreInvalid(t *testing.T) {
+	_, err := ParseBudgets([]byte(`[
+		{"scope": "team", "name": "a", "amount": 1000},
+		{"scope": "project", "amount": 1000},
+		{"scope": "total", "amount": 0}
+	]`))
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t,
+		"Error in Budget Evaluation. Invalid budget file!: #1: unknown scope 'team', #2: name is required for project scope, #3: amount must be positive",
+		err.Error())
+}
+
+func TestLoadBudgetFile(t *testing.T) {
+	budgetFile, _ := ioutil.TempFile("", "budgets*.json")
+	budgetFile.WriteString(`[{"scope": "total", "amount": 10000}]`)
+	budgetFile.Close()
+	defer os.Remove(budgetFile.Name())
+
+	os.Setenv("BUDGET_FILE", budgetFile.Name())
+	defer os.Unsetenv("BUDGET_FILE")
+
+	budgetEvaluator, err := NewBudgetEvaluator()
+
+	assert.Nil(t, err)
+	assert.Len(t, budgetEvaluator.budgets, 1)
+}
+
+func TestReturnErrorWhenBudgetFileDoesNotExist(t *testing.T) {
+	os.Setenv("BUDGET_FILE", "/no/such/budgets.json")
+	defer os.Unsetenv("BUDGET_FILE")
+
+	_, err := NewBudgetEvaluator()
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Budget Evaluation. Could not read the budget file!"), err)
+}
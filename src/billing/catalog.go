@@ -0,0 +1,222 @@
+package billing
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+// DefaultLanguage is the language of the messages
+// when no language or an unknown language is selected.
+const DefaultLanguage = "ja"
+
+// Catalog contains the texts and formats of the notification messages in a language.
+type Catalog struct {
+	Language string // Language code (e.g. "ja", "en")
+
+	Title            string // Title line of the text message. %s is replaced with the billing period.
+	DateLayout       string // Layout of the dates in the billing period (see time.Format)
+	PeriodSeparator  string // Separator of the first and last dates of the billing period
+	Total            string // Name of the total cost
+	Credits          string // Name of the credits
+	DetailsHeader    string // Header of the service costs
+	ProjectsHeader   string // Header of the project costs
+	LabelsHeader     string // Header of the label costs. %s is replaced with the label key.
+	CreditsHeader    string // Header of the credits for each type
+	UnlabelledValue  string // Label value displayed for resources without the label
+	ErrorNoticeTitle string // Notification of a failure. %s is replaced with the failed process.
+	Heading          string // Short heading of the invoice. %s is replaced with the billing period.
+	MonthlyLabel     string // Name of the monthly sum of the cost
+	YesterdayLabel   string // Name of the cost on the most recent date
+	ExportTimeLabel  string // Name of the time the billing data was last exported
+	MoreItems        string // Line for the items omitted by a length limit. %d is replaced with the number.
+
+	DayOverDayLabel     string // Name of the change of the cost from the day before
+	MonthOverMonthLabel string // Name of the change of the cost from the same period of the previous month
+
+	AnomaliesHeader string // Header of the services with anomalous costs on the most recent date
+	UsualCost       string // Usual daily cost of an anomalous service. %s is replaced with the cost.
+	ForecastLabel   string // Name of the forecasted month-end cost
+	ForecastHeader  string // Header of the forecasted month-end costs of the services
+
+	BudgetsHeader     string // Header of the percent consumed of the budgets
+	BudgetAlertHeader string // Header of the budget thresholds crossed on this run
+	BudgetCrossed     string // Crossed threshold of a budget. Replaced with the threshold, spent, budget and percent.
+
+	CommandAcknowledgement string // Immediate response to a slash command
+	CommandFailed          string // Response to a slash command which could not be handed over to the report
+	CommandInvalid         string // Response to a slash command with invalid arguments. %s is replaced with the problems.
+	CommandUsage           string // Usage of the slash command. %s is replaced with the command.
+}
+
+// catalogsMu guards catalogs, which may be read by notifiers running concurrently.
+var catalogsMu sync.RWMutex
+
+var catalogs = map[string]*Catalog{
+	"ja": {
+		Language:         "ja",
+		Title:            "＜%s の GCP 利用料金＞ ※ () 内は前日分",
+		DateLayout:       "1/2",
+		PeriodSeparator:  " ~ ",
+		Total:            "Total",
+		Credits:          "Credits",
+		DetailsHeader:    "----- 内訳 -----",
+		ProjectsHeader:   "----- プロジェクト別 -----",
+		LabelsHeader:     "----- ラベル別 (%s) -----",
+		CreditsHeader:    "----- クレジット内訳 -----",
+		UnlabelledValue:  "(ラベルなし)",
+		ErrorNoticeTitle: "%s で処理が失敗しました！",
+		Heading:          "%s の GCP 利用料金",
+		MonthlyLabel:     "月間合計",
+		YesterdayLabel:   "前日分",
+		ExportTimeLabel:  "データ更新日時",
+		MoreItems:        "ほか %d 件",
+
+		DayOverDayLabel:     "前日比",
+		MonthOverMonthLabel: "前月同期比",
+
+		AnomaliesHeader: "⚠️ ----- 異常値 -----",
+		UsualCost:       "通常 %s",
+		ForecastLabel:   "月末予測",
+		ForecastHeader:  "----- 月末予測 -----",
+
+		BudgetsHeader:     "----- 予算 -----",
+		BudgetAlertHeader: "🚨 ----- 予算アラート -----",
+		BudgetCrossed:     "予算の %.0f%% を超えました (%s / %s, %.1f%%)",
+
+		CommandAcknowledgement: "⏳ GCP 利用料金を集計しています…",
+		CommandFailed:          "⚠️ 集計を開始できませんでした。しばらくしてから再度お試しください。",
+		CommandInvalid:         "⚠️ 引数が正しくありません: %s",
+		CommandUsage:           "使い方: %s [プロジェクトID] [期間]\n期間: mtd (今月), last_month (先月), last_7_days (過去7日間), 2021-08-01..2021-08-07",
+	},
+	"en": {
+		Language:         "en",
+		Title:            "<GCP costs for %s> * Yesterday's costs in ()",
+		DateLayout:       "Jan 2",
+		PeriodSeparator:  " - ",
+		Total:            "Total",
+		Credits:          "Credits",
+		DetailsHeader:    "----- Breakdown -----",
+		ProjectsHeader:   "----- By project -----",
+		LabelsHeader:     "----- By label (%s) -----",
+		CreditsHeader:    "----- Credits by type -----",
+		UnlabelledValue:  "(unlabelled)",
+		ErrorNoticeTitle: "Process Failed at %s!",
+		Heading:          "GCP costs for %s",
+		MonthlyLabel:     "Month to date",
+		YesterdayLabel:   "Yesterday",
+		ExportTimeLabel:  "Data as of",
+		MoreItems:        "and %d more",
+
+		DayOverDayLabel:     "DoD",
+		MonthOverMonthLabel: "MoM",
+
+		AnomaliesHeader: "⚠️ ----- Anomalies -----",
+		UsualCost:       "usually %s",
+		ForecastLabel:   "forecast",
+		ForecastHeader:  "----- Month-end forecast -----",
+
+		BudgetsHeader:     "----- Budgets -----",
+		BudgetAlertHeader: "🚨 ----- Budget alert -----",
+		BudgetCrossed:     "crossed %.0f%% of the budget (%s / %s, %.1f%%)",
+
+		CommandAcknowledgement: "⏳ Retrieving GCP costs…",
+		CommandFailed:          "⚠️ Could not start retrieving GCP costs. Please try again later.",
+		CommandInvalid:         "⚠️ Invalid arguments: %s",
+		CommandUsage:           "Usage: %s [project ID] [period]\nPeriod: mtd (month to date), last_month, last_7_days, 2021-08-01..2021-08-07",
+	},
+}
+
+// RegisterCatalog adds a message catalog of a new language
+// or replaces that of an existing language.
+func RegisterCatalog(catalog *Catalog) {
+	catalogsMu.Lock()
+	defer catalogsMu.Unlock()
+	catalogs[strings.ToLower(catalog.Language)] = catalog
+}
+
+// LookupCatalog returns the message catalog of the language.
+//
+// Regional variants such as "en-US" or "ja_JP" fall back to the base language,
+// and an empty or unknown language falls back to DefaultLanguage.
+func LookupCatalog(language string) *Catalog {
+	catalogsMu.RLock()
+	defer catalogsMu.RUnlock()
+	language = strings.ToLower(language)
+	if catalog, ok := catalogs[language]; ok {
+		return catalog
+	}
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		if catalog, ok := catalogs[language[:i]]; ok {
+			return catalog
+		}
+	}
+	return catalogs[DefaultLanguage]
+}
+
+// ErrorNotice is an object to notify a CustomError
+// in the language of the message catalog.
+//
+// If Language is empty, the notice keeps the wording of CustomError.AsMessage
+// regardless of DefaultLanguage.
+type ErrorNotice struct {
+	Err      *utils.CustomError
+	Language string
+}
+
+func (n *ErrorNotice) Error() string {
+	return n.Err.Error()
+}
+
+// AsMessage creates a notification message of the error.
+func (n *ErrorNotice) AsMessage() string {
+	if n.Language == "" {
+		return n.Err.AsMessage()
+	}
+	return fmt.Sprintf(LookupCatalog(n.Language).ErrorNoticeTitle, n.Err.Process)
+}
+
+// Localizer is an object to set the language of notification messages.
+type Localizer struct {
+	language string
+}
+
+// NewLocalizer constructs a Localizer with the language designated in
+// the environment variable `MESSAGE_LANGUAGE` (e.g. `ja`, `en`).
+// If it is empty or has no message catalog, DefaultLanguage is used.
+func NewLocalizer() Localizer {
+	return NewLocalizerWith(config.FromEnv().Message)
+}
+
+// NewLocalizerWith constructs a Localizer with the language in the settings of a report.
+func NewLocalizerWith(settings config.Message) Localizer {
+	language := settings.Language
+	if language == "" {
+		language = DefaultLanguage
+	}
+	catalog := LookupCatalog(language)
+	if !strings.HasPrefix(strings.ToLower(language), catalog.Language) {
+		log.Printf("No message catalog for language '%s'. '%s' is used instead.", language, catalog.Language)
+	}
+	return Localizer{language: catalog.Language}
+}
+
+// Localize method sets the language of the Invoice message.
+func (l *Localizer) Localize(invoice *Invoice) {
+	invoice.Language = l.language
+}
+
+// Catalog method returns the message catalog in the language.
+func (l *Localizer) Catalog() *Catalog {
+	return LookupCatalog(l.language)
+}
+
+// ErrorNotice method wraps an error to notify it in the language,
+// which is DefaultLanguage unless designated.
+func (l *Localizer) ErrorNotice(err *utils.CustomError) *ErrorNotice {
+	return &ErrorNotice{Err: err, Language: l.language}
+}
@@ -0,0 +1,64 @@
+package billing
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func ExampleBillingPeriod_Format() {
+	period := BillingPeriod{
+		From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+		To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+	}
+	fmt.Println(period.Format(LookupCatalog("en")))
+	// Output: May 1 - May 8
+}
+
+func TestLookupCatalogOfRegionalVariant(t *testing.T) {
+	assert.EqualValues(t, "en", LookupCatalog("en-US").Language)
+	assert.EqualValues(t, "ja", LookupCatalog("ja_JP").Language)
+}
+
+func TestLookupDefaultCatalogForUnknownLanguage(t *testing.T) {
+	assert.EqualValues(t, DefaultLanguage, LookupCatalog("xx").Language)
+	assert.EqualValues(t, DefaultLanguage, LookupCatalog("").Language)
+}
+
+func TestRegisterNewCatalog(t *testing.T) {
+	catalog := *LookupCatalog("en")
+	catalog.Language = "fr"
+	catalog.DetailsHeader = "----- Détail -----"
+	RegisterCatalog(&catalog)
+	defer delete(catalogs, "fr")
+
+	assert.EqualValues(t, "----- Détail -----", LookupCatalog("fr").DetailsHeader)
+}
+
+func TestCreateErrorNoticeInLanguage(t *testing.T) {
+	err := &utils.CustomError{Process: "Query Execution", Message: "Failed", Err: fmt.Errorf("Something Happened!")}
+
+	englishNotice := &ErrorNotice{Err: err, Language: "en"}
+	japaneseNotice := &ErrorNotice{Err: err, Language: "ja"}
+
+	assert.EqualValues(t, "Process Failed at Query Execution!", englishNotice.AsMessage())
+	assert.EqualValues(t, "Query Execution で処理が失敗しました！", japaneseNotice.AsMessage())
+	assert.EqualValues(t, err.Error(), englishNotice.Error())
+}
+
+func TestCreateErrorNoticeInLanguageOfLocalizer(t *testing.T) {
+	err := &utils.CustomError{Process: "Query Execution", Message: "Failed", Err: fmt.Errorf("Something Happened!")}
+
+	os.Unsetenv("MESSAGE_LANGUAGE")
+	defaultLocalizer := NewLocalizer()
+	assert.EqualValues(t, "Query Execution で処理が失敗しました！", defaultLocalizer.ErrorNotice(err).AsMessage())
+
+	os.Setenv("MESSAGE_LANGUAGE", "en")
+	defer os.Unsetenv("MESSAGE_LANGUAGE")
+	englishLocalizer := NewLocalizer()
+	assert.EqualValues(t, "Process Failed at Query Execution!", englishLocalizer.ErrorNotice(err).AsMessage())
+}
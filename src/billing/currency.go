@@ -0,0 +1,124 @@
+package billing
+
+import (
+	"log"
+	"math"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+)
+
+// DefaultCurrency is the currency code assumed
+// when the currency of the billing account is unknown.
+const DefaultCurrency = "JPY"
+
+// Currency contains how to display amounts of money in a currency.
+type Currency struct {
+	Code             string // ISO 4217 currency code
+	Symbol           string // Symbol put before the amount
+	Digits           int    // Maximum number of decimal places
+	GroupSeparator   string // Separator of thousands
+	DecimalSeparator string // Separator of the integer and fractional parts
+}
+
+// The billing export keeps fractional amounts even for currencies without minor units,
+// so JPY is displayed with up to 2 decimal places.
+var currencies = map[string]*Currency{
+	"JPY": {Code: "JPY", Symbol: "¥", Digits: 2, GroupSeparator: ",", DecimalSeparator: "."},
+	"USD": {Code: "USD", Symbol: "$", Digits: 2, GroupSeparator: ",", DecimalSeparator: "."},
+	"EUR": {Code: "EUR", Symbol: "€", Digits: 2, GroupSeparator: ".", DecimalSeparator: ","},
+	"GBP": {Code: "GBP", Symbol: "£", Digits: 2, GroupSeparator: ",", DecimalSeparator: "."},
+	"AUD": {Code: "AUD", Symbol: "A$", Digits: 2, GroupSeparator: ",", DecimalSeparator: "."},
+	"CAD": {Code: "CAD", Symbol: "CA$", Digits: 2, GroupSeparator: ",", DecimalSeparator: "."},
+	"CHF": {Code: "CHF", Symbol: "CHF", Digits: 2, GroupSeparator: "'", DecimalSeparator: "."},
+	"CNY": {Code: "CNY", Symbol: "CN¥", Digits: 2, GroupSeparator: ",", DecimalSeparator: "."},
+	"INR": {Code: "INR", Symbol: "₹", Digits: 2, GroupSeparator: ",", DecimalSeparator: "."},
+	"KRW": {Code: "KRW", Symbol: "₩", Digits: 0, GroupSeparator: ",", DecimalSeparator: "."},
+	"BRL": {Code: "BRL", Symbol: "R$", Digits: 2, GroupSeparator: ".", DecimalSeparator: ","},
+}
+
+// LookupCurrency returns the display format of a currency code.
+//
+// An empty code is regarded as DefaultCurrency.
+// An unknown code is displayed with the code itself as the symbol and 2 decimal places.
+func LookupCurrency(code string) *Currency {
+	if code == "" {
+		code = DefaultCurrency
+	}
+	code = strings.ToUpper(code)
+	if currency, ok := currencies[code]; ok {
+		return currency
+	}
+	return &Currency{Code: code, Symbol: code, Digits: 2, GroupSeparator: ",", DecimalSeparator: "."}
+}
+
+// Format displays an amount with the currency symbol
+// in the "¥ 1,000.07" format.
+// Trailing zeros of the fractional part are omitted.
+func (c *Currency) Format(amount float32) string {
+	scale := math.Pow10(c.Digits)
+	rounded := math.Round(float64(amount)*scale) / scale
+	number := humanize.CommafWithDigits(rounded, c.Digits)
+	if c.GroupSeparator != "," || c.DecimalSeparator != "." {
+		number = strings.NewReplacer(",", c.GroupSeparator, ".", c.DecimalSeparator).Replace(number)
+	}
+	return c.Symbol + " " + number
+}
+
+// CurrencyConverter is an object to convert the costs in an Invoice
+// into the reporting currency.
+type CurrencyConverter struct {
+	currency string  // Reporting currency code (empty: no conversion)
+	rate     float64 // Amount in the reporting currency per 1 unit of the billing currency
+}
+
+// NewCurrencyConverter constructs a CurrencyConverter
+// from the environment variables.
+//
+// `REPORTING_CURRENCY` ... the currency code to report the costs in.
+// If it is empty, the costs are reported in the currency of the billing account.
+//
+// `REPORTING_CURRENCY_RATE` ... the amount in the reporting currency per 1 unit
+// of the billing account currency. It can be omitted when the reporting currency is USD,
+// since the billing export contains the exchange rate from USD.
+func NewCurrencyConverter() CurrencyConverter {
+	return NewCurrencyConverterWith(config.FromEnv().Message)
+}
+
+// NewCurrencyConverterWith constructs a CurrencyConverter with the currency and the rate in the settings of a report.
+// An invalid rate is logged and the rate in the billing export is used instead.
+func NewCurrencyConverterWith(settings config.Message) CurrencyConverter {
+	rate := settings.CurrencyRate
+	if rate < 0 {
+		log.Printf("Invalid currency rate '%g'. The rate in the billing export is used instead.", rate)
+		rate = 0
+	}
+	return CurrencyConverter{
+		currency: strings.ToUpper(settings.Currency),
+		rate:     rate,
+	}
+}
+
+// Convert method converts all the costs in the Invoice into the reporting currency.
+//
+// If the conversion rate is not available, the Invoice is left in the original currency.
+func (c *CurrencyConverter) Convert(invoice *Invoice) {
+	source := LookupCurrency(invoice.Currency).Code
+	if c.currency == "" || c.currency == source {
+		return
+	}
+
+	rate := c.rate
+	if rate == 0 && c.currency == "USD" && invoice.CurrencyConversionRate > 0 {
+		rate = 1 / invoice.CurrencyConversionRate
+	}
+	if rate == 0 {
+		log.Printf("No conversion rate from %s to %s. The costs are reported in %s.", source, c.currency, source)
+		return
+	}
+
+	invoice.scale(float32(rate))
+	invoice.Currency = c.currency
+	invoice.CurrencyConversionRate = invoice.CurrencyConversionRate * rate
+}
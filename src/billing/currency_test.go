@@ -0,0 +1,78 @@
+package billing
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleCurrency_Format() {
+	fmt.Println(LookupCurrency("JPY").Format(1000.07))
+	fmt.Println(LookupCurrency("USD").Format(1234.5))
+	fmt.Println(LookupCurrency("EUR").Format(1234.5))
+	fmt.Println(LookupCurrency("KRW").Format(1234.5))
+	// Output:
+	// ¥ 1,000.07
+	// $ 1,234.5
+	// € 1.234,5
+	// ₩ 1,235
+}
+
+func TestLookupDefaultCurrencyWhenCodeIsEmpty(t *testing.T) {
+	assert.EqualValues(t, "JPY", LookupCurrency("").Code)
+}
+
+func TestLookupUnknownCurrencyWithCodeAsSymbol(t *testing.T) {
+	currency := LookupCurrency("xyz")
+
+	assert.EqualValues(t, "XYZ XYZ 1,000.5", currency.Code+" "+currency.Format(1000.5))
+}
+
+func TestConvertInvoiceIntoUSDWithExportedRate(t *testing.T) {
+	inputInvoice := &Invoice{
+		Total:    &Cost{Service: "Total", Monthly: 1100.0, Yesterday: 220.0},
+		Services: []*Cost{{Service: "Cloud SQL", Monthly: 1100.0, Yesterday: 220.0}},
+		Currency: "JPY",
+
+		CurrencyConversionRate: 110.0,
+	}
+	converter := CurrencyConverter{currency: "USD"}
+
+	converter.Convert(inputInvoice)
+
+	assert.EqualValues(t, "USD", inputInvoice.Currency)
+	assert.InDelta(t, 10.0, inputInvoice.Total.Monthly, 1e-4)
+	assert.InDelta(t, 2.0, inputInvoice.Services[0].Yesterday, 1e-4)
+	assert.InDelta(t, 1.0, inputInvoice.CurrencyConversionRate, 1e-6)
+}
+
+func TestConvertInvoiceWithConfiguredRate(t *testing.T) {
+	inputInvoice := &Invoice{
+		Total:    &Cost{Service: "Total", Monthly: 1000.0, Yesterday: 200.0},
+		Services: []*Cost{},
+		Labels:   []*LabelCost{{Key: "team", Value: "backend", Monthly: 1000.0, Yesterday: 200.0}},
+		Currency: "JPY",
+	}
+	converter := CurrencyConverter{currency: "EUR", rate: 0.008}
+
+	converter.Convert(inputInvoice)
+
+	assert.EqualValues(t, "EUR", inputInvoice.Currency)
+	assert.InDelta(t, 8.0, inputInvoice.Total.Monthly, 1e-4)
+	assert.InDelta(t, 1.6, inputInvoice.Labels[0].Yesterday, 1e-4)
+}
+
+func TestNotConvertInvoiceWithoutRate(t *testing.T) {
+	inputInvoice := &Invoice{
+		Total:    &Cost{Service: "Total", Monthly: 1000.0, Yesterday: 200.0},
+		Services: []*Cost{},
+		Currency: "JPY",
+	}
+	converter := CurrencyConverter{currency: "EUR"}
+
+	converter.Convert(inputInvoice)
+
+	assert.EqualValues(t, "JPY", inputInvoice.Currency)
+	assert.EqualValues(t, 1000.0, inputInvoice.Total.Monthly)
+}
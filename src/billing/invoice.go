@@ -7,10 +7,12 @@ package billing
 import (
 	"fmt"
 	"log"
+	"math"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/dustin/go-humanize"
+	"github.com/tatamiya/gcp-cost-notification/src/analysis"
 	"github.com/tatamiya/gcp-cost-notification/src/datetime"
 	"github.com/tatamiya/gcp-cost-notification/src/db"
 	"github.com/tatamiya/gcp-cost-notification/src/utils"
@@ -32,31 +34,244 @@ type BillingPeriod struct {
 
 // Display the period in the "MM/DD ~ MM/DD" format.
 func (a *BillingPeriod) String() string {
-	return fmt.Sprintf("%d/%d ~ %d/%d", a.From.Month(), a.From.Day(), a.To.Month(), a.To.Day())
+	return a.Format(LookupCatalog(DefaultLanguage))
+}
+
+// Format displays the period with the date layout of the message catalog.
+func (a *BillingPeriod) Format(catalog *Catalog) string {
+	return a.From.Format(catalog.DateLayout) + catalog.PeriodSeparator + a.To.Format(catalog.DateLayout)
+}
+
+// IsMonthToDate reports whether the period starts on the first day of a month and ends in the same month.
+// Only such a period is compared with the same period of the previous month.
+func (a *BillingPeriod) IsMonthToDate() bool {
+	return a.From.Day() == 1 && a.From.Year() == a.To.Year() && a.From.Month() == a.To.Month()
+}
+
+// costLine displays a cost in the "name: ¥ monthly (¥ yesterday)" format.
+func costLine(name string, monthly float32, yesterday float32, currency *Currency) string {
+	return fmt.Sprintf("%s: %s (%s)", name, currency.Format(monthly), currency.Format(yesterday))
 }
 
 // Cost contains the service name, monthly sum of the cost,
 // and the cost on the most recent date.
+//
+// Monthly and Yesterday are net costs with credits applied,
+// or gross costs if the query reports the costs before credits.
+// The credits are kept separately as negative amounts.
+//
+// DayBeforeYesterday and PreviousMonthly are the net costs to compare with:
+// the cost on the day before the most recent date
+// and the cost in the same period of the previous month.
+//
+// SKUs is nil unless the service is drilled down into SKUs.
 type Cost struct {
 	Service   string
 	Monthly   float32
 	Yesterday float32
+	SKUs      []*SKUCost
+
+	MonthlyCredits   float32
+	YesterdayCredits float32
+
+	DayBeforeYesterday float32
+	PreviousMonthly    float32
+}
+
+// MonthlyGross returns the monthly cost before credits are applied (for net costs).
+func (r *Cost) MonthlyGross() float32 {
+	return r.Monthly - r.MonthlyCredits
+}
+
+// YesterdayGross returns the cost on the most recent date before credits are applied (for net costs).
+func (r *Cost) YesterdayGross() float32 {
+	return r.Yesterday - r.YesterdayCredits
+}
+
+// DayOverDay returns the change of the cost on the most recent date from the day before.
+func (r *Cost) DayOverDay() float32 {
+	return r.Yesterday - r.DayBeforeYesterday
+}
+
+// MonthOverMonth returns the change of the monthly cost
+// from the same period of the previous month.
+func (r *Cost) MonthOverMonth() float32 {
+	return r.Monthly - r.PreviousMonthly
+}
+
+func (r *Cost) hasComparison(monthly bool) bool {
+	return r.DayBeforeYesterday != 0 || (monthly && r.PreviousMonthly != 0)
+}
+
+// comparison displays the day-over-day and month-over-month changes
+// in the "前日比 ↑ ¥ 100 (+33.3%) / 前月同期比 ↓ ¥ 50 (-4.8%)" format.
+// The month-over-month change is omitted unless monthly is true.
+func (r *Cost) comparison(currency *Currency, catalog *Catalog, monthly bool) string {
+	dayOverDay := fmt.Sprintf("%s %s", catalog.DayOverDayLabel, formatChange(r.DayOverDay(), r.DayBeforeYesterday, currency))
+	if !monthly {
+		return dayOverDay
+	}
+	return fmt.Sprintf("%s / %s %s",
+		dayOverDay, catalog.MonthOverMonthLabel, formatChange(r.MonthOverMonth(), r.PreviousMonthly, currency),
+	)
+}
+
+// formatChange displays a change of the cost with an arrow,
+// and the percentage to the base cost unless the base is 0.
+func formatChange(change float32, base float32, currency *Currency) string {
+	arrow := "→"
+	amount := change
+	if change > 0 {
+		arrow = "↑"
+	} else if change < 0 {
+		arrow = "↓"
+		amount = -change
+	}
+	text := arrow + " " + currency.Format(amount)
+	if base != 0 {
+		text += fmt.Sprintf(" (%+.1f%%)", change/float32(math.Abs(float64(base)))*100)
+	}
+	return text
+}
+
+func (r *Cost) hasCredits() bool {
+	return r.MonthlyCredits != 0 || r.YesterdayCredits != 0
+}
+
+func (r *Cost) creditsMessageLine(currency *Currency, catalog *Catalog) string {
+	return costLine(catalog.Credits, r.MonthlyCredits, r.YesterdayCredits, currency)
+}
+
+// SKUCost contains the SKU description, monthly sum of the cost,
+// and the cost on the most recent date.
+type SKUCost struct {
+	SKU       string
+	Monthly   float32
+	Yesterday float32
+}
+
+func (s *SKUCost) asMessageLine(currency *Currency) string {
+	return costLine(s.SKU, s.Monthly, s.Yesterday, currency)
+}
+
+func newCost(result *db.QueryResult) *Cost {
+	return &Cost{
+		Service:          result.Service,
+		Monthly:          result.Monthly,
+		Yesterday:        result.Yesterday,
+		MonthlyCredits:   result.MonthlyCredits,
+		YesterdayCredits: result.YesterdayCredits,
+
+		DayBeforeYesterday: result.DayBeforeYesterday,
+		PreviousMonthly:    result.PreviousMonthly,
+	}
+}
+
+func (r *Cost) asMessageLine(currency *Currency) string {
+	return costLine(r.Service, r.Monthly, r.Yesterday, currency)
+}
+
+// asComparedMessageLine displays the cost followed by the changes
+// from the day before and the previous month.
+func (r *Cost) asComparedMessageLine(currency *Currency, catalog *Catalog, monthly bool) string {
+	return r.asMessageLine(currency) + " | " + r.comparison(currency, catalog, monthly)
+}
+
+// ProjectCost contains the project ID and name, monthly sum of the cost,
+// the cost on the most recent date,
+// and the costs for each service in the project if broken down.
+type ProjectCost struct {
+	Project   string
+	Name      string
+	Monthly   float32
+	Yesterday float32
+	Services  []*Cost
+
+	MonthlyCredits   float32
+	YesterdayCredits float32
+}
+
+// DisplayName displays the project in the "name (id)" format,
+// or only the ID if the name is unknown or the same as the ID.
+func (p *ProjectCost) DisplayName() string {
+	if p.Name == "" || p.Name == p.Project {
+		return p.Project
+	}
+	return fmt.Sprintf("%s (%s)", p.Name, p.Project)
+}
+
+func (p *ProjectCost) asMessageLines(currency *Currency) []string {
+	lines := []string{costLine(p.DisplayName(), p.Monthly, p.Yesterday, currency)}
+	for _, cost := range p.Services {
+		lines = append(lines, "  - "+cost.asMessageLine(currency))
+	}
+	return lines
 }
 
-func (r *Cost) asMessageLine() string {
-	service := r.Service
-	monthly := humanize.CommafWithDigits(float64(r.Monthly), 2)
-	yesterday := humanize.CommafWithDigits(float64(r.Yesterday), 2)
+// LabelCost contains a resource label key and value, monthly sum of the cost,
+// and the cost on the most recent date.
+//
+// The cost of resources without the label has an empty Value.
+type LabelCost struct {
+	Key       string
+	Value     string
+	Monthly   float32
+	Yesterday float32
+}
+
+func (l *LabelCost) asMessageLine(currency *Currency, catalog *Catalog) string {
+	value := l.Value
+	if value == "" {
+		value = catalog.UnlabelledValue
+	}
+	return costLine(value, l.Monthly, l.Yesterday, currency)
+}
+
+// CreditCost contains the credit type (e.g. SUSTAINED_USAGE_DISCOUNT),
+// monthly sum of the credits, and the credits on the most recent date.
+type CreditCost struct {
+	Type      string
+	Monthly   float32
+	Yesterday float32
+}
 
-	return fmt.Sprintf("%s: ¥ %s (¥ %s)", service, monthly, yesterday)
+func (c *CreditCost) asMessageLine(currency *Currency) string {
+	return costLine(c.Type, c.Monthly, c.Yesterday, currency)
 }
 
 // Invoice contains the data of the cost aggregation period,
-// the total cost, and costs for each service.
+// the total cost, costs for each service, costs for each project,
+// costs for each value of resource labels, and credits for each type.
+//
+// Projects, Labels and Credits are nil unless the costs are broken down by them.
+// Anomalies is nil unless the anomaly detection finds unusual daily costs.
+// Forecast is nil unless the month-end costs are forecasted.
+// Budgets is nil unless the costs are evaluated against budgets.
+//
+// Currency is the currency code of the costs (DefaultCurrency if empty), and
+// CurrencyConversionRate is the exchange rate from USD to the currency.
+//
+// Language selects the message catalog (DefaultLanguage if empty).
+//
+// LastExportTime is the time the billing data was last exported to BigQuery (zero if unknown).
 type Invoice struct {
 	BillingPeriod BillingPeriod
 	Total         *Cost
 	Services      []*Cost
+	Projects      []*ProjectCost
+	Labels        []*LabelCost
+	Credits       []*CreditCost
+	Anomalies     []*analysis.Anomaly
+	Forecast      *analysis.Forecast
+	Budgets       []*BudgetStatus
+
+	Currency               string
+	CurrencyConversionRate float64
+
+	Language       string
+	LastExportTime time.Time
+
+	message string // Message rendered by a MessageTemplate
 }
 
 // NewInvoice constructs a new Invoice from cost reporting period and BigQuery Results.
@@ -65,6 +280,16 @@ type Invoice struct {
 // If it is not, an error is returned.
 //
 // If the BQ result is empty, the new Invoice has 0 total cost and empty service costs.
+//
+// The currency of the costs is taken from the total cost.
+//
+// Results with a project ID are aggregated into project costs.
+// When they also have a service name, the service costs are nested under the project,
+// and the projects are sorted in descending order of the monthly cost.
+//
+// Results with a label key are kept as label costs in the order of the results.
+// Results with a SKU are nested under the service cost of the same name.
+// Results with a credit type are kept as credit costs.
 func NewInvoice(period *datetime.ReportingPeriod, queryResults []*db.QueryResult) (*Invoice, *utils.CustomError) {
 
 	billingPeriod := BillingPeriod{
@@ -72,8 +297,14 @@ func NewInvoice(period *datetime.ReportingPeriod, queryResults []*db.QueryResult
 		To:   period.To,
 	}
 
+	var currency string
+	var currencyConversionRate float64
+	var lastExportTime time.Time
 	var totalCost *Cost
 	serviceCosts := []*Cost{}
+	var projectCosts []*ProjectCost
+	var labelCosts []*LabelCost
+	var creditCosts []*CreditCost
 
 	if len(queryResults) == 0 {
 		totalCost = &Cost{Service: "Total", Monthly: 0.00, Yesterday: 0.00}
@@ -86,38 +317,365 @@ func NewInvoice(period *datetime.ReportingPeriod, queryResults []*db.QueryResult
 				fmt.Errorf("First element of the query results was %s, not Total", firstElement.Service),
 			)
 		}
-		totalCost = (*Cost)(firstElement)
+		currency = firstElement.Currency
+		currencyConversionRate = firstElement.CurrencyConversionRate
+		if firstElement.LastExportTime.Unix() > 0 {
+			lastExportTime = firstElement.LastExportTime
+		}
+		totalCost = newCost(firstElement)
 		for _, res := range queryResults[1:] {
-			serviceCosts = append(serviceCosts, (*Cost)(res))
+			switch {
+			case res.CreditType != "":
+				creditCosts = append(creditCosts, &CreditCost{
+					Type:      res.CreditType,
+					Monthly:   res.Monthly,
+					Yesterday: res.Yesterday,
+				})
+			case res.LabelKey != "":
+				labelCosts = append(labelCosts, &LabelCost{
+					Key:       res.LabelKey,
+					Value:     res.LabelValue,
+					Monthly:   res.Monthly,
+					Yesterday: res.Yesterday,
+				})
+			case res.SKU != "":
+				addSKUCost(serviceCosts, res)
+			case res.Project != "":
+				projectCosts = addProjectCost(projectCosts, res)
+			default:
+				serviceCosts = append(serviceCosts, newCost(res))
+			}
 		}
+		sort.SliceStable(projectCosts, func(i, j int) bool {
+			return projectCosts[i].Monthly > projectCosts[j].Monthly
+		})
 	}
 	return &Invoice{
 		BillingPeriod: billingPeriod,
 		Total:         totalCost,
 		Services:      serviceCosts,
+		Projects:      projectCosts,
+		Labels:        labelCosts,
+		Credits:       creditCosts,
+
+		Currency:               currency,
+		CurrencyConversionRate: currencyConversionRate,
+		LastExportTime:         lastExportTime,
 	}, nil
 
 }
 
+func addProjectCost(projectCosts []*ProjectCost, result *db.QueryResult) []*ProjectCost {
+	var projectCost *ProjectCost
+	for _, p := range projectCosts {
+		if p.Project == result.Project {
+			projectCost = p
+			break
+		}
+	}
+	if projectCost == nil {
+		projectCost = &ProjectCost{Project: result.Project, Name: result.ProjectName}
+		projectCosts = append(projectCosts, projectCost)
+	}
+
+	projectCost.Monthly += result.Monthly
+	projectCost.Yesterday += result.Yesterday
+	projectCost.MonthlyCredits += result.MonthlyCredits
+	projectCost.YesterdayCredits += result.YesterdayCredits
+	if result.Service != "" {
+		projectCost.Services = append(projectCost.Services, newCost(result))
+	}
+	return projectCosts
+}
+
+func addSKUCost(serviceCosts []*Cost, result *db.QueryResult) {
+	for _, cost := range serviceCosts {
+		if cost.Service == result.Service {
+			cost.SKUs = append(cost.SKUs, &SKUCost{
+				SKU:       result.SKU,
+				Monthly:   result.Monthly,
+				Yesterday: result.Yesterday,
+			})
+			return
+		}
+	}
+	log.Printf("SKU cost of unlisted service is ignored: %v", result)
+}
+
+// scale multiplies all the costs in the Invoice by the rate.
+func (b *Invoice) scale(rate float32) {
+	scaleCost := func(cost *Cost) {
+		cost.Monthly *= rate
+		cost.Yesterday *= rate
+		cost.MonthlyCredits *= rate
+		cost.YesterdayCredits *= rate
+		cost.DayBeforeYesterday *= rate
+		cost.PreviousMonthly *= rate
+		for _, sku := range cost.SKUs {
+			sku.Monthly *= rate
+			sku.Yesterday *= rate
+		}
+	}
+
+	scaleCost(b.Total)
+	for _, cost := range b.Services {
+		scaleCost(cost)
+	}
+	for _, project := range b.Projects {
+		project.Monthly *= rate
+		project.Yesterday *= rate
+		project.MonthlyCredits *= rate
+		project.YesterdayCredits *= rate
+		for _, cost := range project.Services {
+			scaleCost(cost)
+		}
+	}
+	for _, label := range b.Labels {
+		label.Monthly *= rate
+		label.Yesterday *= rate
+	}
+	for _, credit := range b.Credits {
+		credit.Monthly *= rate
+		credit.Yesterday *= rate
+	}
+	for _, anomaly := range b.Anomalies {
+		anomaly.Cost *= rate
+		anomaly.Baseline *= rate
+	}
+	if b.Forecast != nil {
+		b.Forecast.Total *= rate
+		for _, service := range b.Forecast.Services {
+			service.Amount *= rate
+		}
+	}
+}
+
+func (b *Invoice) currency() *Currency {
+	return LookupCurrency(b.Currency)
+}
+
+func (b *Invoice) catalog() *Catalog {
+	return LookupCatalog(b.Language)
+}
+
+// Catalog returns the message catalog in the language of the Invoice.
+func (b *Invoice) Catalog() *Catalog {
+	return b.catalog()
+}
+
+// FormatMoney displays an amount in the currency of the Invoice (e.g. "¥ 1,000.07").
+func (b *Invoice) FormatMoney(amount float32) string {
+	return b.currency().Format(amount)
+}
+
+// HasCustomMessage reports whether the message of the Invoice is rendered by a MessageTemplate.
+func (b *Invoice) HasCustomMessage() bool {
+	return b.message != ""
+}
+
+// HasComparison reports whether the costs to compare with are available.
+func (b *Invoice) HasComparison() bool {
+	return b.Total.hasComparison(b.HasMonthComparison())
+}
+
+// HasMonthComparison reports whether the costs are compared with the same period of the previous month,
+// which is only done for month-to-date and full-month periods.
+func (b *Invoice) HasMonthComparison() bool {
+	return b.BillingPeriod.IsMonthToDate()
+}
+
 func (b *Invoice) details() string {
+	currency := b.currency()
+	catalog := b.catalog()
 	serviceCosts := b.Services
 	var listOfLines []string
 	for _, cost := range serviceCosts {
-		listOfLines = append(listOfLines, cost.asMessageLine())
+		if b.HasComparison() {
+			listOfLines = append(listOfLines, cost.asComparedMessageLine(currency, catalog, b.HasMonthComparison()))
+		} else {
+			listOfLines = append(listOfLines, cost.asMessageLine(currency))
+		}
+		for _, sku := range cost.SKUs {
+			listOfLines = append(listOfLines, "  - "+sku.asMessageLine(currency))
+		}
+	}
+	return strings.Join(listOfLines, "\n")
+}
+
+func (b *Invoice) projectDetails() string {
+	var listOfLines []string
+	currency := b.currency()
+	for _, cost := range b.Projects {
+		listOfLines = append(listOfLines, cost.asMessageLines(currency)...)
+	}
+	return strings.Join(listOfLines, "\n")
+}
+
+func (b *Invoice) labelDetails() string {
+	currency := b.currency()
+	catalog := b.catalog()
+	var listOfLines []string
+	for i, cost := range b.Labels {
+		if i == 0 || cost.Key != b.Labels[i-1].Key {
+			if i > 0 {
+				listOfLines = append(listOfLines, "")
+			}
+			listOfLines = append(listOfLines, fmt.Sprintf(catalog.LabelsHeader, cost.Key))
+		}
+		listOfLines = append(listOfLines, cost.asMessageLine(currency, catalog))
 	}
 	return strings.Join(listOfLines, "\n")
 }
 
 // AsMessage creates a notification message of GCP costs from Invoice.
+//
+// If a MessageTemplate is applied to the Invoice, the rendered message is returned.
 func (b *Invoice) AsMessage() string {
+	if b.message != "" {
+		return b.message
+	}
+	return b.defaultMessage()
+}
+
+func (b *Invoice) defaultMessage() string {
+	message := b.SummaryMessage()
+	if breakdown := b.BreakdownMessage(); breakdown != "" {
+		message += "\n\n" + breakdown
+	}
+	return message
+}
 
-	message := fmt.Sprintf("＜%s の GCP 利用料金＞ ※ () 内は前日分\n\n", &b.BillingPeriod)
-	message += b.Total.asMessageLine()
+// SummaryMessage creates the first part of the default message:
+// the title with the billing period, the total cost, the budgets and the anomalies if any.
+//
+// If a budget threshold is first crossed on this run, the message starts with the alert.
+func (b *Invoice) SummaryMessage() string {
+	currency := b.currency()
+	catalog := b.catalog()
 
-	if len(b.Services) > 0 {
-		message += "\n\n" + "----- 内訳 -----" + "\n"
-		message += b.details()
+	message := ""
+	if b.HasBudgetAlert() {
+		message += b.budgetAlertSection().String() + "\n\n"
+	}
+	message += fmt.Sprintf(catalog.Title, b.BillingPeriod.Format(catalog)) + "\n\n"
+	message += costLine(catalog.Total, b.Total.Monthly, b.Total.Yesterday, currency)
+	if b.HasComparison() {
+		message += " | " + b.Total.comparison(currency, catalog, b.HasMonthComparison())
+	}
+	if b.Forecast != nil {
+		message += fmt.Sprintf(" | %s: %s", catalog.ForecastLabel, currency.Format(b.Forecast.Total))
+	}
+
+	if b.Total.hasCredits() || len(b.Credits) > 0 {
+		message += "\n" + b.Total.creditsMessageLine(currency, catalog)
+		for _, credit := range b.Credits {
+			message += "\n  - " + credit.asMessageLine(currency)
+		}
+	}
+
+	if len(b.Budgets) > 0 {
+		message += "\n\n" + b.budgetSection().String()
 	}
 
+	if len(b.Anomalies) > 0 {
+		message += "\n\n" + b.anomalySection().String()
+	}
 	return message
 }
+
+// MessageItem is a line of a MessageSection shown as "Name: Value".
+type MessageItem struct {
+	Name  string
+	Value string
+}
+
+// MessageSection is a part of the message with a header and the items under it.
+type MessageSection struct {
+	Header string
+	Items  []MessageItem
+}
+
+func (s *MessageSection) String() string {
+	lines := []string{s.Header}
+	for _, item := range s.Items {
+		lines = append(lines, item.Name+": "+item.Value)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Highlights returns the sections besides the costs in the order of the default message:
+// the budget thresholds crossed on this run, the budgets, the anomalies and the month-end forecast.
+// The sections without items are omitted.
+//
+// The forecast section starts with the forecast of the total.
+func (b *Invoice) Highlights() []*MessageSection {
+	var sections []*MessageSection
+	if b.HasBudgetAlert() {
+		sections = append(sections, b.budgetAlertSection())
+	}
+	if len(b.Budgets) > 0 {
+		sections = append(sections, b.budgetSection())
+	}
+	if len(b.Anomalies) > 0 {
+		sections = append(sections, b.anomalySection())
+	}
+	if b.Forecast != nil {
+		section := b.forecastSection()
+		section.Items = append([]MessageItem{{Name: b.catalog().Total, Value: b.currency().Format(b.Forecast.Total)}}, section.Items...)
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+func (b *Invoice) anomalySection() *MessageSection {
+	currency := b.currency()
+	catalog := b.catalog()
+	section := &MessageSection{Header: catalog.AnomaliesHeader}
+	for _, anomaly := range b.Anomalies {
+		arrow := "↑"
+		if anomaly.Direction < 0 {
+			arrow = "↓"
+		}
+		section.Items = append(section.Items, MessageItem{
+			Name: anomaly.Service,
+			Value: fmt.Sprintf("%s %s (%s)", currency.Format(anomaly.Cost), arrow,
+				fmt.Sprintf(catalog.UsualCost, currency.Format(anomaly.Baseline))),
+		})
+	}
+	return section
+}
+
+func (b *Invoice) forecastSection() *MessageSection {
+	currency := b.currency()
+	section := &MessageSection{Header: b.catalog().ForecastHeader}
+	for _, service := range b.Forecast.Services {
+		section.Items = append(section.Items, MessageItem{Name: service.Service, Value: currency.Format(service.Amount)})
+	}
+	return section
+}
+
+// BreakdownMessage creates the rest of the default message:
+// the costs for each service, project and label, and the forecast for each service.
+// It is empty if the costs are not broken down.
+func (b *Invoice) BreakdownMessage() string {
+	catalog := b.catalog()
+
+	var sections []string
+	if len(b.Services) > 0 {
+		sections = append(sections, catalog.DetailsHeader+"\n"+b.details())
+	}
+
+	if len(b.Projects) > 0 {
+		sections = append(sections, catalog.ProjectsHeader+"\n"+b.projectDetails())
+	}
+
+	if len(b.Labels) > 0 {
+		sections = append(sections, b.labelDetails())
+	}
+
+	if b.Forecast != nil && len(b.Forecast.Services) > 0 {
+		sections = append(sections, b.forecastSection().String())
+	}
+
+	return strings.Join(sections, "\n\n")
+}
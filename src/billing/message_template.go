@@ -0,0 +1,121 @@
+package billing
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"text/template"
+
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func newMessageTemplateError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Message Template Rendering",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// MessageTemplate is an object to render the notification message of an Invoice
+// with a user-provided text/template.
+//
+// The template receives the Invoice as its data and can use the following functions:
+//
+// `money` ... formats an amount in the currency of the Invoice (e.g. `{{money .Total.Monthly}}` -> "¥ 1,000.07").
+//
+// `percent` ... formats the ratio of two amounts in percentage (e.g. `{{percent .Monthly $.Total.Monthly}}` -> "33.3%").
+//
+// `period` ... formats the billing period in the language of the Invoice (e.g. "5/1 ~ 5/8").
+//
+// `default` ... the default message of the Invoice.
+//
+// The budgets, the anomalies and the forecast are available as `.Highlights`,
+// the sections with `.Header` and `.Items` (`.Name` and `.Value`),
+// and `.HasBudgetAlert` reports whether a budget threshold is first crossed on this run.
+type MessageTemplate struct {
+	template *template.Template
+}
+
+// NewMessageTemplate constructs a MessageTemplate from the template file
+// designated in the environment variable `MESSAGE_TEMPLATE_FILE`.
+// A relative path is resolved under `FILE_DIRECTORY` in the same way as the query template.
+//
+// If the variable is empty, the MessageTemplate does nothing
+// and the default message of the Invoice is sent.
+func NewMessageTemplate() (MessageTemplate, *utils.CustomError) {
+	settings := config.FromEnv()
+	return NewMessageTemplateWith(settings.Message, settings.Query.FileDirectory)
+}
+
+// NewMessageTemplateWith constructs a MessageTemplate from the template file in the settings of a report.
+// A relative path is resolved under the file directory.
+func NewMessageTemplateWith(settings config.Message, fileDirectory string) (MessageTemplate, *utils.CustomError) {
+	templatePath := settings.TemplateFile
+	if templatePath == "" {
+		return MessageTemplate{}, nil
+	}
+	if !filepath.IsAbs(templatePath) {
+		templatePath = "./" + fileDirectory + templatePath
+	}
+
+	content, err := ioutil.ReadFile(templatePath)
+	if err != nil {
+		return MessageTemplate{}, newMessageTemplateError("Could not read the message template file!", err)
+	}
+	return ParseMessageTemplate(filepath.Base(templatePath), string(content))
+}
+
+// ParseMessageTemplate constructs a MessageTemplate from the template text.
+func ParseMessageTemplate(name string, text string) (MessageTemplate, *utils.CustomError) {
+	t, err := template.New(name).Funcs(templateFuncs(&Invoice{})).Parse(text)
+	if err != nil {
+		return MessageTemplate{}, newMessageTemplateError("Invalid message template!", err)
+	}
+	return MessageTemplate{template: t}, nil
+}
+
+// Apply method renders the message of the Invoice with the template
+// and makes the Invoice send the rendered message instead of the default one.
+func (t *MessageTemplate) Apply(invoice *Invoice) *utils.CustomError {
+	if t.template == nil {
+		return nil
+	}
+
+	tmpl, err := t.template.Clone()
+	if err != nil {
+		return newMessageTemplateError("Could not prepare the message template!", err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Funcs(templateFuncs(invoice)).Execute(&buf, invoice)
+	if err != nil {
+		return newMessageTemplateError("Failed in rendering the message template!", err)
+	}
+	invoice.message = buf.String()
+	return nil
+}
+
+func templateFuncs(invoice *Invoice) template.FuncMap {
+	return template.FuncMap{
+		"money": func(amount float32) string {
+			return invoice.currency().Format(amount)
+		},
+		"percent": formatPercent,
+		"period": func() string {
+			return invoice.BillingPeriod.Format(invoice.catalog())
+		},
+		"default": invoice.defaultMessage,
+	}
+}
+
+// formatPercent displays the ratio of the part to the whole in percentage
+// with 1 decimal place, or "-" if the whole is 0.
+func formatPercent(part float32, whole float32) string {
+	if whole == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(part/whole*100), 'f', 1, 32) + "%"
+}
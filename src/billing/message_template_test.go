@@ -0,0 +1,111 @@
+package billing
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var templateInputInvoice = &Invoice{
+	BillingPeriod: BillingPeriod{
+		From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+		To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+	},
+	Total: &Cost{Service: "Total", Monthly: 1500.0, Yesterday: 400.0},
+	Services: []*Cost{
+		{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0},
+		{Service: "BigQuery", Monthly: 500.0, Yesterday: 0.0},
+	},
+}
+
+func TestRenderMessageWithTemplate(t *testing.T) {
+	inputInvoice := *templateInputInvoice
+	messageTemplate, err := ParseMessageTemplate("test",
+		`GCP {{period}}: {{money .Total.Monthly}}
+{{range .Services}}* {{.Service}} {{money .Monthly}} ({{percent .Monthly $.Total.Monthly}})
+{{end}}`)
+	assert.Nil(t, err)
+
+	err = messageTemplate.Apply(&inputInvoice)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t,
+		"GCP 5/1 ~ 5/8: ¥ 1,500\n* Cloud SQL ¥ 1,000 (66.7%)\n* BigQuery ¥ 500 (33.3%)\n",
+		inputInvoice.AsMessage(),
+	)
+}
+
+func TestRenderDefaultMessageInTemplate(t *testing.T) {
+	inputInvoice := *templateInputInvoice
+	messageTemplate, _ := ParseMessageTemplate("test", "Daily report\n{{default}}")
+
+	err := messageTemplate.Apply(&inputInvoice)
+
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(inputInvoice.AsMessage(), "Daily report\n＜5/1 ~ 5/8 の GCP 利用料金＞"), inputInvoice.AsMessage())
+}
+
+func TestRenderHighlightsInTemplate(t *testing.T) {
+	inputInvoice := *templateInputInvoice
+	inputInvoice.Budgets = []*BudgetStatus{
+		{Budget: Budget{Scope: BudgetScopeTotal, Amount: 1600.0}, Spent: 1500.0, Percent: 93.75, Reached: 80, Crossed: 80},
+	}
+	messageTemplate, _ := ParseMessageTemplate("test",
+		`{{if .HasBudgetAlert}}ALERT {{end}}{{money .Total.Monthly}}
+{{range .Highlights}}{{.Header}}
+{{range .Items}}- {{.Name}}: {{.Value}}
+{{end}}{{end}}`)
+
+	err := messageTemplate.Apply(&inputInvoice)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t,
+		"ALERT ¥ 1,500\n🚨 ----- 予算アラート -----\n- Total: 予算の 80% を超えました (¥ 1,500 / ¥ 1,600, 93.8%)\n----- 予算 -----\n- Total: ¥ 1,500 / ¥ 1,600 (93.8%) 🟠\n",
+		inputInvoice.AsMessage(),
+	)
+}
+
+func TestKeepDefaultMessageWithoutTemplate(t *testing.T) {
+	inputInvoice := *templateInputInvoice
+	messageTemplate := MessageTemplate{}
+
+	err := messageTemplate.Apply(&inputInvoice)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, inputInvoice.defaultMessage(), inputInvoice.AsMessage())
+}
+
+func TestReturnErrorWhenTemplateIsInvalid(t *testing.T) {
+	_, err := ParseMessageTemplate("test", "{{range .Services}}")
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Message Template Rendering. Invalid message template!"), err)
+}
+
+func TestReturnErrorWhenTemplateFailsInExecution(t *testing.T) {
+	inputInvoice := *templateInputInvoice
+	messageTemplate, _ := ParseMessageTemplate("test", "{{.Unknown}}")
+
+	err := messageTemplate.Apply(&inputInvoice)
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Message Template Rendering. Failed in rendering the message template!"), err)
+}
+
+func TestReturnErrorWhenTemplateFileDoesNotExist(t *testing.T) {
+	os.Setenv("MESSAGE_TEMPLATE_FILE", "/no/such/template.tmpl")
+	defer os.Unsetenv("MESSAGE_TEMPLATE_FILE")
+
+	_, err := NewMessageTemplate()
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Message Template Rendering. Could not read the message template file!"), err)
+}
+
+func TestFormatPercent(t *testing.T) {
+	assert.EqualValues(t, "25.0%", formatPercent(1, 4))
+	assert.EqualValues(t, "-", formatPercent(1, 0))
+}
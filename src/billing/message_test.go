@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/analysis"
 )
 
 func ExampleBillingPeriod_String() {
@@ -23,7 +24,7 @@ func TestCreateSingleMessageLine(t *testing.T) {
 		Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0,
 	}
 	expectedLine := "Cloud SQL: ¥ 1,000 (¥ 400)"
-	actualLine := sampleCost.asMessageLine()
+	actualLine := sampleCost.asMessageLine(LookupCurrency("JPY"))
 
 	assert.EqualValues(t, expectedLine, actualLine)
 }
@@ -103,3 +104,309 @@ Total: ¥ 0 (¥ 0)`
 	actualMessage := inputInvoice.AsMessage()
 	assert.EqualValues(t, expectedMessage, actualMessage)
 }
+
+func TestCreateMessageWithProjectBreakdown(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total:    &Cost{Service: "Total", Monthly: 1300.0, Yesterday: 500.0},
+		Services: []*Cost{},
+		Projects: []*ProjectCost{
+			{
+				Project: "project-b", Name: "Project B", Monthly: 700.0, Yesterday: 300.0,
+				Services: []*Cost{
+					{Service: "BigQuery", Monthly: 400.0, Yesterday: 100.0},
+					{Service: "Cloud Run", Monthly: 300.0, Yesterday: 200.0},
+				},
+			},
+			{Project: "project-a", Name: "project-a", Monthly: 600.0, Yesterday: 200.0},
+		},
+	}
+
+	expectedMessage :=
+		`＜5/1 ~ 5/8 の GCP 利用料金＞ ※ () 内は前日分
+
+Total: ¥ 1,300 (¥ 500)
+
+----- プロジェクト別 -----
+Project B (project-b): ¥ 700 (¥ 300)
+  - BigQuery: ¥ 400 (¥ 100)
+  - Cloud Run: ¥ 300 (¥ 200)
+project-a: ¥ 600 (¥ 200)`
+
+	actualMessage := inputInvoice.AsMessage()
+	assert.EqualValues(t, expectedMessage, actualMessage)
+}
+
+func TestCreateMessageWithLabelBreakdown(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total:    &Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		Services: []*Cost{},
+		Labels: []*LabelCost{
+			{Key: "team", Value: "backend", Monthly: 1000.0, Yesterday: 400.0},
+			{Key: "team", Value: "", Monthly: 0.07, Yesterday: 0.0},
+			{Key: "env", Value: "prod", Monthly: 1000.07, Yesterday: 400.0},
+		},
+	}
+
+	expectedMessage :=
+		`＜5/1 ~ 5/8 の GCP 利用料金＞ ※ () 内は前日分
+
+Total: ¥ 1,000.07 (¥ 400)
+
+----- ラベル別 (team) -----
+backend: ¥ 1,000 (¥ 400)
+(ラベルなし): ¥ 0.07 (¥ 0)
+
+----- ラベル別 (env) -----
+prod: ¥ 1,000.07 (¥ 400)`
+
+	actualMessage := inputInvoice.AsMessage()
+	assert.EqualValues(t, expectedMessage, actualMessage)
+}
+
+func TestDescribeSKUDetailsUnderServices(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total: &Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		Services: []*Cost{
+			{
+				Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0,
+				SKUs: []*SKUCost{
+					{SKU: "vCPU", Monthly: 700.0, Yesterday: 300.0},
+					{SKU: "RAM", Monthly: 300.0, Yesterday: 100.0},
+				},
+			},
+			{Service: "BigQuery", Monthly: 0.07, Yesterday: 0.0},
+		},
+	}
+	expectedDetailLines := "Cloud SQL: ¥ 1,000 (¥ 400)\n  - vCPU: ¥ 700 (¥ 300)\n  - RAM: ¥ 300 (¥ 100)\nBigQuery: ¥ 0.07 (¥ 0)"
+
+	actualDetailLines := inputInvoice.details()
+	assert.EqualValues(t, expectedDetailLines, actualDetailLines)
+}
+
+func TestCreateMessageWithCredits(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total:    &Cost{Service: "Total", Monthly: 900.0, Yesterday: 300.0, MonthlyCredits: -100.0, YesterdayCredits: -20.0},
+		Services: []*Cost{},
+	}
+
+	expectedMessage :=
+		`＜5/1 ~ 5/8 の GCP 利用料金＞ ※ () 内は前日分
+
+Total: ¥ 900 (¥ 300)
+Credits: ¥ -100 (¥ -20)`
+
+	actualMessage := inputInvoice.AsMessage()
+	assert.EqualValues(t, expectedMessage, actualMessage)
+}
+
+func TestCreateMessageWithCreditBreakdown(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total:    &Cost{Service: "Total", Monthly: 900.0, Yesterday: 300.0, MonthlyCredits: -100.0, YesterdayCredits: -20.0},
+		Services: []*Cost{},
+		Credits: []*CreditCost{
+			{Type: "COMMITTED_USAGE_DISCOUNT", Monthly: -70.0, Yesterday: -10.0},
+			{Type: "SUSTAINED_USAGE_DISCOUNT", Monthly: -30.0, Yesterday: -10.0},
+		},
+	}
+
+	expectedMessage :=
+		`＜5/1 ~ 5/8 の GCP 利用料金＞ ※ () 内は前日分
+
+Total: ¥ 900 (¥ 300)
+Credits: ¥ -100 (¥ -20)
+  - COMMITTED_USAGE_DISCOUNT: ¥ -70 (¥ -10)
+  - SUSTAINED_USAGE_DISCOUNT: ¥ -30 (¥ -10)`
+
+	actualMessage := inputInvoice.AsMessage()
+	assert.EqualValues(t, expectedMessage, actualMessage)
+}
+
+func TestCreateMessageInBillingAccountCurrency(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total: &Cost{Service: "Total", Monthly: 1234.5, Yesterday: 400.0},
+		Services: []*Cost{
+			{Service: "Cloud SQL", Monthly: 1234.5, Yesterday: 400.0},
+		},
+		Currency: "USD",
+	}
+
+	expectedMessage :=
+		`＜5/1 ~ 5/8 の GCP 利用料金＞ ※ () 内は前日分
+
+Total: $ 1,234.5 ($ 400)
+
+----- 内訳 -----
+Cloud SQL: $ 1,234.5 ($ 400)`
+
+	actualMessage := inputInvoice.AsMessage()
+	assert.EqualValues(t, expectedMessage, actualMessage)
+}
+
+func ExampleInvoice_AsMessage_english() {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total: &Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		Services: []*Cost{
+			{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0},
+			{Service: "BigQuery", Monthly: 0.07, Yesterday: 0.0},
+		},
+		Labels: []*LabelCost{
+			{Key: "team", Value: "", Monthly: 1000.07, Yesterday: 400.0},
+		},
+		Language: "en",
+	}
+
+	fmt.Println(inputInvoice.AsMessage())
+	// Output:
+	// <GCP costs for May 1 - May 8> * Yesterday's costs in ()
+	//
+	// Total: ¥ 1,000.07 (¥ 400)
+	//
+	// ----- Breakdown -----
+	// Cloud SQL: ¥ 1,000 (¥ 400)
+	// BigQuery: ¥ 0.07 (¥ 0)
+	//
+	// ----- By label (team) -----
+	// (unlabelled): ¥ 1,000.07 (¥ 400)
+}
+
+func ExampleInvoice_AsMessage_comparison() {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total: &Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0, DayBeforeYesterday: 300.0, PreviousMonthly: 1050.07},
+		Services: []*Cost{
+			{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0, DayBeforeYesterday: 300.0, PreviousMonthly: 1050.0},
+			{Service: "BigQuery", Monthly: 0.07, Yesterday: 0.0, PreviousMonthly: 0.07},
+		},
+	}
+
+	fmt.Println(inputInvoice.AsMessage())
+	// Output:
+	// ＜5/1 ~ 5/8 の GCP 利用料金＞ ※ () 内は前日分
+	//
+	// Total: ¥ 1,000.07 (¥ 400) | 前日比 ↑ ¥ 100 (+33.3%) / 前月同期比 ↓ ¥ 50 (-4.8%)
+	//
+	// ----- 内訳 -----
+	// Cloud SQL: ¥ 1,000 (¥ 400) | 前日比 ↑ ¥ 100 (+33.3%) / 前月同期比 ↓ ¥ 50 (-4.8%)
+	// BigQuery: ¥ 0.07 (¥ 0) | 前日比 → ¥ 0 / 前月同期比 → ¥ 0 (+0.0%)
+}
+
+func TestOmitMonthOverMonthOutsideMonthToDate(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 2, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total: &Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0, DayBeforeYesterday: 300.0},
+		Services: []*Cost{
+			{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0, DayBeforeYesterday: 300.0},
+		},
+	}
+
+	assert.False(t, inputInvoice.HasMonthComparison())
+	assert.EqualValues(t, `＜5/2 ~ 5/8 の GCP 利用料金＞ ※ () 内は前日分
+
+Total: ¥ 1,000.07 (¥ 400) | 前日比 ↑ ¥ 100 (+33.3%)
+
+----- 内訳 -----
+Cloud SQL: ¥ 1,000 (¥ 400) | 前日比 ↑ ¥ 100 (+33.3%)`, inputInvoice.AsMessage())
+}
+
+func TestFormatChangeWithoutPercentageFromZero(t *testing.T) {
+	cost := &Cost{Service: "Cloud Run", Monthly: 100.0, Yesterday: 30.0}
+
+	assert.EqualValues(t, "↑ ¥ 30", formatChange(cost.DayOverDay(), cost.DayBeforeYesterday, LookupCurrency("JPY")))
+	assert.EqualValues(t, "↑ ¥ 100", formatChange(cost.MonthOverMonth(), cost.PreviousMonthly, LookupCurrency("JPY")))
+}
+
+func TestCreateMessageWithAnomalies(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total: &Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		Anomalies: []*analysis.Anomaly{
+			{Service: "Cloud SQL", Cost: 400.0, Baseline: 100.0, Direction: 1},
+			{Service: "BigQuery", Cost: 0.0, Baseline: 50.0, Direction: -1},
+		},
+		Language: "en",
+	}
+	expectedMessage := `<GCP costs for May 1 - May 8> * Yesterday's costs in ()
+
+Total: ¥ 1,000.07 (¥ 400)
+
+⚠️ ----- Anomalies -----
+Cloud SQL: ¥ 400 ↑ (usually ¥ 100)
+BigQuery: ¥ 0 ↓ (usually ¥ 50)`
+
+	assert.EqualValues(t, expectedMessage, inputInvoice.AsMessage())
+}
+
+func TestShowForecastNextToTotal(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total:    &Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		Forecast: &analysis.Forecast{Total: 4500.0},
+		Language: "en",
+	}
+	expectedMessage := "<GCP costs for May 1 - May 8> * Yesterday's costs in ()\n\nTotal: ¥ 1,000.07 (¥ 400) | forecast: ¥ 4,500"
+
+	assert.EqualValues(t, expectedMessage, inputInvoice.AsMessage())
+}
+
+func TestShowForecastOfServicesInBreakdown(t *testing.T) {
+	inputInvoice := &Invoice{
+		BillingPeriod: BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.Local),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.Local),
+		},
+		Total:    &Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		Services: []*Cost{{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0}},
+		Forecast: &analysis.Forecast{
+			Total:    4500.0,
+			Services: []*analysis.ServiceForecast{{Service: "Cloud SQL", Amount: 4500.0}},
+		},
+		Language: "en",
+	}
+	expectedBreakdown := `----- Breakdown -----
+Cloud SQL: ¥ 1,000 (¥ 400)
+
+----- Month-end forecast -----
+Cloud SQL: ¥ 4,500`
+
+	assert.EqualValues(t, expectedBreakdown, inputInvoice.BreakdownMessage())
+}
@@ -39,6 +39,20 @@ func TestCreateBillingsCorrectly(t *testing.T) {
 	assert.EqualValues(t, expectedInvoice, actualInvoice)
 }
 
+func TestCarryComparisonCostsOnCosts(t *testing.T) {
+	inputReportingPeriod := InputReportingPeriod
+	inputQueryResults := []*db.QueryResult{
+		{Service: "Total", Monthly: 1000.07, Yesterday: 400.0, DayBeforeYesterday: 300.0, PreviousMonthly: 1050.07},
+		{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0, DayBeforeYesterday: 300.0, PreviousMonthly: 1050.0},
+	}
+
+	actualInvoice, err := NewInvoice(&inputReportingPeriod, inputQueryResults)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, &Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0, DayBeforeYesterday: 300.0, PreviousMonthly: 1050.07}, actualInvoice.Total)
+	assert.EqualValues(t, &Cost{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0, DayBeforeYesterday: 300.0, PreviousMonthly: 1050.0}, actualInvoice.Services[0])
+}
+
 func TestBillingsFromEmptyQueryResultHasZeroTotalCost(t *testing.T) {
 	inputQueryResults := []*db.QueryResult{}
 
@@ -85,3 +99,145 @@ func TestNewBillingsReturnErrorWhenQueryResultsUnexpectedlyOrderd(t *testing.T)
 		err.Error(),
 	)
 }
+
+func TestCreateProjectCostsFromProjectGroupedQueryResults(t *testing.T) {
+	inputQueryResults := []*db.QueryResult{
+		{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		{Project: "project-a", ProjectName: "Project A", Monthly: 1000.0, Yesterday: 400.0},
+		{Project: "project-b", ProjectName: "Project B", Monthly: 0.07, Yesterday: 0.0},
+	}
+
+	actualInvoice, err := NewInvoice(&InputReportingPeriod, inputQueryResults)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, []*Cost{}, actualInvoice.Services)
+	assert.EqualValues(t,
+		[]*ProjectCost{
+			{Project: "project-a", Name: "Project A", Monthly: 1000.0, Yesterday: 400.0},
+			{Project: "project-b", Name: "Project B", Monthly: 0.07, Yesterday: 0.0},
+		},
+		actualInvoice.Projects,
+	)
+}
+
+func TestNestServiceCostsUnderProjectsAndSortProjectsByMonthlyCost(t *testing.T) {
+	inputQueryResults := []*db.QueryResult{
+		{Service: "Total", Monthly: 1300.0, Yesterday: 500.0},
+		{Service: "Cloud SQL", Project: "project-a", Monthly: 600.0, Yesterday: 200.0},
+		{Service: "BigQuery", Project: "project-b", Monthly: 400.0, Yesterday: 100.0},
+		{Service: "Cloud Run", Project: "project-b", Monthly: 300.0, Yesterday: 200.0},
+	}
+
+	actualInvoice, err := NewInvoice(&InputReportingPeriod, inputQueryResults)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t,
+		[]*ProjectCost{
+			{
+				Project: "project-b", Monthly: 700.0, Yesterday: 300.0,
+				Services: []*Cost{
+					{Service: "BigQuery", Monthly: 400.0, Yesterday: 100.0},
+					{Service: "Cloud Run", Monthly: 300.0, Yesterday: 200.0},
+				},
+			},
+			{
+				Project: "project-a", Monthly: 600.0, Yesterday: 200.0,
+				Services: []*Cost{
+					{Service: "Cloud SQL", Monthly: 600.0, Yesterday: 200.0},
+				},
+			},
+		},
+		actualInvoice.Projects,
+	)
+}
+
+func TestCreateLabelCostsFromLabelledQueryResults(t *testing.T) {
+	inputQueryResults := []*db.QueryResult{
+		{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0},
+		{LabelKey: "team", LabelValue: "backend", Monthly: 1000.0, Yesterday: 400.0},
+		{LabelKey: "team", LabelValue: "", Monthly: 0.07, Yesterday: 0.0},
+	}
+
+	actualInvoice, err := NewInvoice(&InputReportingPeriod, inputQueryResults)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t,
+		[]*Cost{{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0}},
+		actualInvoice.Services,
+	)
+	assert.EqualValues(t,
+		[]*LabelCost{
+			{Key: "team", Value: "backend", Monthly: 1000.0, Yesterday: 400.0},
+			{Key: "team", Value: "", Monthly: 0.07, Yesterday: 0.0},
+		},
+		actualInvoice.Labels,
+	)
+}
+
+func TestNestSKUCostsUnderServiceCosts(t *testing.T) {
+	inputQueryResults := []*db.QueryResult{
+		{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0},
+		{Service: "BigQuery", Monthly: 0.07, Yesterday: 0.0},
+		{Service: "Cloud SQL", SKU: "vCPU", Monthly: 700.0, Yesterday: 300.0},
+		{Service: "Cloud SQL", SKU: "RAM", Monthly: 300.0, Yesterday: 100.0},
+		{Service: "Cloud Run", SKU: "CPU", Monthly: 10.0, Yesterday: 1.0},
+	}
+
+	actualInvoice, err := NewInvoice(&InputReportingPeriod, inputQueryResults)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t,
+		[]*Cost{
+			{
+				Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0,
+				SKUs: []*SKUCost{
+					{SKU: "vCPU", Monthly: 700.0, Yesterday: 300.0},
+					{SKU: "RAM", Monthly: 300.0, Yesterday: 100.0},
+				},
+			},
+			{Service: "BigQuery", Monthly: 0.07, Yesterday: 0.0},
+		},
+		actualInvoice.Services,
+	)
+}
+
+func TestCreateCreditCostsFromCreditBreakdownResults(t *testing.T) {
+	inputQueryResults := []*db.QueryResult{
+		{Service: "Total", Monthly: 900.0, Yesterday: 300.0, MonthlyCredits: -100.0, YesterdayCredits: -20.0},
+		{Service: "Compute Engine", Monthly: 900.0, Yesterday: 300.0, MonthlyCredits: -100.0, YesterdayCredits: -20.0},
+		{CreditType: "COMMITTED_USAGE_DISCOUNT", Monthly: -70.0, Yesterday: -10.0, MonthlyCredits: -70.0, YesterdayCredits: -10.0},
+		{CreditType: "SUSTAINED_USAGE_DISCOUNT", Monthly: -30.0, Yesterday: -10.0, MonthlyCredits: -30.0, YesterdayCredits: -10.0},
+	}
+
+	actualInvoice, err := NewInvoice(&InputReportingPeriod, inputQueryResults)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1000.0, actualInvoice.Total.MonthlyGross())
+	assert.EqualValues(t, 320.0, actualInvoice.Total.YesterdayGross())
+	assert.EqualValues(t,
+		[]*Cost{{Service: "Compute Engine", Monthly: 900.0, Yesterday: 300.0, MonthlyCredits: -100.0, YesterdayCredits: -20.0}},
+		actualInvoice.Services,
+	)
+	assert.EqualValues(t,
+		[]*CreditCost{
+			{Type: "COMMITTED_USAGE_DISCOUNT", Monthly: -70.0, Yesterday: -10.0},
+			{Type: "SUSTAINED_USAGE_DISCOUNT", Monthly: -30.0, Yesterday: -10.0},
+		},
+		actualInvoice.Credits,
+	)
+}
+
+func TestCarryCurrencyOfTotalCostOnInvoice(t *testing.T) {
+	inputQueryResults := []*db.QueryResult{
+		{Service: "Total", Monthly: 10.0, Yesterday: 2.0, Currency: "USD", CurrencyConversionRate: 1.0},
+		{Service: "BigQuery", Monthly: 10.0, Yesterday: 2.0},
+	}
+
+	actualInvoice, err := NewInvoice(&InputReportingPeriod, inputQueryResults)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "USD", actualInvoice.Currency)
+	assert.EqualValues(t, 1.0, actualInvoice.CurrencyConversionRate)
+}
@@ -0,0 +1,625 @@
+// config package implements loading and validation of the settings
+// from a YAML or JSON file and environment variables.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+	"gopkg.in/yaml.v3"
+)
+
+func NewConfigError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Configuration",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// Config contains the settings of the components.
+//
+// The embedded Report is the default report.
+// If Reports are declared, they are run instead of the default
+// and the settings not set in them are inherited from the default.
+//
+// Each setting of the default can be overridden by the environment variable in its `env` tag.
+type Config struct {
+	Report   `yaml:",inline"`
+	TimeZone string   `yaml:"timezone" env:"TIMEZONE"` // IANA time zone (UTC if empty)
+	Reports  []Report `yaml:"reports"`
+
+	// reportKeys are the keys set in each of Reports in the file, e.g. "query.credit_breakdown".
+	reportKeys []map[string]bool
+}
+
+// Report contains the settings of a report sent to its destinations.
+type Report struct {
+	Name     string   `yaml:"name"`
+	BigQuery BigQuery `yaml:"bigquery"`
+	Query    Query    `yaml:"query"`
+	Period   string   `yaml:"period" env:"REPORTING_PERIOD"` // month_to_date (default), previous_month or last_7_days
+	Message  Message  `yaml:"message"`
+	Anomaly  Anomaly  `yaml:"anomaly"`
+	Forecast Forecast `yaml:"forecast"`
+	Budget   Budget   `yaml:"budget"`
+	Notifier Notifier `yaml:"notifier"`
+
+	Slack      Slack      `yaml:"slack"`
+	Teams      Teams      `yaml:"teams"`
+	GoogleChat GoogleChat `yaml:"google_chat"`
+	Discord    Discord    `yaml:"discord"`
+	Email      Email      `yaml:"email"`
+	Webhook    Webhook    `yaml:"webhook"`
+	PagerDuty  PagerDuty  `yaml:"pagerduty"`
+}
+
+// BigQuery identifies the table of the exported billing data.
+type BigQuery struct {
+	ProjectID   string `yaml:"project_id" env:"GCP_PROJECT"`
+	DatasetName string `yaml:"dataset_name" env:"DATASET_NAME"`
+	TableName   string `yaml:"table_name" env:"TABLE_NAME"`
+}
+
+// TableID returns the fully qualified ID of the table.
+func (b *BigQuery) TableID() string {
+	return fmt.Sprintf("%s.%s.%s", b.ProjectID, b.DatasetName, b.TableName)
+}
+
+// Query contains the settings of the cost aggregation.
+type Query struct {
+	FileDirectory   string   `yaml:"file_directory" env:"FILE_DIRECTORY"` // directory of the query templates
+	Grouping        string   `yaml:"grouping" env:"COST_GROUPING"`
+	LabelKeys       []string `yaml:"label_keys" env:"COST_LABEL_KEYS"`
+	SKUTopServices  int      `yaml:"sku_top_services" env:"SKU_TOP_SERVICES"`
+	SKUMinCost      float64  `yaml:"sku_min_cost" env:"SKU_MIN_COST"`
+	CreditBreakdown bool     `yaml:"credit_breakdown" env:"CREDIT_BREAKDOWN"`
+	CostBasis       string   `yaml:"cost_basis" env:"COST_BASIS"` // net (default) or gross
+	Filters         Filters  `yaml:"filters"`
+}
+
+// Filters narrow down the billing data to aggregate.
+// The costs matching all the filters are aggregated.
+type Filters struct {
+	Projects []string            `yaml:"projects" json:"projects"` // project IDs
+	Services []string            `yaml:"services" json:"services"` // service names (e.g. "BigQuery")
+	Labels   map[string][]string `yaml:"labels" json:"labels"`     // values for each resource label key
+}
+
+// Message contains the settings of the message contents.
+type Message struct {
+	Currency     string  `yaml:"currency" env:"REPORTING_CURRENCY"`           // currency code to report the costs in (billing currency if empty)
+	CurrencyRate float64 `yaml:"currency_rate" env:"REPORTING_CURRENCY_RATE"` // amount in the reporting currency per 1 unit of the billing currency
+	Language     string  `yaml:"language" env:"MESSAGE_LANGUAGE"`             // e.g. ja (default), en
+	TemplateFile string  `yaml:"template_file" env:"MESSAGE_TEMPLATE_FILE"`   // text/template file of the message
+}
+
+// Anomaly contains the settings of the anomaly detection.
+type Anomaly struct {
+	Method     string  `yaml:"method" env:"ANOMALY_DETECTION"` // mad or zscore (disabled if empty)
+	WindowDays int     `yaml:"window_days" env:"ANOMALY_WINDOW_DAYS"`
+	Threshold  float64 `yaml:"threshold" env:"ANOMALY_THRESHOLD"` // default for the method if 0
+	MinCost    float64 `yaml:"min_cost" env:"ANOMALY_MIN_COST"`
+}
+
+// Forecast contains the settings of the month-end forecast.
+type Forecast struct {
+	Method string `yaml:"method" env:"FORECAST_METHOD"` // linear or weekday (disabled if empty)
+}
+
+// Budget contains the settings of the budget evaluation.
+type Budget struct {
+	File        string `yaml:"file" env:"BUDGET_FILE"`                 // JSON file of the budgets (disabled if empty)
+	StateObject string `yaml:"state_object" env:"BUDGET_STATE_OBJECT"` // gs://bucket/object to keep the alerted thresholds
+}
+
+// Slack contains the settings of the Slack destination.
+// The Web API with the bot token is used instead of the webhook if the token is set.
+type Slack struct {
+	WebhookURL    string   `yaml:"webhook_url" env:"SLACK_WEBHOOK_URL"`
+	MessageFormat string   `yaml:"message_format" env:"SLACK_MESSAGE_FORMAT"`
+	BotToken      string   `yaml:"bot_token" env:"SLACK_BOT_TOKEN"`
+	Channels      []string `yaml:"channels" env:"SLACK_CHANNELS"`
+	SigningSecret string   `yaml:"signing_secret" env:"SLACK_SIGNING_SECRET"` // to verify the slash command requests
+	CommandTopic  string   `yaml:"command_topic" env:"SLACK_COMMAND_TOPIC"`   // Pub/Sub topic to run the slash commands
+}
+
+// Teams contains the settings of the Microsoft Teams destination.
+type Teams struct {
+	WebhookURL string `yaml:"webhook_url" env:"TEAMS_WEBHOOK_URL"`
+}
+
+// GoogleChat contains the settings of the Google Chat destination.
+type GoogleChat struct {
+	WebhookURL string `yaml:"webhook_url" env:"GOOGLE_CHAT_WEBHOOK_URL"`
+}
+
+// Discord contains the settings of the Discord destination.
+type Discord struct {
+	WebhookURL string `yaml:"webhook_url" env:"DISCORD_WEBHOOK_URL"`
+}
+
+// Email contains the settings of the email destination via an SMTP server.
+type Email struct {
+	Host     string   `yaml:"host" env:"SMTP_HOST"`
+	Port     int      `yaml:"port" env:"SMTP_PORT"` // 587 if 0
+	Username string   `yaml:"username" env:"SMTP_USERNAME"`
+	Password string   `yaml:"password" env:"SMTP_PASSWORD"`
+	From     string   `yaml:"from" env:"SMTP_FROM"`
+	To       []string `yaml:"to" env:"SMTP_TO"`
+	StartTLS *bool    `yaml:"starttls" env:"SMTP_STARTTLS"` // true if unset
+}
+
+// Webhook contains the settings of the generic webhook destination.
+type Webhook struct {
+	URL    string `yaml:"url" env:"WEBHOOK_URL"`
+	Secret string `yaml:"secret" env:"WEBHOOK_SECRET"` // to sign the body (unsigned if empty)
+}
+
+// PagerDuty contains the settings of the PagerDuty destination.
+type PagerDuty struct {
+	RoutingKey     string  `yaml:"routing_key" env:"PAGERDUTY_ROUTING_KEY"`
+	Severity       string  `yaml:"severity" env:"PAGERDUTY_SEVERITY"`
+	SpikeThreshold float64 `yaml:"spike_threshold" env:"SPIKE_THRESHOLD"` // total cost on the most recent date to alert above
+	SpikeRatio     float64 `yaml:"spike_ratio" env:"SPIKE_RATIO"`         // ratio to the daily average to alert above
+}
+
+// Notifier selects the destinations of the notification.
+type Notifier struct {
+	Destinations  []string `yaml:"destinations" env:"NOTIFIER"`
+	FailurePolicy string   `yaml:"failure_policy" env:"NOTIFIER_FAILURE_POLICY"`
+}
+
+// LabelKeyPattern matches the valid resource label keys.
+// Label keys must start with a lowercase letter and can contain
+// lowercase letters, numeric characters, underscores and dashes.
+var LabelKeyPattern = regexp.MustCompile(`^[\p{Ll}\p{Lo}][\p{Ll}\p{Lo}\p{N}_-]{0,62}$`)
+
+// Allowed values of the settings.
+// They are the same as the constants in the packages of the components.
+var (
+	groupings           = []string{"service", "project", "project_service"}
+	costBases           = []string{"net", "gross"}
+	periods             = []string{"month_to_date", "previous_month", "last_7_days"}
+	anomalyMethods      = []string{"mad", "zscore"}
+	forecastMethods     = []string{"linear", "weekday"}
+	messageFormats      = []string{"text", "blocks"}
+	failurePolicies     = []string{"all", "any"}
+	pagerDutySeverities = []string{"critical", "error", "warning", "info"}
+	destinations        = []string{"slack", "teams", "google_chat", "discord", "email", "webhook", "pagerduty"}
+)
+
+// defaultCommandTopic is the topic triggering the function in the Makefile.
+const defaultCommandTopic = "cost_notification"
+
+// minAnomalyWindowDays is the minimum number of days of the history for the anomaly detection.
+const minAnomalyWindowDays = 7
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// RegisterDestination adds the name of a destination
+// which can be selected in `notifier.destinations`.
+// It is called when a destination is registered in the notification package.
+func RegisterDestination(name string) {
+	for _, destination := range destinations {
+		if destination == name {
+			return
+		}
+	}
+	destinations = append(destinations, name)
+}
+
+// Load loads the settings from the file designated in the environment variable `CONFIG_FILE`
+// and overrides them with the environment variables.
+// A relative path is resolved under `FILE_DIRECTORY` in the same way as the query template.
+// Without the file, the settings are loaded only from the environment variables.
+//
+// All the invalid settings are reported at once in the returned error.
+func Load() (*Config, *utils.CustomError) {
+	var content []byte
+	configPath := os.Getenv("CONFIG_FILE")
+	if configPath != "" {
+		if !filepath.IsAbs(configPath) {
+			configPath = "./" + os.Getenv("FILE_DIRECTORY") + configPath
+		}
+		var err error
+		content, err = ioutil.ReadFile(configPath)
+		if err != nil {
+			return nil, NewConfigError("Could not read the config file!", err)
+		}
+	}
+	return Parse(content)
+}
+
+// FromEnv returns the settings of the default report only from the environment variables with the defaults.
+// Unlike Load, the settings are not validated and the invalid values are logged and left unset.
+//
+// It is used by the constructors of the components reading the environment variables.
+func FromEnv() Report {
+	var report Report
+	for _, problem := range overrideWithEnv(reflect.ValueOf(&report).Elem()) {
+		log.Printf("Invalid environment variable is ignored: %s", problem)
+	}
+	report.fillDefaults()
+	return report
+}
+
+// Parse parses the settings in YAML or JSON, overrides them with the environment variables,
+// fills the defaults and validates them.
+func Parse(content []byte) (*Config, *utils.CustomError) {
+	config := &Config{}
+	if len(bytes.TrimSpace(content)) > 0 {
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err := decoder.Decode(config)
+		if err != nil {
+			return nil, NewConfigError("Invalid config file!", err)
+		}
+
+		var document yaml.Node
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, NewConfigError("Invalid config file!", err)
+		}
+		config.reportKeys = reportKeys(&document)
+	}
+
+	problems := overrideWithEnv(reflect.ValueOf(config).Elem())
+	config.Report.fillDefaults()
+	problems = append(problems, config.problems()...)
+	if len(problems) > 0 {
+		return nil, NewConfigError("Invalid configuration!", fmt.Errorf("%s", strings.Join(problems, "; ")))
+	}
+	return config, nil
+}
+
+// overrideWithEnv sets the fields with the values of the environment variables in their `env` tags.
+// The list fields are set from comma-separated values.
+func overrideWithEnv(value reflect.Value) []string {
+	var problems []string
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Kind() == reflect.Struct {
+			problems = append(problems, overrideWithEnv(field)...)
+			continue
+		}
+
+		name := value.Type().Field(i).Tag.Get("env")
+		envValue := strings.TrimSpace(os.Getenv(name))
+		if name == "" || envValue == "" {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(envValue)
+		case reflect.Slice:
+			var items []string
+			for _, item := range strings.Split(envValue, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		case reflect.Int:
+			n, err := strconv.Atoi(envValue)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be an integer: '%s'", name, envValue))
+				continue
+			}
+			field.SetInt(int64(n))
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(envValue, 64)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be a number: '%s'", name, envValue))
+				continue
+			}
+			field.SetFloat(f)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(envValue)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be true or false: '%s'", name, envValue))
+				continue
+			}
+			field.SetBool(b)
+		case reflect.Ptr:
+			if field.Type().Elem().Kind() != reflect.Bool {
+				continue
+			}
+			b, err := strconv.ParseBool(envValue)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be true or false: '%s'", name, envValue))
+				continue
+			}
+			field.Set(reflect.ValueOf(&b))
+		}
+	}
+	return problems
+}
+
+func (r *Report) fillDefaults() {
+	if r.Query.Grouping == "" {
+		r.Query.Grouping = groupings[0]
+	}
+	if r.Query.CostBasis == "" {
+		r.Query.CostBasis = costBases[0]
+	}
+	if r.Period == "" {
+		r.Period = periods[0]
+	}
+	r.Message.Currency = strings.ToUpper(r.Message.Currency)
+	r.Anomaly.Method = strings.ToLower(r.Anomaly.Method)
+	r.Forecast.Method = strings.ToLower(r.Forecast.Method)
+	if r.Slack.MessageFormat == "" {
+		r.Slack.MessageFormat = messageFormats[0]
+	}
+	if r.Slack.CommandTopic == "" {
+		r.Slack.CommandTopic = defaultCommandTopic
+	}
+	if r.Email.Port == 0 {
+		r.Email.Port = 587
+	}
+	r.PagerDuty.Severity = strings.ToLower(r.PagerDuty.Severity)
+	if r.PagerDuty.Severity == "" {
+		r.PagerDuty.Severity = "warning"
+	}
+	if len(r.Notifier.Destinations) == 0 {
+		r.Notifier.Destinations = []string{"slack"}
+	}
+	r.Notifier.FailurePolicy = strings.ToLower(r.Notifier.FailurePolicy)
+	if r.Notifier.FailurePolicy == "" {
+		r.Notifier.FailurePolicy = failurePolicies[0]
+	}
+}
+
+// ReportList returns the reports to run with the settings inherited from the default.
+// Without declared reports, it returns only the default report.
+func (c *Config) ReportList() []Report {
+	if len(c.Reports) == 0 {
+		return []Report{c.Report}
+	}
+	reports := make([]Report, len(c.Reports))
+	for i, report := range c.Reports {
+		var keys map[string]bool
+		if i < len(c.reportKeys) {
+			keys = c.reportKeys[i]
+		}
+		inherit(reflect.ValueOf(&report).Elem(), reflect.ValueOf(c.Report), keys, "")
+		report.fillDefaults()
+		reports[i] = report
+	}
+	return reports
+}
+
+// filtersType is inherited as a whole, since the filters of a report narrow down the costs together.
+var filtersType = reflect.TypeOf(Filters{})
+
+// inherit sets the fields of the struct not set in the keys with those of the parent.
+// The keys are the yaml paths set in the file.
+// Without them (e.g. the reports not loaded from a file), the zero fields are regarded as unset.
+func inherit(value reflect.Value, parent reflect.Value, keys map[string]bool, prefix string) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		key := prefix + strings.Split(value.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if field.Kind() == reflect.Struct && field.Type() != filtersType {
+			inherit(field, parent.Field(i), keys, key+".")
+			continue
+		}
+
+		set := keys[key]
+		if keys == nil {
+			set = !field.IsZero()
+		}
+		if !set {
+			field.Set(parent.Field(i))
+		}
+	}
+}
+
+// reportKeys lists the keys set in each of the reports in the document.
+func reportKeys(document *yaml.Node) []map[string]bool {
+	if len(document.Content) == 0 {
+		return nil
+	}
+	root := document.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "reports" {
+			continue
+		}
+		var list []map[string]bool
+		for _, report := range root.Content[i+1].Content {
+			keys := map[string]bool{}
+			collectKeys(report, "", keys)
+			list = append(list, keys)
+		}
+		return list
+	}
+	return nil
+}
+
+// collectKeys adds the paths of the keys in the mapping node to the keys.
+func collectKeys(node *yaml.Node, prefix string, keys map[string]bool) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := prefix + node.Content[i].Value
+		keys[key] = true
+		collectKeys(node.Content[i+1], key+".", keys)
+	}
+}
+
+// problems lists the invalid settings.
+func (c *Config) problems() []string {
+	var problems []string
+	if _, err := time.LoadLocation(c.TimeZone); err != nil {
+		problems = append(problems, fmt.Sprintf("timezone is unknown: '%s'", c.TimeZone))
+	}
+	// The top level settings are validated even with the reports,
+	// since they are used for the error notices and the on-demand reports without a report name.
+	problems = append(problems, c.Report.problems()...)
+	if len(c.Reports) == 0 {
+		return problems
+	}
+
+	names := map[string]bool{}
+	for i, report := range c.ReportList() {
+		if report.Name == "" {
+			problems = append(problems, fmt.Sprintf("reports[%d].name is required", i))
+		} else if names[report.Name] {
+			problems = append(problems, fmt.Sprintf("reports[%d].name is duplicated: '%s'", i, report.Name))
+		}
+		names[report.Name] = true
+		for _, problem := range report.problems() {
+			problems = append(problems, fmt.Sprintf("reports[%d].%s", i, problem))
+		}
+	}
+	return problems
+}
+
+// Validate checks the settings of a report changed after loading (e.g. the destinations).
+func (r *Report) Validate() *utils.CustomError {
+	problems := r.problems()
+	if len(problems) > 0 {
+		return NewConfigError(fmt.Sprintf("Invalid settings of report '%s'!", r.Name), fmt.Errorf("%s", strings.Join(problems, "; ")))
+	}
+	return nil
+}
+
+func (r *Report) problems() []string {
+	var problems []string
+	required := func(name string, value string) {
+		if value == "" {
+			problems = append(problems, name+" is required")
+		}
+	}
+	oneOf := func(name string, value string, allowed []string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		problems = append(problems, fmt.Sprintf("%s must be one of %s: '%s'", name, strings.Join(allowed, ", "), value))
+	}
+	notNegative := func(name string, value float64) {
+		if value < 0 {
+			problems = append(problems, name+" must not be negative")
+		}
+	}
+	validURL := func(name string, value string) {
+		if value == "" {
+			problems = append(problems, name+" is required")
+			return
+		}
+		if parsed, err := url.Parse(value); err != nil || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s must be a valid URL: '%s'", name, value))
+		}
+	}
+
+	required("bigquery.project_id", r.BigQuery.ProjectID)
+	required("bigquery.dataset_name", r.BigQuery.DatasetName)
+	required("bigquery.table_name", r.BigQuery.TableName)
+
+	oneOf("query.grouping", r.Query.Grouping, groupings)
+	oneOf("query.cost_basis", r.Query.CostBasis, costBases)
+	if r.Query.SKUTopServices < 0 {
+		problems = append(problems, "query.sku_top_services must not be negative")
+	}
+	if r.Query.SKUMinCost < 0 {
+		problems = append(problems, "query.sku_min_cost must not be negative")
+	}
+	for key := range r.Query.Filters.Labels {
+		if !LabelKeyPattern.MatchString(key) {
+			problems = append(problems, fmt.Sprintf("query.filters.labels has an invalid key: '%s'", key))
+		}
+	}
+	oneOf("period", r.Period, periods)
+
+	if r.Message.Currency != "" && !currencyCodePattern.MatchString(r.Message.Currency) {
+		problems = append(problems, fmt.Sprintf("message.currency must be a currency code: '%s'", r.Message.Currency))
+	}
+	notNegative("message.currency_rate", r.Message.CurrencyRate)
+	if r.Anomaly.Method != "" {
+		oneOf("anomaly.method", r.Anomaly.Method, anomalyMethods)
+	}
+	if r.Anomaly.WindowDays != 0 && r.Anomaly.WindowDays < minAnomalyWindowDays {
+		problems = append(problems, fmt.Sprintf("anomaly.window_days must be at least %d", minAnomalyWindowDays))
+	}
+	notNegative("anomaly.threshold", r.Anomaly.Threshold)
+	notNegative("anomaly.min_cost", r.Anomaly.MinCost)
+	if r.Forecast.Method != "" {
+		oneOf("forecast.method", r.Forecast.Method, forecastMethods)
+	}
+	if r.Budget.StateObject != "" && !strings.HasPrefix(r.Budget.StateObject, "gs://") {
+		problems = append(problems, fmt.Sprintf("budget.state_object must be a gs:// URI: '%s'", r.Budget.StateObject))
+	}
+
+	oneOf("notifier.failure_policy", r.Notifier.FailurePolicy, failurePolicies)
+	for _, destination := range r.Notifier.Destinations {
+		oneOf("notifier.destinations", destination, destinations)
+	}
+	if r.HasDestination("slack") {
+		oneOf("slack.message_format", r.Slack.MessageFormat, messageFormats)
+		if r.Slack.BotToken != "" {
+			if len(r.Slack.Channels) == 0 {
+				problems = append(problems, "slack.channels is required with slack.bot_token")
+			}
+		} else {
+			validURL("slack.webhook_url", r.Slack.WebhookURL)
+		}
+	}
+	if r.HasDestination("teams") {
+		validURL("teams.webhook_url", r.Teams.WebhookURL)
+	}
+	if r.HasDestination("google_chat") {
+		validURL("google_chat.webhook_url", r.GoogleChat.WebhookURL)
+	}
+	if r.HasDestination("discord") {
+		validURL("discord.webhook_url", r.Discord.WebhookURL)
+	}
+	if r.HasDestination("email") {
+		required("email.host", r.Email.Host)
+		required("email.from", r.Email.From)
+		if len(r.Email.To) == 0 {
+			problems = append(problems, "email.to is required")
+		}
+	}
+	if r.HasDestination("webhook") {
+		validURL("webhook.url", r.Webhook.URL)
+	}
+	if r.HasDestination("pagerduty") {
+		required("pagerduty.routing_key", r.PagerDuty.RoutingKey)
+		oneOf("pagerduty.severity", r.PagerDuty.Severity, pagerDutySeverities)
+		notNegative("pagerduty.spike_threshold", r.PagerDuty.SpikeThreshold)
+		notNegative("pagerduty.spike_ratio", r.PagerDuty.SpikeRatio)
+	}
+	return problems
+}
+
+// HasDestination reports whether the notification is sent to the destination.
+func (r *Report) HasDestination(name string) bool {
+	for _, destination := range r.Notifier.Destinations {
+		if destination == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Location returns the location of the time zone.
+func (c *Config) Location() *time.Location {
+	location, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
@@ -0,0 +1,463 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const validYAML = `
+bigquery:
+  project_id: my-project
+  dataset_name: billing
+  table_name: gcp_billing_export_v1
+timezone: Asia/Tokyo
+query:
+  grouping: project_service
+  label_keys: [team, env]
+  sku_min_cost: 10
+slack:
+  webhook_url: https://hooks.slack.com/services/XXX
+webhook:
+  url: https://example.com/costs
+notifier:
+  destinations: [slack, webhook]
+`
+
+// clearEnv unsets the environment variables read by Config during a test.
+func clearEnv(t *testing.T) func() {
+	names := []string{
+		"GCP_PROJECT", "DATASET_NAME", "TABLE_NAME", "TIMEZONE", "FILE_DIRECTORY",
+		"COST_GROUPING", "COST_LABEL_KEYS", "SKU_TOP_SERVICES", "SKU_MIN_COST", "CREDIT_BREAKDOWN", "COST_BASIS", "REPORTING_PERIOD",
+		"SLACK_WEBHOOK_URL", "SLACK_MESSAGE_FORMAT", "SLACK_BOT_TOKEN", "SLACK_CHANNELS", "SLACK_SIGNING_SECRET", "SLACK_COMMAND_TOPIC",
+		"NOTIFIER", "NOTIFIER_FAILURE_POLICY", "CONFIG_FILE",
+		"REPORTING_CURRENCY", "REPORTING_CURRENCY_RATE", "MESSAGE_LANGUAGE", "MESSAGE_TEMPLATE_FILE",
+		"ANOMALY_DETECTION", "ANOMALY_WINDOW_DAYS", "ANOMALY_THRESHOLD", "ANOMALY_MIN_COST", "FORECAST_METHOD",
+		"BUDGET_FILE", "BUDGET_STATE_OBJECT", "TEAMS_WEBHOOK_URL", "GOOGLE_CHAT_WEBHOOK_URL", "DISCORD_WEBHOOK_URL",
+		"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "SMTP_FROM", "SMTP_TO", "SMTP_STARTTLS",
+		"WEBHOOK_URL", "WEBHOOK_SECRET", "PAGERDUTY_ROUTING_KEY", "PAGERDUTY_SEVERITY", "SPIKE_THRESHOLD", "SPIKE_RATIO",
+	}
+	saved := map[string]string{}
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			saved[name] = value
+		}
+		os.Unsetenv(name)
+	}
+	return func() {
+		for _, name := range names {
+			os.Unsetenv(name)
+		}
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+func TestParseYAMLWithDefaults(t *testing.T) {
+	defer clearEnv(t)()
+
+	config, err := Parse([]byte(validYAML))
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "my-project.billing.gcp_billing_export_v1", config.BigQuery.TableID())
+	assert.EqualValues(t, "Asia/Tokyo", config.Location().String())
+	assert.EqualValues(t, Query{Grouping: "project_service", LabelKeys: []string{"team", "env"}, SKUMinCost: 10, CostBasis: "net"}, config.Query)
+	assert.EqualValues(t, "text", config.Slack.MessageFormat)
+	assert.EqualValues(t, Notifier{Destinations: []string{"slack", "webhook"}, FailurePolicy: "all"}, config.Notifier)
+}
+
+func TestParseJSON(t *testing.T) {
+	defer clearEnv(t)()
+
+	config, err := Parse([]byte(`{
+		"bigquery": {"project_id": "my-project", "dataset_name": "billing", "table_name": "export"},
+		"slack": {"bot_token": "xoxb-token", "channels": ["C01"]}
+	}`))
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "xoxb-token", config.Slack.BotToken)
+	assert.EqualValues(t, []string{"slack"}, config.Notifier.Destinations)
+}
+
+func TestOverrideWithEnvironmentVariables(t *testing.T) {
+	defer clearEnv(t)()
+	os.Setenv("TABLE_NAME", "another_export")
+	os.Setenv("COST_LABEL_KEYS", "team, cost-center")
+	os.Setenv("SKU_TOP_SERVICES", "3")
+	os.Setenv("CREDIT_BREAKDOWN", "true")
+	os.Setenv("NOTIFIER", "teams")
+	os.Setenv("TEAMS_WEBHOOK_URL", "https://example.webhook.office.com/XXX")
+	os.Setenv("SMTP_STARTTLS", "false")
+
+	config, err := Parse([]byte(validYAML))
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "another_export", config.BigQuery.TableName)
+	assert.EqualValues(t, []string{"team", "cost-center"}, config.Query.LabelKeys)
+	assert.EqualValues(t, 3, config.Query.SKUTopServices)
+	assert.True(t, config.Query.CreditBreakdown)
+	assert.EqualValues(t, []string{"teams"}, config.Notifier.Destinations)
+	assert.EqualValues(t, "https://example.webhook.office.com/XXX", config.Teams.WebhookURL)
+	assert.False(t, *config.Email.StartTLS)
+}
+
+func TestLoadOnlyFromEnvironmentVariablesWithoutFile(t *testing.T) {
+	defer clearEnv(t)()
+	os.Setenv("GCP_PROJECT", "my-project")
+	os.Setenv("DATASET_NAME", "billing")
+	os.Setenv("TABLE_NAME", "export")
+	os.Setenv("SLACK_WEBHOOK_URL", "https://hooks.slack.com/services/XXX")
+
+	config, err := Load()
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "my-project.billing.export", config.BigQuery.TableID())
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	defer clearEnv(t)()
+	configFile, _ := ioutil.TempFile("", "config*.yaml")
+	configFile.WriteString(validYAML)
+	configFile.Close()
+	defer os.Remove(configFile.Name())
+	os.Setenv("CONFIG_FILE", configFile.Name())
+
+	config, err := Load()
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "my-project", config.BigQuery.ProjectID)
+}
+
+func TestReturnErrorWhenConfigFileDoesNotExist(t *testing.T) {
+	defer clearEnv(t)()
+	os.Setenv("CONFIG_FILE", "/no/such/config.yaml")
+
+	_, err := Load()
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Configuration. Could not read the config file!"), err)
+}
+
+func TestReturnErrorWithUnknownField(t *testing.T) {
+	defer clearEnv(t)()
+
+	_, err := Parse([]byte("bigquery:\n  project: my-project\n"))
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Configuration. Invalid config file!"), err)
+}
+
+func TestReportAllInvalidSettingsAtOnce(t *testing.T) {
+	defer clearEnv(t)()
+	os.Setenv("SKU_MIN_COST", "ten")
+
+	_, err := Parse([]byte(`
+timezone: Mars/Olympus
+query:
+  grouping: sku
+  sku_top_services: -1
+notifier:
+  failure_policy: some
+`))
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Configuration. Invalid configuration!: "+strings.Join([]string{
+		"SKU_MIN_COST must be a number: 'ten'",
+		"timezone is unknown: 'Mars/Olympus'",
+		"bigquery.project_id is required",
+		"bigquery.dataset_name is required",
+		"bigquery.table_name is required",
+		"query.grouping must be one of service, project, project_service: 'sku'",
+		"query.sku_top_services must not be negative",
+		"notifier.failure_policy must be one of all, any: 'some'",
+		"slack.webhook_url is required",
+	}, "; "), err.Error())
+}
+
+func TestRequireChannelsWithSlackBotToken(t *testing.T) {
+	defer clearEnv(t)()
+	os.Setenv("SLACK_BOT_TOKEN", "xoxb-token")
+
+	_, err := Parse([]byte(validYAML))
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasSuffix(err.Error(), ": slack.channels is required with slack.bot_token"), err)
+}
+
+func TestNotRequireSlackSettingsWithoutSlackDestination(t *testing.T) {
+	defer clearEnv(t)()
+	os.Setenv("NOTIFIER", "email")
+	os.Setenv("SMTP_HOST", "smtp.example.com")
+	os.Setenv("SMTP_FROM", "billing@example.com")
+	os.Setenv("SMTP_TO", "finance@example.com")
+
+	config, err := Parse([]byte(`{"bigquery": {"project_id": "p", "dataset_name": "d", "table_name": "t"}}`))
+
+	assert.Nil(t, err)
+	assert.False(t, config.HasDestination("slack"))
+}
+
+func TestReportInvalidSettingsOfComponentsAndDestinations(t *testing.T) {
+	defer clearEnv(t)()
+
+	_, err := Parse([]byte(`
+bigquery: {project_id: p, dataset_name: d, table_name: t}
+message:
+  currency: yen!
+anomaly:
+  method: iqr
+  window_days: 3
+forecast:
+  method: linear
+budget:
+  state_object: my-bucket/state.json
+notifier:
+  destinations: [teams, google_chat, discord, email, webhook, pagerduty, fax]
+google_chat:
+  webhook_url: chat.googleapis.com
+pagerduty:
+  severity: high
+`))
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Configuration. Invalid configuration!: "+strings.Join([]string{
+		"message.currency must be a currency code: 'YEN!'",
+		"anomaly.method must be one of mad, zscore: 'iqr'",
+		"anomaly.window_days must be at least 7",
+		"budget.state_object must be a gs:// URI: 'my-bucket/state.json'",
+		"notifier.destinations must be one of slack, teams, google_chat, discord, email, webhook, pagerduty: 'fax'",
+		"teams.webhook_url is required",
+		"google_chat.webhook_url must be a valid URL: 'chat.googleapis.com'",
+		"discord.webhook_url is required",
+		"email.host is required",
+		"email.from is required",
+		"email.to is required",
+		"webhook.url is required",
+		"pagerduty.routing_key is required",
+		"pagerduty.severity must be one of critical, error, warning, info: 'high'",
+	}, "; "), err.Error())
+}
+
+func TestAcceptRegisteredDestination(t *testing.T) {
+	defer clearEnv(t)()
+	RegisterDestination("fax")
+	defer func() { destinations = destinations[:len(destinations)-1] }()
+
+	_, err := Parse([]byte(`{"bigquery": {"project_id": "p", "dataset_name": "d", "table_name": "t"}, "notifier": {"destinations": ["fax"]}}`))
+
+	assert.Nil(t, err)
+}
+
+func TestReadSettingsFromEnvironmentVariablesWithoutValidation(t *testing.T) {
+	defer clearEnv(t)()
+	os.Setenv("ANOMALY_DETECTION", "ZScore")
+	os.Setenv("ANOMALY_THRESHOLD", "high")
+	os.Setenv("SMTP_TO", "a@example.com, b@example.com")
+
+	report := FromEnv()
+
+	assert.EqualValues(t, Anomaly{Method: "zscore"}, report.Anomaly)
+	assert.EqualValues(t, []string{"a@example.com", "b@example.com"}, report.Email.To)
+	assert.EqualValues(t, 587, report.Email.Port)
+	assert.Nil(t, report.Email.StartTLS)
+	assert.EqualValues(t, "warning", report.PagerDuty.Severity)
+	assert.EqualValues(t, []string{"slack"}, report.Notifier.Destinations)
+}
+
+const reportsYAML = validYAML + `
+reports:
+  - name: finance
+    period: previous_month
+  - name: team-a
+    bigquery:
+      table_name: team_a_export
+    query:
+      grouping: service
+      filters:
+        projects: [team-a-prod, team-a-dev]
+        labels:
+          team: [a]
+    slack:
+      webhook_url: https://hooks.slack.com/services/TEAM-A
+`
+
+func TestInheritDefaultSettingsInReports(t *testing.T) {
+	defer clearEnv(t)()
+
+	config, err := Parse([]byte(reportsYAML))
+	assert.Nil(t, err)
+
+	reports := config.ReportList()
+	assert.Len(t, reports, 2)
+
+	assert.EqualValues(t, "finance", reports[0].Name)
+	assert.EqualValues(t, "previous_month", reports[0].Period)
+	assert.EqualValues(t, config.BigQuery, reports[0].BigQuery)
+	assert.EqualValues(t, config.Query, reports[0].Query)
+	assert.EqualValues(t, config.Slack, reports[0].Slack)
+
+	assert.EqualValues(t, "my-project.billing.team_a_export", reports[1].BigQuery.TableID())
+	assert.EqualValues(t, "month_to_date", reports[1].Period)
+	assert.EqualValues(t, Query{
+		Grouping:   "service",
+		LabelKeys:  []string{"team", "env"},
+		SKUMinCost: 10,
+		CostBasis:  "net",
+		Filters:    Filters{Projects: []string{"team-a-prod", "team-a-dev"}, Labels: map[string][]string{"team": {"a"}}},
+	}, reports[1].Query)
+	assert.EqualValues(t, "https://hooks.slack.com/services/TEAM-A", reports[1].Slack.WebhookURL)
+	assert.EqualValues(t, []string{"slack", "webhook"}, reports[1].Notifier.Destinations)
+}
+
+func TestOverrideDefaultSettingsWithZeroValuesInReports(t *testing.T) {
+	defer clearEnv(t)()
+
+	config, err := Parse([]byte(`
+bigquery:
+  project_id: my-project
+  dataset_name: billing
+  table_name: gcp_billing_export_v1
+query:
+  label_keys: [team]
+  sku_top_services: 3
+  credit_breakdown: true
+  filters:
+    projects: [my-project]
+slack:
+  webhook_url: https://hooks.slack.com/services/XXX
+reports:
+  - name: all-projects
+    query:
+      label_keys: []
+      sku_top_services: 0
+      credit_breakdown: false
+      filters: {}
+  - name: bigquery
+    query:
+      filters:
+        services: [BigQuery]
+  - name: default
+`))
+	assert.Nil(t, err)
+
+	reports := config.ReportList()
+	assert.Len(t, reports, 3)
+
+	assert.Empty(t, reports[0].Query.LabelKeys)
+	assert.EqualValues(t, 0, reports[0].Query.SKUTopServices)
+	assert.False(t, reports[0].Query.CreditBreakdown)
+	assert.EqualValues(t, Filters{}, reports[0].Query.Filters)
+
+	assert.EqualValues(t, []string{"team"}, reports[1].Query.LabelKeys)
+	assert.EqualValues(t, 3, reports[1].Query.SKUTopServices)
+	assert.True(t, reports[1].Query.CreditBreakdown)
+	assert.EqualValues(t, Filters{Services: []string{"BigQuery"}}, reports[1].Query.Filters)
+
+	assert.EqualValues(t, config.Query, reports[2].Query)
+}
+
+func TestSetDestinationsOfEachReport(t *testing.T) {
+	defer clearEnv(t)()
+
+	config, err := Parse([]byte(validYAML + `
+teams:
+  webhook_url: https://example.com/default-teams
+reports:
+  - name: finance
+    notifier:
+      destinations: [teams, email]
+    email:
+      host: smtp.example.com
+      from: costs@example.com
+      to: [finance@example.com]
+  - name: team-a
+    notifier:
+      destinations: [teams, webhook]
+    teams:
+      webhook_url: https://example.com/team-a-teams
+    webhook:
+      url: https://example.com/team-a-costs
+`))
+	assert.Nil(t, err)
+
+	reports := config.ReportList()
+	assert.EqualValues(t, "https://example.com/default-teams", reports[0].Teams.WebhookURL)
+	assert.EqualValues(t, []string{"finance@example.com"}, reports[0].Email.To)
+	assert.EqualValues(t, 587, reports[0].Email.Port)
+	assert.EqualValues(t, "https://example.com/team-a-teams", reports[1].Teams.WebhookURL)
+	assert.EqualValues(t, "https://example.com/team-a-costs", reports[1].Webhook.URL)
+	assert.Empty(t, reports[1].Email.Host)
+}
+
+func TestReportMissingDestinationSettingsOfReports(t *testing.T) {
+	defer clearEnv(t)()
+
+	_, err := Parse([]byte(validYAML + `
+reports:
+  - name: finance
+    notifier:
+      destinations: [discord]
+`))
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "reports[0].discord.webhook_url is required")
+}
+
+func TestValidateTopLevelSettingsWithReports(t *testing.T) {
+	defer clearEnv(t)()
+
+	_, err := Parse([]byte(`
+bigquery:
+  project_id: my-project
+  dataset_name: billing
+reports:
+  - name: finance
+    bigquery:
+      table_name: finance_export
+    slack:
+      webhook_url: https://hooks.slack.com/services/XXX
+`))
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Configuration. Invalid configuration!: "+strings.Join([]string{
+		"bigquery.table_name is required",
+		"slack.webhook_url is required",
+	}, "; "), err.Error())
+}
+
+func TestUseDefaultReportWithoutReports(t *testing.T) {
+	defer clearEnv(t)()
+
+	config, _ := Parse([]byte(validYAML))
+
+	assert.EqualValues(t, []Report{config.Report}, config.ReportList())
+}
+
+func TestReportInvalidSettingsOfReports(t *testing.T) {
+	defer clearEnv(t)()
+
+	_, err := Parse([]byte(validYAML + `
+reports:
+  - name: a
+    period: yesterday
+  - name: a
+    query:
+      filters:
+        labels:
+          Team: [a]
+  - bigquery:
+      project_id: other
+`))
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Configuration. Invalid configuration!: "+strings.Join([]string{
+		"reports[0].period must be one of month_to_date, previous_month, last_7_days: 'yesterday'",
+		"reports[1].name is duplicated: 'a'",
+		"reports[1].query.filters.labels has an invalid key: 'Team'",
+		"reports[2].name is required",
+	}, "; "), err.Error())
+}
@@ -34,3 +34,46 @@ func NewReportingPeriod(reportingDateTime time.Time) ReportingPeriod {
 		To:       time.Date(year, month, day, 0, 0, 0, 0, location),
 	}
 }
+
+// IsMonthToDate returns true if the period starts from the first day of a month
+// and ends in the same month.
+func (p *ReportingPeriod) IsMonthToDate() bool {
+	return p.From.Day() == 1 && p.From.Year() == p.To.Year() && p.From.Month() == p.To.Month()
+}
+
+// Rules to decide the reporting period from the reporting datetime.
+const (
+	PeriodMonthToDate   = "month_to_date"  // from the first day of the month to the day before (see NewReportingPeriod)
+	PeriodPreviousMonth = "previous_month" // the whole previous month
+	PeriodLast7Days     = "last_7_days"    // the 7 days up to the day before
+)
+
+// NewReportingPeriodByRule constructs the date period to report the GCP cost
+// from the reporting datetime with the rule.
+//
+// With PeriodPreviousMonth, the period is the previous month of the reporting date
+// (e.g. 2021/8/30 -> 2021/7/1 ~ 2021/7/31),
+// and with PeriodLast7Days, the 7 days before the reporting date
+// (e.g. 2021/8/3 -> 2021/7/27 ~ 2021/8/2).
+// Otherwise, the period is the same as NewReportingPeriod.
+func NewReportingPeriodByRule(reportingDateTime time.Time, rule string) ReportingPeriod {
+	location := reportingDateTime.Location()
+	reportingDate := time.Date(reportingDateTime.Year(), reportingDateTime.Month(), reportingDateTime.Day(), 0, 0, 0, 0, location)
+	switch rule {
+	case PeriodPreviousMonth:
+		firstDay := reportingDate.AddDate(0, 0, 1-reportingDate.Day())
+		return ReportingPeriod{
+			TimeZone: location.String(),
+			From:     firstDay.AddDate(0, -1, 0),
+			To:       firstDay.AddDate(0, 0, -1),
+		}
+	case PeriodLast7Days:
+		return ReportingPeriod{
+			TimeZone: location.String(),
+			From:     reportingDate.AddDate(0, 0, -7),
+			To:       reportingDate.AddDate(0, 0, -1),
+		}
+	default:
+		return NewReportingPeriod(reportingDateTime)
+	}
+}
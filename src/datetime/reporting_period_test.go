@@ -46,3 +46,47 @@ func TestReportingPeriodPreservesTimezone(t *testing.T) {
 
 	assert.EqualValues(t, expectedReportingPeriod, actualReportingPeriod)
 }
+
+func TestBuildPreviousMonthReportingPeriod(t *testing.T) {
+	inputDateTime := time.Date(2021, 3, 31, 8, 30, 0, 0, time.Local)
+
+	expectedReportingPeriod := ReportingPeriod{
+		TimeZone: time.Local.String(),
+		From:     time.Date(2021, 2, 1, 0, 0, 0, 0, time.Local),
+		To:       time.Date(2021, 2, 28, 0, 0, 0, 0, time.Local),
+	}
+	actualReportingPeriod := NewReportingPeriodByRule(inputDateTime, PeriodPreviousMonth)
+
+	assert.EqualValues(t, expectedReportingPeriod, actualReportingPeriod)
+}
+
+func TestBuildMonthToDateReportingPeriodByDefaultRule(t *testing.T) {
+	inputDateTime := time.Date(2021, 5, 8, 8, 30, 0, 0, time.Local)
+
+	assert.EqualValues(t, NewReportingPeriod(inputDateTime), NewReportingPeriodByRule(inputDateTime, ""))
+}
+
+func TestBuildLast7DaysReportingPeriod(t *testing.T) {
+	inputDateTime := time.Date(2021, 8, 3, 8, 30, 0, 0, time.Local)
+
+	expectedReportingPeriod := ReportingPeriod{
+		TimeZone: time.Local.String(),
+		From:     time.Date(2021, 7, 27, 0, 0, 0, 0, time.Local),
+		To:       time.Date(2021, 8, 2, 0, 0, 0, 0, time.Local),
+	}
+	actualReportingPeriod := NewReportingPeriodByRule(inputDateTime, PeriodLast7Days)
+
+	assert.EqualValues(t, expectedReportingPeriod, actualReportingPeriod)
+}
+
+func TestMonthToDateIsOnlyPeriodWithinMonthFromFirstDay(t *testing.T) {
+	inputDateTime := time.Date(2021, 8, 3, 8, 30, 0, 0, time.Local)
+
+	monthToDate := NewReportingPeriodByRule(inputDateTime, PeriodMonthToDate)
+	previousMonth := NewReportingPeriodByRule(inputDateTime, PeriodPreviousMonth)
+	last7Days := NewReportingPeriodByRule(inputDateTime, PeriodLast7Days)
+
+	assert.True(t, monthToDate.IsMonthToDate())
+	assert.True(t, previousMonth.IsMonthToDate())
+	assert.False(t, last7Days.IsMonthToDate())
+}
@@ -23,6 +23,12 @@ func NewTimeZoneConverter() TimeZoneConverter {
 		location = time.Local
 		log.Printf("Runtime local timezone '%s' is set instead.", location)
 	}
+	return NewTimeZoneConverterWith(location)
+}
+
+// NewTimeZoneConverterWith constructs a TimeZoneConverter to
+// convert the timezone into the location.
+func NewTimeZoneConverterWith(location *time.Location) TimeZoneConverter {
 	return TimeZoneConverter{
 		location: location,
 	}
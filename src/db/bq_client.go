@@ -5,8 +5,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"cloud.google.com/go/bigquery"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
 	"github.com/tatamiya/gcp-cost-notification/src/utils"
 	"google.golang.org/api/iterator"
 )
@@ -20,13 +22,37 @@ func NewQueryError(message string, err error) *utils.CustomError {
 }
 
 type QueryResult struct {
-	Service   string  // GCP service name
-	Monthly   float32 // Monthly cost
-	Yesterday float32 // The cost in the day before
+	Service     string  // GCP service name
+	SKU         string  // SKU description (only in SKU drill-down)
+	Project     string  // GCP project ID
+	ProjectName string  `bigquery:"project_name"` // GCP project name
+	LabelKey    string  `bigquery:"label_key"`    // Resource label key
+	LabelValue  string  `bigquery:"label_value"`  // Resource label value (empty if unlabelled)
+	CreditType  string  `bigquery:"credit_type"`  // Credit type (only in credit breakdown)
+	Monthly     float32 // Monthly net cost (credits applied)
+	Yesterday   float32 // The net cost in the day before
+
+	MonthlyCredits   float32 `bigquery:"monthly_credits"`   // Monthly sum of credits (negative)
+	YesterdayCredits float32 `bigquery:"yesterday_credits"` // Credits in the day before (negative)
+
+	DayBeforeYesterday float32 `bigquery:"day_before_yesterday"` // The net cost two days before
+	PreviousMonthly    float32 `bigquery:"previous_monthly"`     // The net cost in the same period of the previous month
+
+	Currency               string  // Currency code of the billing account (only in the total)
+	CurrencyConversionRate float64 `bigquery:"currency_conversion_rate"` // Exchange rate from USD (only in the total)
+
+	LastExportTime time.Time `bigquery:"last_export_time"` // Latest export time of the billing data (only in the total)
+}
+
+// DailyCost is a row of the daily net cost of a service.
+type DailyCost struct {
+	Service string
+	Date    string  `bigquery:"usage_date"` // Usage date in the "2006-01-02" format
+	Cost    float32 // The net cost in the day (credits applied)
 }
 
 func (r *QueryResult) String() string {
-	return fmt.Sprintf("{Service: %s, Monthly: %f, Yesterday: %f}", r.Service, r.Monthly, r.Yesterday)
+	return fmt.Sprintf("{Service: %s, Project: %s, Monthly: %f, Yesterday: %f}", r.Service, r.Project, r.Monthly, r.Yesterday)
 }
 
 // BQClient is an object to connect to BigQuery and send a query
@@ -39,9 +65,13 @@ type BQClient struct {
 // The GCP project name of BQ is fetched from the
 // environmental variable.
 func NewBQClient() BQClient {
-	projectID := os.Getenv("GCP_PROJECT")
+	return NewBQClientWith(config.BigQuery{ProjectID: os.Getenv("GCP_PROJECT")})
+}
+
+// NewBQClientWith constructs a BQClient object connecting to the GCP project in the settings.
+func NewBQClientWith(settings config.BigQuery) BQClient {
 	ctx := context.Background()
-	client, err := bigquery.NewClient(ctx, projectID)
+	client, err := bigquery.NewClient(ctx, settings.ProjectID)
 	if err != nil {
 		panic(err)
 	}
@@ -75,3 +105,30 @@ func (c *BQClient) SendQuery(query string) ([]*QueryResult, *utils.CustomError)
 
 	return queryResults, nil
 }
+
+// SendDailyQuery receives a query as a string and send it to BQ
+// to retrieve the daily cost of each service.
+func (c *BQClient) SendDailyQuery(query string) ([]*DailyCost, *utils.CustomError) {
+	var dailyCosts []*DailyCost
+
+	q := c.client.Query(query)
+	ctx := context.Background()
+	it, err := q.Read(ctx)
+	if err != nil {
+		return dailyCosts, NewQueryError("Failed in executing daily cost query", err)
+	}
+
+	for {
+		var dailyCost DailyCost
+		err := it.Next(&dailyCost)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return []*DailyCost{}, NewQueryError("Failed in parsing daily cost query results", err)
+		}
+		dailyCosts = append(dailyCosts, &dailyCost)
+	}
+
+	return dailyCosts, nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func NewStorageError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Storage Access",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// GCSObject is an object in Cloud Storage to keep a small state between the runs.
+type GCSObject struct {
+	bucket string
+	name   string
+}
+
+// NewGCSObject constructs a GCSObject from the URI in the "gs://bucket/path/to/object" format.
+func NewGCSObject(uri string) (GCSObject, *utils.CustomError) {
+	path := strings.TrimPrefix(uri, "gs://")
+	slash := strings.Index(path, "/")
+	if path == uri || slash <= 0 || slash == len(path)-1 {
+		return GCSObject{}, NewStorageError("Invalid Cloud Storage URI!", fmt.Errorf("'%s' is not in the gs://bucket/object format", uri))
+	}
+	return GCSObject{bucket: path[:slash], name: path[slash+1:]}, nil
+}
+
+// Read method returns the content of the object.
+// It returns nil if the object does not exist yet.
+func (o *GCSObject) Read() ([]byte, *utils.CustomError) {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, NewStorageError("Failed in connecting to Cloud Storage", err)
+	}
+	defer client.Close()
+
+	reader, err := client.Bucket(o.bucket).Object(o.name).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, NewStorageError("Failed in reading the object", err)
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, NewStorageError("Failed in reading the object", err)
+	}
+	return content, nil
+}
+
+// Write method replaces the content of the object.
+func (o *GCSObject) Write(content []byte) *utils.CustomError {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return NewStorageError("Failed in connecting to Cloud Storage", err)
+	}
+	defer client.Close()
+
+	writer := client.Bucket(o.bucket).Object(o.name).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(content); err != nil {
+		writer.Close()
+		return NewStorageError("Failed in writing the object", err)
+	}
+	if err := writer.Close(); err != nil {
+		return NewStorageError("Failed in writing the object", err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGCSObjectURI(t *testing.T) {
+	object, err := NewGCSObject("gs://my-bucket/state/budget.json")
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, GCSObject{bucket: "my-bucket", name: "state/budget.json"}, object)
+}
+
+func TestReturnErrorWhenGCSObjectURIIsInvalid(t *testing.T) {
+	for _, uri := range []string{"my-bucket/budget.json", "gs://my-bucket", "gs://my-bucket/", "gs:///budget.json"} {
+		_, err := NewGCSObject(uri)
+		assert.NotNil(t, err, uri)
+	}
+}
@@ -9,5 +9,13 @@ func ExampleQueryResult_String() {
 		Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0,
 	}
 	fmt.Println(sampleQueryResult.String())
-	// Output: {Service: Cloud SQL, Monthly: 1000.000000, Yesterday: 400.000000}
+	// Output: {Service: Cloud SQL, Project: , Monthly: 1000.000000, Yesterday: 400.000000}
+}
+
+func ExampleQueryResult_String_project() {
+	sampleQueryResult := &QueryResult{
+		Service: "Cloud SQL", Project: "sample-project", Monthly: 1000.0, Yesterday: 400.0,
+	}
+	fmt.Println(sampleQueryResult.String())
+	// Output: {Service: Cloud SQL, Project: sample-project, Monthly: 1000.000000, Yesterday: 400.000000}
 }
@@ -0,0 +1,236 @@
+package notification
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+// Discord allows up to 2000 characters in the content of a message,
+// and up to 25 fields in an embed with 256 characters in a field name,
+// 1024 characters in a field value and 6000 characters in total.
+const (
+	maxDiscordContent    = 2000
+	maxDiscordFields     = 25
+	maxDiscordFieldName  = 256
+	maxDiscordFieldValue = 1024
+	maxDiscordEmbed      = 6000
+)
+
+// Colors of the embed by the trend of the cost on the most recent date.
+const (
+	discordColorRise = 0xE74C3C // red
+	discordColorFall = 0x2ECC71 // green
+	discordColorFlat = 0x95A5A6 // grey
+)
+
+func NewDiscordError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Discord Notification",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// DiscordClient is an object to send a message to a Discord channel
+// via webhook URL.
+type DiscordClient struct {
+	webhookURL string
+	httpClient *http.Client
+}
+
+// NewDiscordClient constructs a DiscordClient object.
+// The webhook URL is fetched from the environment variable
+// `DISCORD_WEBHOOK_URL` in construction.
+func NewDiscordClient() DiscordClient {
+	return NewDiscordClientWith(config.FromEnv().Discord)
+}
+
+// NewDiscordClientWith constructs a DiscordClient object with the webhook URL in the settings.
+func NewDiscordClientWith(settings config.Discord) DiscordClient {
+	return DiscordClient{
+		webhookURL: settings.WebhookURL,
+		httpClient: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// Send method receives an object which can be converted into
+// a notification message and sends it to Discord.
+//
+// An Invoice is rendered as an embed with a field for each service,
+// and the other messages are sent as plain text.
+func (c *DiscordClient) Send(messenger Messenger) (string, *utils.CustomError) {
+	message := messenger.AsMessage()
+
+	var payload discordMessage
+	invoice, ok := messenger.(*billing.Invoice)
+	if ok && !invoice.HasCustomMessage() {
+		payload = discordMessage{Embeds: []discordEmbed{invoiceEmbed(invoice)}}
+	} else {
+		payload = discordMessage{Content: truncate(message, maxDiscordContent)}
+	}
+
+	err := postJSON(c.httpClient, c.webhookURL, payload)
+	if err != nil {
+		return "", NewDiscordError("Could not send message!", err)
+	}
+	return message, nil
+}
+
+type discordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []discordEmbedField `json:"fields,omitempty"`
+	Footer      *discordEmbedFooter `json:"footer,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// invoiceEmbed renders an Invoice as an embed:
+// the total cost in the description, a field for each of the budgets, the anomalies and the forecast,
+// a field for the credits of each type, and a field for each service (or project).
+//
+// If the fields of the services exceed the limits of Discord,
+// the last field is replaced with an "and N more" line.
+func invoiceEmbed(invoice *billing.Invoice) discordEmbed {
+	catalog := invoice.Catalog()
+
+	description := fmt.Sprintf("**%s**: %s\n**%s**: %s",
+		catalog.MonthlyLabel, invoice.FormatMoney(invoice.Total.Monthly),
+		catalog.YesterdayLabel, invoice.FormatMoney(invoice.Total.Yesterday),
+	)
+	if invoice.Total.MonthlyCredits != 0 || invoice.Total.YesterdayCredits != 0 {
+		description += fmt.Sprintf("\n**%s**: %s", catalog.Credits, costValue(invoice, invoice.Total.MonthlyCredits, invoice.Total.YesterdayCredits))
+	}
+
+	embed := discordEmbed{
+		Title:       fmt.Sprintf(catalog.Heading, invoice.BillingPeriod.Format(catalog)),
+		Description: description,
+		Color:       discordColor(invoice),
+	}
+	if !invoice.LastExportTime.IsZero() {
+		embed.Footer = &discordEmbedFooter{Text: exportTimeText(invoice)}
+		embed.Timestamp = invoice.LastExportTime.UTC().Format(time.RFC3339)
+	}
+
+	for _, section := range invoice.Highlights() {
+		var lines []string
+		for _, item := range section.Items {
+			lines = append(lines, fmt.Sprintf("%s: %s", item.Name, item.Value))
+		}
+		field := discordField(sectionTitle(section.Header), strings.Join(lines, "\n"))
+		field.Inline = false
+		embed.Fields = append(embed.Fields, field)
+	}
+	if len(invoice.Credits) > 0 {
+		var lines []string
+		for _, credit := range invoice.Credits {
+			lines = append(lines, fmt.Sprintf("%s: %s", credit.Type, costValue(invoice, credit.Monthly, credit.Yesterday)))
+		}
+		field := discordField(sectionTitle(catalog.CreditsHeader), strings.Join(lines, "\n"))
+		field.Inline = false
+		embed.Fields = append(embed.Fields, field)
+	}
+
+	var fields []discordEmbedField
+	for _, cost := range invoice.Services {
+		value := costValue(invoice, cost.Monthly, cost.Yesterday)
+		for _, sku := range cost.SKUs {
+			value += fmt.Sprintf("\n• %s: %s", sku.SKU, invoice.FormatMoney(sku.Monthly))
+		}
+		fields = append(fields, discordField(cost.Service, value))
+	}
+	for _, project := range invoice.Projects {
+		value := costValue(invoice, project.Monthly, project.Yesterday)
+		for _, cost := range project.Services {
+			value += fmt.Sprintf("\n• %s: %s", cost.Service, invoice.FormatMoney(cost.Monthly))
+		}
+		fields = append(fields, discordField(project.DisplayName(), value))
+	}
+
+	// The "and N more" field takes up to 20 characters.
+	size := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description) + 20
+	if embed.Footer != nil {
+		size += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	for _, field := range embed.Fields {
+		size += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	maxFields := maxDiscordFields - len(embed.Fields)
+	for i, field := range fields {
+		size += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+		if (i == maxFields-1 && len(fields) > maxFields) || size > maxDiscordEmbed {
+			embed.Fields = append(embed.Fields, discordEmbedField{
+				Name:  "…",
+				Value: fmt.Sprintf(catalog.MoreItems, len(fields)-i),
+			})
+			break
+		}
+		embed.Fields = append(embed.Fields, field)
+	}
+	return embed
+}
+
+func discordField(name string, value string) discordEmbedField {
+	return discordEmbedField{
+		Name:   truncate(name, maxDiscordFieldName),
+		Value:  truncate(value, maxDiscordFieldValue),
+		Inline: true,
+	}
+}
+
+// discordColor decides the embed color by whether the total cost on the most recent date
+// rose or fell from the day before.
+// If the cost of the day before is not available,
+// it is compared with the daily average of the other days in the billing period.
+func discordColor(invoice *billing.Invoice) int {
+	var change float32
+	if invoice.HasComparison() {
+		change = invoice.Total.DayOverDay()
+	} else {
+		average, ok := dailyAverage(invoice, invoice.Total.Monthly, invoice.Total.Yesterday)
+		if !ok {
+			return discordColorFlat
+		}
+		change = invoice.Total.Yesterday - average
+	}
+	switch {
+	case change > 0:
+		return discordColorRise
+	case change < 0:
+		return discordColorFall
+	default:
+		return discordColorFlat
+	}
+}
+
+// truncate shortens the text to the maximum number of characters
+// with an ellipsis at the end.
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,139 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+)
+
+func TestSendInvoiceToDiscordAsEmbed(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusNoContent, &received)
+	defer server.Close()
+
+	client := DiscordClient{webhookURL: server.URL, httpClient: server.Client()}
+	invoice := newInputInvoice()
+
+	sentMessage, err := client.Send(invoice)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, invoice.AsMessage(), sentMessage)
+
+	var payload discordMessage
+	json.Unmarshal(received, &payload)
+	embed := payload.Embeds[0]
+	assert.EqualValues(t, "5/1 ~ 5/8 の GCP 利用料金", embed.Title)
+	assert.EqualValues(t, "**月間合計**: ¥ 1,000.07\n**前日分**: ¥ 400", embed.Description)
+	assert.EqualValues(t, discordColorRise, embed.Color)
+	assert.EqualValues(t, discordEmbedField{Name: "Cloud SQL", Value: "¥ 1,000 (¥ 400)", Inline: true}, embed.Fields[0])
+	assert.EqualValues(t, "データ更新日時: 2021-05-09 03:04 UTC", embed.Footer.Text)
+	assert.EqualValues(t, "2021-05-09T03:04:00Z", embed.Timestamp)
+}
+
+func TestRenderHighlightsAsEmbedFields(t *testing.T) {
+	embed := invoiceEmbed(newHighlightedInputInvoice())
+
+	assert.EqualValues(t, discordEmbedField{Name: "🚨 予算アラート", Value: "Total: 予算の 80% を超えました (¥ 1,000.07 / ¥ 1,200, 83.3%)"}, embed.Fields[0])
+	assert.EqualValues(t, discordEmbedField{Name: "予算", Value: "Total: ¥ 1,000.07 / ¥ 1,200 (83.3%) 🟠"}, embed.Fields[1])
+	assert.EqualValues(t, discordEmbedField{Name: "⚠️ 異常値", Value: "Cloud SQL: ¥ 400 ↑ (通常 ¥ 100)"}, embed.Fields[2])
+	assert.EqualValues(t, discordEmbedField{Name: "月末予測", Value: "Total: ¥ 3,875\nCloud SQL: ¥ 3,875"}, embed.Fields[3])
+	assert.EqualValues(t, discordEmbedField{Name: "Cloud SQL", Value: "¥ 1,000 (¥ 400)", Inline: true}, embed.Fields[4])
+}
+
+func TestRenderCreditsByTypeAsEmbedField(t *testing.T) {
+	embed := invoiceEmbed(newCreditedInputInvoice())
+
+	assert.EqualValues(t, discordEmbedField{Name: "クレジット内訳", Value: "SUSTAINED_USAGE_DISCOUNT: ¥ -100 (¥ -40)\nPROMOTION: ¥ -50 (¥ -20)"}, embed.Fields[0])
+	assert.EqualValues(t, discordEmbedField{Name: "Cloud SQL", Value: "¥ 1,000 (¥ 400)", Inline: true}, embed.Fields[1])
+}
+
+func TestColorEmbedByTrendOfYesterdayCost(t *testing.T) {
+	invoice := newInputInvoice()
+
+	invoice.Total = &billing.Cost{Monthly: 800.0, Yesterday: 100.0}
+	assert.EqualValues(t, discordColorFlat, discordColor(invoice))
+
+	invoice.Total = &billing.Cost{Monthly: 800.0, Yesterday: 50.0}
+	assert.EqualValues(t, discordColorFall, discordColor(invoice))
+
+	invoice.BillingPeriod.To = invoice.BillingPeriod.From
+	assert.EqualValues(t, discordColorFlat, discordColor(invoice))
+}
+
+func TestColorEmbedByDayOverDayChange(t *testing.T) {
+	invoice := newInputInvoice()
+
+	invoice.Total = &billing.Cost{Monthly: 800.0, Yesterday: 50.0, DayBeforeYesterday: 40.0}
+	assert.EqualValues(t, discordColorRise, discordColor(invoice))
+
+	invoice.Total = &billing.Cost{Monthly: 800.0, Yesterday: 300.0, DayBeforeYesterday: 400.0}
+	assert.EqualValues(t, discordColorFall, discordColor(invoice))
+}
+
+func TestTruncateEmbedFieldsWithMoreLine(t *testing.T) {
+	invoice := newInputInvoice()
+	invoice.Services = nil
+	for i := 0; i < 30; i++ {
+		invoice.Services = append(invoice.Services, &billing.Cost{Service: fmt.Sprintf("Service %d", i), Monthly: 1.0})
+	}
+	invoice.Language = "en"
+
+	embed := invoiceEmbed(invoice)
+
+	assert.Len(t, embed.Fields, maxDiscordFields)
+	assert.EqualValues(t, "Service 23", embed.Fields[23].Name)
+	assert.EqualValues(t, "and 6 more", embed.Fields[24].Value)
+}
+
+func TestTruncateEmbedFieldsByTotalLength(t *testing.T) {
+	invoice := newInputInvoice()
+	invoice.Services = nil
+	for i := 0; i < 24; i++ {
+		invoice.Services = append(invoice.Services, &billing.Cost{Service: strings.Repeat("x", 300), Monthly: 1.0})
+	}
+
+	embed := invoiceEmbed(invoice)
+
+	size := len(embed.Title) + len(embed.Description) + len(embed.Footer.Text)
+	for _, field := range embed.Fields {
+		size += len([]rune(field.Name)) + len([]rune(field.Value))
+	}
+	last := len(embed.Fields) - 1
+	assert.True(t, size <= maxDiscordEmbed, size)
+	assert.EqualValues(t, 256, len([]rune(embed.Fields[0].Name)))
+	assert.EqualValues(t, fmt.Sprintf("ほか %d 件", 24-last), embed.Fields[last].Value)
+}
+
+func TestSendErrorToDiscordAsPlainText(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusNoContent, &received)
+	defer server.Close()
+
+	client := DiscordClient{webhookURL: server.URL, httpClient: server.Client()}
+
+	_, err := client.Send(&messengerStub{message: strings.Repeat("a", 2001)})
+
+	assert.Nil(t, err)
+	var payload discordMessage
+	json.Unmarshal(received, &payload)
+	assert.EqualValues(t, strings.Repeat("a", 1999)+"…", payload.Content)
+}
+
+func TestReturnDiscordErrorWithResponseBody(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusBadRequest, &received)
+	defer server.Close()
+
+	client := DiscordClient{webhookURL: server.URL, httpClient: server.Client()}
+
+	sentMessage, err := client.Send(&messengerStub{message: "test"})
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "", sentMessage)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Discord Notification. Could not send message!: 400 Bad Request: response body"), err)
+}
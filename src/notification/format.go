@@ -0,0 +1,38 @@
+package notification
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+)
+
+// costValue displays a cost in the "¥ monthly (¥ yesterday)" format.
+func costValue(invoice *billing.Invoice, monthly float32, yesterday float32) string {
+	return fmt.Sprintf("%s (%s)", invoice.FormatMoney(monthly), invoice.FormatMoney(yesterday))
+}
+
+// exportTimeText displays when the billing data of the Invoice was last exported
+// in the timezone of the billing period.
+func exportTimeText(invoice *billing.Invoice) string {
+	catalog := invoice.Catalog()
+	exportTime := invoice.LastExportTime.In(invoice.BillingPeriod.To.Location()).Format("2006-01-02 15:04 MST")
+	return fmt.Sprintf("%s: %s", catalog.ExportTimeLabel, exportTime)
+}
+
+// dailyAverage returns the daily average of the cost on the days in the billing period
+// other than the most recent date.
+// It returns false if the billing period has no other days.
+func dailyAverage(invoice *billing.Invoice, monthly float32, yesterday float32) (float32, bool) {
+	days := int(invoice.BillingPeriod.To.Sub(invoice.BillingPeriod.From).Hours()/24) + 1
+	if days < 2 {
+		return 0, false
+	}
+	return (monthly - yesterday) / float32(days-1), true
+}
+
+// sectionTitle strips the dashes from a header of the text message
+// (e.g. "🚨 ----- 予算アラート -----" -> "🚨 予算アラート").
+func sectionTitle(header string) string {
+	return strings.Join(strings.Fields(strings.Replace(header, "-----", "", -1)), " ")
+}
@@ -0,0 +1,224 @@
+package notification
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func NewGoogleChatError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Google Chat Notification",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// GoogleChatClient is an object to send a message to a Google Chat space
+// via incoming webhook URL.
+type GoogleChatClient struct {
+	webhookURL string
+	httpClient *http.Client
+}
+
+// NewGoogleChatClient constructs a GoogleChatClient object.
+// The webhook URL is fetched from the environment variable
+// `GOOGLE_CHAT_WEBHOOK_URL` in construction.
+func NewGoogleChatClient() GoogleChatClient {
+	return NewGoogleChatClientWith(config.FromEnv().GoogleChat)
+}
+
+// NewGoogleChatClientWith constructs a GoogleChatClient object with the webhook URL in the settings.
+func NewGoogleChatClientWith(settings config.GoogleChat) GoogleChatClient {
+	return GoogleChatClient{
+		webhookURL: settings.WebhookURL,
+		httpClient: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// Send method receives an object which can be converted into
+// a notification message and sends it to Google Chat.
+//
+// An Invoice is rendered as a card with the costs as key-value widgets,
+// and an error is rendered as a warning card.
+// The other messages are sent as plain text.
+func (c *GoogleChatClient) Send(messenger Messenger) (string, *utils.CustomError) {
+	message := messenger.AsMessage()
+
+	var payload chatMessage
+	invoice, isInvoice := messenger.(*billing.Invoice)
+	failure := failureOf(messenger)
+	switch {
+	case isInvoice && !invoice.HasCustomMessage():
+		payload = chatInvoiceMessage(invoice)
+	case failure != nil:
+		payload = chatWarningMessage(message, failure.Message)
+	default:
+		payload = chatMessage{Text: message}
+	}
+
+	err := postJSON(c.httpClient, c.webhookURL, payload)
+	if err != nil {
+		return "", NewGoogleChatError("Could not send message!", err)
+	}
+	return message, nil
+}
+
+type chatMessage struct {
+	Text    string     `json:"text,omitempty"`
+	CardsV2 []chatCard `json:"cardsV2,omitempty"`
+}
+
+type chatCard struct {
+	CardID string       `json:"cardId"`
+	Card   chatCardBody `json:"card"`
+}
+
+type chatCardBody struct {
+	Header   chatCardHeader `json:"header"`
+	Sections []chatSection  `json:"sections"`
+}
+
+type chatCardHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+type chatSection struct {
+	Header  string       `json:"header,omitempty"`
+	Widgets []chatWidget `json:"widgets"`
+}
+
+// chatWidget is a decoratedText or a textParagraph widget of a card.
+type chatWidget struct {
+	DecoratedText *chatDecoratedText `json:"decoratedText,omitempty"`
+	TextParagraph *chatTextParagraph `json:"textParagraph,omitempty"`
+}
+
+type chatDecoratedText struct {
+	TopLabel string `json:"topLabel"`
+	Text     string `json:"text"`
+}
+
+type chatTextParagraph struct {
+	Text string `json:"text"`
+}
+
+func keyValueWidget(key string, value string) chatWidget {
+	return chatWidget{DecoratedText: &chatDecoratedText{TopLabel: key, Text: value}}
+}
+
+// chatInvoiceMessage renders an Invoice as a card:
+// a header with the billing period, a section with the total cost,
+// sections with the budgets, the anomalies and the forecast,
+// and a section for each breakdown.
+func chatInvoiceMessage(invoice *billing.Invoice) chatMessage {
+	catalog := invoice.Catalog()
+
+	header := chatCardHeader{
+		Title: fmt.Sprintf(catalog.Heading, invoice.BillingPeriod.Format(catalog)),
+	}
+	if !invoice.LastExportTime.IsZero() {
+		header.Subtitle = exportTimeText(invoice)
+	}
+
+	totalWidgets := []chatWidget{
+		keyValueWidget(catalog.MonthlyLabel, invoice.FormatMoney(invoice.Total.Monthly)),
+		keyValueWidget(catalog.YesterdayLabel, invoice.FormatMoney(invoice.Total.Yesterday)),
+	}
+	if invoice.Total.MonthlyCredits != 0 || invoice.Total.YesterdayCredits != 0 {
+		totalWidgets = append(totalWidgets, keyValueWidget(catalog.Credits, costValue(invoice, invoice.Total.MonthlyCredits, invoice.Total.YesterdayCredits)))
+	}
+	sections := []chatSection{{Widgets: totalWidgets}}
+
+	for _, section := range invoice.Highlights() {
+		var widgets []chatWidget
+		for _, item := range section.Items {
+			widgets = append(widgets, keyValueWidget(item.Name, item.Value))
+		}
+		sections = append(sections, chatSection{Header: section.Header, Widgets: widgets})
+	}
+
+	if len(invoice.Services) > 0 {
+		var widgets []chatWidget
+		for _, cost := range invoice.Services {
+			value := costValue(invoice, cost.Monthly, cost.Yesterday)
+			for _, sku := range cost.SKUs {
+				value += fmt.Sprintf("<br>- %s: %s", sku.SKU, invoice.FormatMoney(sku.Monthly))
+			}
+			widgets = append(widgets, keyValueWidget(cost.Service, value))
+		}
+		sections = append(sections, chatSection{Header: catalog.DetailsHeader, Widgets: widgets})
+	}
+
+	if len(invoice.Projects) > 0 {
+		var widgets []chatWidget
+		for _, project := range invoice.Projects {
+			value := costValue(invoice, project.Monthly, project.Yesterday)
+			for _, cost := range project.Services {
+				value += fmt.Sprintf("<br>- %s: %s", cost.Service, invoice.FormatMoney(cost.Monthly))
+			}
+			widgets = append(widgets, keyValueWidget(project.DisplayName(), value))
+		}
+		sections = append(sections, chatSection{Header: catalog.ProjectsHeader, Widgets: widgets})
+	}
+
+	for i, label := range invoice.Labels {
+		if i == 0 || label.Key != invoice.Labels[i-1].Key {
+			sections = append(sections, chatSection{Header: fmt.Sprintf(catalog.LabelsHeader, label.Key)})
+		}
+		value := label.Value
+		if value == "" {
+			value = catalog.UnlabelledValue
+		}
+		last := len(sections) - 1
+		sections[last].Widgets = append(sections[last].Widgets, keyValueWidget(value, costValue(invoice, label.Monthly, label.Yesterday)))
+	}
+
+	if len(invoice.Credits) > 0 {
+		var widgets []chatWidget
+		for _, credit := range invoice.Credits {
+			widgets = append(widgets, keyValueWidget(credit.Type, costValue(invoice, credit.Monthly, credit.Yesterday)))
+		}
+		sections = append(sections, chatSection{Header: catalog.CreditsHeader, Widgets: widgets})
+	}
+
+	return chatMessage{
+		CardsV2: []chatCard{
+			{CardID: "invoice", Card: chatCardBody{Header: header, Sections: sections}},
+		},
+	}
+}
+
+// failureOf returns the CustomError to notify, or nil if the message is not an error.
+func failureOf(messenger Messenger) *utils.CustomError {
+	switch failure := messenger.(type) {
+	case *utils.CustomError:
+		return failure
+	case *billing.ErrorNotice:
+		return failure.Err
+	}
+	return nil
+}
+
+// chatWarningMessage renders an error as a warning card
+// with the notification message as the title and the error message as the body.
+// The wrapped error is not shown because it may contain the details of the query.
+func chatWarningMessage(message string, detail string) chatMessage {
+	return chatMessage{
+		CardsV2: []chatCard{
+			{
+				CardID: "warning",
+				Card: chatCardBody{
+					Header: chatCardHeader{Title: "⚠️ " + message},
+					Sections: []chatSection{
+						{Widgets: []chatWidget{{TextParagraph: &chatTextParagraph{Text: detail}}}},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,103 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func TestSendInvoiceToGoogleChatAsCard(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusOK, &received)
+	defer server.Close()
+
+	client := GoogleChatClient{webhookURL: server.URL, httpClient: server.Client()}
+	invoice := newInputInvoice()
+
+	sentMessage, err := client.Send(invoice)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, invoice.AsMessage(), sentMessage)
+
+	var payload chatMessage
+	json.Unmarshal(received, &payload)
+	card := payload.CardsV2[0].Card
+	assert.EqualValues(t, "5/1 ~ 5/8 の GCP 利用料金", card.Header.Title)
+	assert.EqualValues(t, "データ更新日時: 2021-05-09 03:04 UTC", card.Header.Subtitle)
+	assert.EqualValues(t, chatDecoratedText{TopLabel: "月間合計", Text: "¥ 1,000.07"}, *card.Sections[0].Widgets[0].DecoratedText)
+	assert.EqualValues(t, "----- 内訳 -----", card.Sections[1].Header)
+	assert.EqualValues(t, chatDecoratedText{TopLabel: "Cloud SQL", Text: "¥ 1,000 (¥ 400)"}, *card.Sections[1].Widgets[0].DecoratedText)
+}
+
+func TestRenderHighlightsInGoogleChatCard(t *testing.T) {
+	sections := chatInvoiceMessage(newHighlightedInputInvoice()).CardsV2[0].Card.Sections
+
+	assert.EqualValues(t, "🚨 ----- 予算アラート -----", sections[1].Header)
+	assert.EqualValues(t, chatDecoratedText{TopLabel: "Total", Text: "予算の 80% を超えました (¥ 1,000.07 / ¥ 1,200, 83.3%)"}, *sections[1].Widgets[0].DecoratedText)
+	assert.EqualValues(t, "----- 予算 -----", sections[2].Header)
+	assert.EqualValues(t, "⚠️ ----- 異常値 -----", sections[3].Header)
+	assert.EqualValues(t, "----- 月末予測 -----", sections[4].Header)
+	assert.EqualValues(t, chatDecoratedText{TopLabel: "Cloud SQL", Text: "¥ 3,875"}, *sections[4].Widgets[1].DecoratedText)
+	assert.EqualValues(t, "----- 内訳 -----", sections[5].Header)
+}
+
+func TestRenderCreditsByTypeInGoogleChatCard(t *testing.T) {
+	sections := chatInvoiceMessage(newCreditedInputInvoice()).CardsV2[0].Card.Sections
+
+	credits := sections[len(sections)-1]
+	assert.EqualValues(t, "----- クレジット内訳 -----", credits.Header)
+	assert.EqualValues(t, chatDecoratedText{TopLabel: "SUSTAINED_USAGE_DISCOUNT", Text: "¥ -100 (¥ -40)"}, *credits.Widgets[0].DecoratedText)
+	assert.EqualValues(t, chatDecoratedText{TopLabel: "PROMOTION", Text: "¥ -50 (¥ -20)"}, *credits.Widgets[1].DecoratedText)
+}
+
+func TestSendErrorToGoogleChatAsWarningCard(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusOK, &received)
+	defer server.Close()
+
+	client := GoogleChatClient{webhookURL: server.URL, httpClient: server.Client()}
+	inputError := &utils.CustomError{Process: "Data Loading", Message: "Failed!", Err: fmt.Errorf("timeout")}
+
+	sentMessage, err := client.Send(inputError)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "Process Failed at Data Loading!", sentMessage)
+
+	var payload chatMessage
+	json.Unmarshal(received, &payload)
+	card := payload.CardsV2[0].Card
+	assert.EqualValues(t, "⚠️ Process Failed at Data Loading!", card.Header.Title)
+	assert.EqualValues(t, "Failed!", card.Sections[0].Widgets[0].TextParagraph.Text)
+}
+
+func TestSendOtherMessageToGoogleChatAsPlainText(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusOK, &received)
+	defer server.Close()
+
+	client := GoogleChatClient{webhookURL: server.URL, httpClient: server.Client()}
+
+	_, err := client.Send(&messengerStub{message: "test"})
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"text": "test"}`, string(received))
+}
+
+func TestReturnGoogleChatErrorWithResponseBody(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusNotFound, &received)
+	defer server.Close()
+
+	client := GoogleChatClient{webhookURL: server.URL, httpClient: server.Client()}
+
+	sentMessage, err := client.Send(&messengerStub{message: "test"})
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "", sentMessage)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Google Chat Notification. Could not send message!: 404 Not Found: response body"), err)
+}
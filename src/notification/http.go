@@ -0,0 +1,51 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Timeout of HTTP requests to the notification services.
+const httpTimeout = 30 * time.Second
+
+// Maximum size of a response body read into an error message.
+const maxResponseBytes = 4096
+
+// postJSON sends the payload as JSON to the URL.
+// If the response status is not 2xx, an error including the response body is returned.
+func postJSON(httpClient *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postBody(httpClient, url, body, nil)
+}
+
+// postBody sends the JSON body to the URL with the additional headers.
+func postBody(httpClient *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", resp.Status, string(respBody))
+	}
+	return nil
+}
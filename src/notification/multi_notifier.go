@@ -0,0 +1,275 @@
+package notification
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+// Notifier is implemented by the clients sending a notification message.
+type Notifier interface {
+	Send(messenger Messenger) (string, *utils.CustomError)
+}
+
+// SelectiveNotifier is implemented by the clients sending only some kinds of messages
+// (e.g. PagerDutyClient sends only the cost reports).
+// MultiNotifier skips the destination for the other messages.
+type SelectiveNotifier interface {
+	Notifier
+	Accepts(messenger Messenger) bool
+}
+
+// Policies deciding whether MultiNotifier fails.
+const (
+	FailWhenAllFail = "all" // fail only when all the destinations fail
+	FailWhenAnyFail = "any" // fail when any of the destinations fails
+)
+
+// notifierConstructors construct the client of each destination with the settings of a report.
+var notifierConstructors = map[string]func(settings config.Report) Notifier{
+	"slack": func(settings config.Report) Notifier {
+		// The Web API client is used if a bot token is set,
+		// otherwise the incoming webhook client is used.
+		if settings.Slack.BotToken != "" {
+			client := NewSlackBotClientWith(settings.Slack)
+			return &client
+		}
+		client := NewSlackClientWith(settings.Slack)
+		return &client
+	},
+	"teams": func(settings config.Report) Notifier {
+		client := NewTeamsClientWith(settings.Teams)
+		return &client
+	},
+	"google_chat": func(settings config.Report) Notifier {
+		client := NewGoogleChatClientWith(settings.GoogleChat)
+		return &client
+	},
+	"discord": func(settings config.Report) Notifier {
+		client := NewDiscordClientWith(settings.Discord)
+		return &client
+	},
+	"email": func(settings config.Report) Notifier {
+		client := NewSMTPClientWith(settings.Email)
+		return &client
+	},
+	"webhook": func(settings config.Report) Notifier {
+		client := NewWebhookClientWith(settings.Webhook)
+		return &client
+	},
+	"pagerduty": func(settings config.Report) Notifier {
+		client := NewPagerDutyClientWith(settings.PagerDuty, settings.Name)
+		return &client
+	},
+}
+
+// RegisterNotifier adds a destination which can be selected by the name
+// or replaces an existing one.
+// The name is also accepted in `notifier.destinations` of the config package.
+func RegisterNotifier(name string, constructor func() Notifier) {
+	notifierConstructors[name] = func(config.Report) Notifier {
+		return constructor()
+	}
+	config.RegisterDestination(name)
+}
+
+// NewNotifier constructs the client of the destination registered with the name
+// from the environment variables.
+func NewNotifier(name string) (Notifier, bool) {
+	return newNotifierWith(name, config.FromEnv())
+}
+
+func newNotifierWith(name string, settings config.Report) (Notifier, bool) {
+	constructor, ok := notifierConstructors[name]
+	if !ok {
+		return nil, false
+	}
+	return constructor(settings), true
+}
+
+// HasNotifier reports whether a destination is registered with the name.
+func HasNotifier(name string) bool {
+	_, ok := notifierConstructors[name]
+	return ok
+}
+
+// DryRunNotifier is a Notifier which only logs the message instead of sending it.
+type DryRunNotifier struct{}
+
+// Send method logs the message and returns it.
+func (n *DryRunNotifier) Send(messenger Messenger) (string, *utils.CustomError) {
+	message := messenger.AsMessage()
+	log.Printf("Dry run: the message is not sent.\n%s", message)
+	return message, nil
+}
+
+func NewMultiNotifierError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Notification",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// Destination is a named client to send notification messages.
+type Destination struct {
+	Name     string
+	Notifier Notifier
+}
+
+// DestinationResult contains the result of sending a message to a destination.
+// Skipped is true if the destination does not accept the message and it is not sent.
+type DestinationResult struct {
+	Name    string
+	Message string
+	Err     *utils.CustomError
+	Skipped bool
+}
+
+// MultiNotifier is an object to send the same message to multiple destinations.
+type MultiNotifier struct {
+	destinations []Destination
+	policy       string
+	skipped      map[string]bool // names of the destinations not to send any message to
+}
+
+// NewMultiNotifier constructs a MultiNotifier from the environment variables.
+//
+// `NOTIFIER` ... the comma-separated names of the destinations
+// (`slack` (default), `teams`, `google_chat`, `discord`, `email`, `webhook` or `pagerduty`).
+// Unknown names are ignored.
+//
+// `NOTIFIER_FAILURE_POLICY` ... `all` (default) to fail only when all the destinations fail,
+// or `any` to fail when any of them fails.
+func NewMultiNotifier() MultiNotifier {
+	return NewMultiNotifierFromConfig(config.FromEnv())
+}
+
+// NewMultiNotifierFromConfig constructs a MultiNotifier with the destinations and the failure policy
+// in the settings of a report.
+// Each destination is constructed with its settings in the report.
+//
+// The destinations are validated by the config package,
+// but unknown names (e.g. from the environment variables) are logged and ignored.
+func NewMultiNotifierFromConfig(settings config.Report) MultiNotifier {
+	var destinations []Destination
+	for _, name := range settings.Notifier.Destinations {
+		notifier, ok := newNotifierWith(name, settings)
+		if !ok {
+			log.Printf("Unknown notifier '%s' is ignored.", name)
+			continue
+		}
+		destinations = append(destinations, Destination{Name: name, Notifier: notifier})
+	}
+	if len(destinations) == 0 {
+		notifier, _ := newNotifierWith("slack", settings)
+		destinations = append(destinations, Destination{Name: "slack", Notifier: notifier})
+	}
+
+	policy := settings.Notifier.FailurePolicy
+	switch policy {
+	case FailWhenAllFail, FailWhenAnyFail:
+	default:
+		log.Printf("Invalid notifier failure policy '%s'. '%s' is used instead.", policy, FailWhenAllFail)
+		policy = FailWhenAllFail
+	}
+	return NewMultiNotifierWith(destinations, policy)
+}
+
+// NewMultiNotifierWith constructs a MultiNotifier with the destinations and the failure policy.
+func NewMultiNotifierWith(destinations []Destination, policy string) MultiNotifier {
+	return MultiNotifier{destinations: destinations, policy: policy}
+}
+
+// Skip method makes the destination of the name skipped for all the messages.
+func (m *MultiNotifier) Skip(name string) {
+	if m.skipped == nil {
+		m.skipped = map[string]bool{}
+	}
+	m.skipped[name] = true
+}
+
+// Send method sends the message to all the destinations concurrently.
+//
+// It returns an error listing the failed destinations
+// when all of them fail, or when any of them fails with FailWhenAnyFail policy.
+// The skipped destinations are neither succeeded nor failed,
+// and it fails if all the destinations are skipped.
+func (m *MultiNotifier) Send(messenger Messenger) (string, *utils.CustomError) {
+	var results []DestinationResult
+	var skipped []string
+	for _, result := range m.SendAll(messenger) {
+		if result.Skipped {
+			log.Printf("The message is not sent to %s.", result.Name)
+			skipped = append(skipped, result.Name)
+			continue
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return "", NewMultiNotifierError(
+			"No destination accepts the message!",
+			fmt.Errorf("skipped: %s", strings.Join(skipped, ", ")),
+		)
+	}
+
+	var message string
+	var failures []string
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("Failed in sending to %s!: %s", result.Name, result.Err.Error())
+			failures = append(failures, fmt.Sprintf("%s: %s", result.Name, result.Err.Error()))
+			continue
+		}
+		if message == "" {
+			message = result.Message
+		}
+	}
+
+	if len(failures) == 0 || (m.policy != FailWhenAnyFail && len(failures) < len(results)) {
+		return message, nil
+	}
+	if len(results) == 1 {
+		return "", results[0].Err
+	}
+	return "", NewMultiNotifierError(
+		fmt.Sprintf("Failed in sending to %d of %d destinations!", len(failures), len(results)),
+		fmt.Errorf("%s", strings.Join(failures, "; ")),
+	)
+}
+
+// SendAll method sends the message to all the destinations concurrently
+// and returns the results in the order of the destinations.
+// A panic in sending to a destination is recovered as the error of the destination.
+func (m *MultiNotifier) SendAll(messenger Messenger) []DestinationResult {
+	results := make([]DestinationResult, len(m.destinations))
+
+	var wg sync.WaitGroup
+	for i, destination := range m.destinations {
+		if selective, ok := destination.Notifier.(SelectiveNotifier); m.skipped[destination.Name] || ok && !selective.Accepts(messenger) {
+			results[i] = DestinationResult{Name: destination.Name, Skipped: true}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, destination Destination) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					results[i] = DestinationResult{
+						Name: destination.Name,
+						Err:  NewMultiNotifierError("Panic in sending the message!", fmt.Errorf("%v", r)),
+					}
+				}
+			}()
+			message, err := destination.Notifier.Send(messenger)
+			results[i] = DestinationResult{Name: destination.Name, Message: message, Err: err}
+		}(i, destination)
+	}
+	wg.Wait()
+	return results
+}
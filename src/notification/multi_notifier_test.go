@@ -0,0 +1,216 @@
+package notification
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+type notifierStub struct {
+	err *utils.CustomError
+}
+
+func (n *notifierStub) Send(messenger Messenger) (string, *utils.CustomError) {
+	if n.err != nil {
+		return "", n.err
+	}
+	return messenger.AsMessage(), nil
+}
+
+func newFailingNotifierStub(name string) *notifierStub {
+	return &notifierStub{err: &utils.CustomError{Process: name, Message: "Failed!", Err: fmt.Errorf("error")}}
+}
+
+func TestSendToAllDestinations(t *testing.T) {
+	multiNotifier := NewMultiNotifierWith([]Destination{
+		{Name: "slack", Notifier: &notifierStub{}},
+		{Name: "email", Notifier: newFailingNotifierStub("Email Notification")},
+	}, FailWhenAllFail)
+
+	results := multiNotifier.SendAll(&messengerStub{message: "test"})
+
+	assert.EqualValues(t, "slack", results[0].Name)
+	assert.EqualValues(t, "test", results[0].Message)
+	assert.Nil(t, results[0].Err)
+	assert.EqualValues(t, "email", results[1].Name)
+	assert.NotNil(t, results[1].Err)
+}
+
+func TestSucceedUnlessAllDestinationsFail(t *testing.T) {
+	multiNotifier := NewMultiNotifierWith([]Destination{
+		{Name: "slack", Notifier: newFailingNotifierStub("Slack Notification")},
+		{Name: "email", Notifier: &notifierStub{}},
+	}, FailWhenAllFail)
+
+	sentMessage, err := multiNotifier.Send(&messengerStub{message: "test"})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "test", sentMessage)
+}
+
+func TestFailWhenAllDestinationsFail(t *testing.T) {
+	multiNotifier := NewMultiNotifierWith([]Destination{
+		{Name: "slack", Notifier: newFailingNotifierStub("Slack Notification")},
+		{Name: "email", Notifier: newFailingNotifierStub("Email Notification")},
+	}, FailWhenAllFail)
+
+	sentMessage, err := multiNotifier.Send(&messengerStub{message: "test"})
+
+	assert.EqualValues(t, "", sentMessage)
+	assert.EqualValues(t,
+		"Error in Notification. Failed in sending to 2 of 2 destinations!: slack: Error in Slack Notification. Failed!: error; email: Error in Email Notification. Failed!: error",
+		err.Error(),
+	)
+}
+
+func TestFailWhenAnyDestinationFailsWithAnyPolicy(t *testing.T) {
+	multiNotifier := NewMultiNotifierWith([]Destination{
+		{Name: "slack", Notifier: &notifierStub{}},
+		{Name: "email", Notifier: newFailingNotifierStub("Email Notification")},
+	}, FailWhenAnyFail)
+
+	_, err := multiNotifier.Send(&messengerStub{message: "test"})
+
+	assert.EqualValues(t,
+		"Error in Notification. Failed in sending to 1 of 2 destinations!: email: Error in Email Notification. Failed!: error",
+		err.Error(),
+	)
+}
+
+func TestReturnErrorOfSingleDestinationAsItIs(t *testing.T) {
+	failing := newFailingNotifierStub("Slack Notification")
+	multiNotifier := NewMultiNotifierWith([]Destination{{Name: "slack", Notifier: failing}}, FailWhenAllFail)
+
+	_, err := multiNotifier.Send(&messengerStub{message: "test"})
+
+	assert.Equal(t, failing.err, err)
+}
+
+type panickingNotifierStub struct{}
+
+func (n *panickingNotifierStub) Send(messenger Messenger) (string, *utils.CustomError) {
+	panic("something went wrong")
+}
+
+func TestRecoverFromPanicInDestination(t *testing.T) {
+	multiNotifier := NewMultiNotifierWith([]Destination{
+		{Name: "slack", Notifier: &notifierStub{}},
+		{Name: "email", Notifier: &panickingNotifierStub{}},
+	}, FailWhenAnyFail)
+
+	_, err := multiNotifier.Send(&messengerStub{message: "test"})
+
+	assert.EqualValues(t,
+		"Error in Notification. Failed in sending to 1 of 2 destinations!: email: Error in Notification. Panic in sending the message!: something went wrong",
+		err.Error(),
+	)
+}
+
+func TestSkipDestinationNotAcceptingMessage(t *testing.T) {
+	multiNotifier := NewMultiNotifierWith([]Destination{
+		{Name: "slack", Notifier: newFailingNotifierStub("Slack Notification")},
+		{Name: "pagerduty", Notifier: &PagerDutyClient{}},
+	}, FailWhenAllFail)
+
+	results := multiNotifier.SendAll(&messengerStub{message: "Process Failed!"})
+	assert.True(t, results[1].Skipped)
+
+	_, err := multiNotifier.Send(&messengerStub{message: "Process Failed!"})
+
+	assert.EqualValues(t, "Error in Slack Notification. Failed!: error", err.Error())
+}
+
+func TestFailWhenAllDestinationsAreSkipped(t *testing.T) {
+	multiNotifier := NewMultiNotifierWith([]Destination{{Name: "pagerduty", Notifier: &PagerDutyClient{}}}, FailWhenAllFail)
+
+	_, err := multiNotifier.Send(&messengerStub{message: "Process Failed!"})
+
+	assert.EqualValues(t, "Error in Notification. No destination accepts the message!: skipped: pagerduty", err.Error())
+}
+
+func TestSkipDestinationDesignatedToSkip(t *testing.T) {
+	multiNotifier := NewMultiNotifierWith([]Destination{
+		{Name: "slack", Notifier: &notifierStub{}},
+		{Name: "pagerduty", Notifier: newFailingNotifierStub("PagerDuty Alert")},
+	}, FailWhenAnyFail)
+	multiNotifier.Skip("pagerduty")
+
+	results := multiNotifier.SendAll(&messengerStub{message: "test"})
+	assert.False(t, results[0].Skipped)
+	assert.True(t, results[1].Skipped)
+
+	_, err := multiNotifier.Send(&messengerStub{message: "test"})
+	assert.Nil(t, err)
+}
+
+func TestConstructDestinationsFromEnvironmentVariables(t *testing.T) {
+	os.Setenv("NOTIFIER", "slack, unknown ,webhook")
+	os.Setenv("NOTIFIER_FAILURE_POLICY", "ANY")
+	defer os.Unsetenv("NOTIFIER")
+	defer os.Unsetenv("NOTIFIER_FAILURE_POLICY")
+
+	multiNotifier := NewMultiNotifier()
+
+	assert.Len(t, multiNotifier.destinations, 2)
+	assert.IsType(t, &SlackClient{}, multiNotifier.destinations[0].Notifier)
+	assert.IsType(t, &WebhookClient{}, multiNotifier.destinations[1].Notifier)
+	assert.EqualValues(t, FailWhenAnyFail, multiNotifier.policy)
+}
+
+func TestUseSlackWhenNoDestinationIsDesignated(t *testing.T) {
+	multiNotifier := NewMultiNotifier()
+
+	assert.Len(t, multiNotifier.destinations, 1)
+	assert.EqualValues(t, "slack", multiNotifier.destinations[0].Name)
+	assert.EqualValues(t, FailWhenAllFail, multiNotifier.policy)
+}
+
+func TestConstructDestinationsFromConfig(t *testing.T) {
+	os.Setenv("TEAMS_WEBHOOK_URL", "https://example.com/global-teams")
+	defer os.Unsetenv("TEAMS_WEBHOOK_URL")
+	settings := config.Report{
+		Slack:    config.Slack{BotToken: "xoxb-token", Channels: []string{"C01"}},
+		Teams:    config.Teams{WebhookURL: "https://example.com/report-teams"},
+		Webhook:  config.Webhook{URL: "https://example.com/report-costs", Secret: "secret"},
+		Notifier: config.Notifier{Destinations: []string{"slack", "teams", "webhook"}, FailurePolicy: FailWhenAnyFail},
+	}
+
+	multiNotifier := NewMultiNotifierFromConfig(settings)
+
+	assert.Len(t, multiNotifier.destinations, 3)
+	assert.IsType(t, &SlackBotClient{}, multiNotifier.destinations[0].Notifier)
+	assert.EqualValues(t, []string{"C01"}, multiNotifier.destinations[0].Notifier.(*SlackBotClient).channels)
+	assert.IsType(t, &TeamsClient{}, multiNotifier.destinations[1].Notifier)
+	assert.EqualValues(t, "https://example.com/report-teams", multiNotifier.destinations[1].Notifier.(*TeamsClient).webhookURL)
+	assert.IsType(t, &WebhookClient{}, multiNotifier.destinations[2].Notifier)
+	assert.EqualValues(t, "https://example.com/report-costs", multiNotifier.destinations[2].Notifier.(*WebhookClient).url)
+	assert.EqualValues(t, "secret", multiNotifier.destinations[2].Notifier.(*WebhookClient).secret)
+	assert.EqualValues(t, FailWhenAnyFail, multiNotifier.policy)
+}
+
+func TestConstructPagerDutyClientOfReport(t *testing.T) {
+	settings := config.Report{
+		Name:      "finance",
+		PagerDuty: config.PagerDuty{RoutingKey: "key"},
+		Notifier:  config.Notifier{Destinations: []string{"pagerduty"}, FailurePolicy: FailWhenAllFail},
+	}
+
+	multiNotifier := NewMultiNotifierFromConfig(settings)
+
+	assert.EqualValues(t, "finance", multiNotifier.destinations[0].Notifier.(*PagerDutyClient).report)
+}
+
+func TestDryRunNotifierReturnsMessageWithoutSending(t *testing.T) {
+	notifier := DryRunNotifier{}
+
+	sentMessage, err := notifier.Send(newInputInvoice())
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, newInputInvoice().AsMessage(), sentMessage)
+	assert.True(t, HasNotifier("webhook"))
+	assert.False(t, HasNotifier("fax"))
+}
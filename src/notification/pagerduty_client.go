@@ -0,0 +1,184 @@
+package notification
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+// PagerDutyEventsURL is the endpoint of PagerDuty Events API v2.
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// SpikeDedupKey returns the key identifying the incident of the cost spike
+// of the report on the date in the PagerDuty service,
+// e.g. "gcp-cost-spike/finance/2021-08-06".
+func SpikeDedupKey(report string, date time.Time) string {
+	if report == "" {
+		report = "default"
+	}
+	return fmt.Sprintf("gcp-cost-spike/%s/%s", report, date.Format("2006-01-02"))
+}
+
+func NewPagerDutyError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "PagerDuty Alert",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// SpikeCondition decides whether the cost on the most recent date is a spike.
+// A zero value disables the condition.
+type SpikeCondition struct {
+	Threshold float32 // Total cost on the most recent date above which an alert is triggered
+	Ratio     float32 // Ratio of the cost on the most recent date to the daily average above which an alert is triggered
+}
+
+// IsSpike method checks whether the Invoice meets any of the conditions
+// and returns the reason if it does.
+func (s *SpikeCondition) IsSpike(invoice *billing.Invoice) (string, bool) {
+	yesterday := invoice.Total.Yesterday
+	if s.Threshold > 0 && yesterday > s.Threshold {
+		return fmt.Sprintf("%s exceeds the threshold %s", invoice.FormatMoney(yesterday), invoice.FormatMoney(s.Threshold)), true
+	}
+	average, ok := dailyAverage(invoice, invoice.Total.Monthly, yesterday)
+	if s.Ratio > 0 && ok && average > 0 && yesterday > average*s.Ratio {
+		return fmt.Sprintf("%s is %.1f times the daily average %s", invoice.FormatMoney(yesterday), yesterday/average, invoice.FormatMoney(average)), true
+	}
+	return "", false
+}
+
+// PagerDutyClient is an object to trigger a PagerDuty incident
+// when the cost spikes and resolve it when the cost is back to normal.
+type PagerDutyClient struct {
+	report     string // name of the report in the dedup keys
+	routingKey string
+	severity   string
+	condition  SpikeCondition
+	eventsURL  string
+	httpClient *http.Client
+}
+
+// NewPagerDutyClient constructs a PagerDutyClient from the environment variables.
+//
+// `PAGERDUTY_ROUTING_KEY` ... the integration key of the PagerDuty service.
+//
+// `PAGERDUTY_SEVERITY` ... the severity of the incident (default: warning).
+//
+// `SPIKE_THRESHOLD` ... the total cost on the most recent date above which an alert is triggered.
+//
+// `SPIKE_RATIO` ... the ratio of the cost on the most recent date to the daily average
+// of the billing period above which an alert is triggered (e.g. 2.0).
+func NewPagerDutyClient() PagerDutyClient {
+	return NewPagerDutyClientWith(config.FromEnv().PagerDuty, "")
+}
+
+// NewPagerDutyClientWith constructs a PagerDutyClient of the report with the routing key, the severity
+// and the spike condition in the settings.
+// A negative condition is logged and disabled.
+func NewPagerDutyClientWith(settings config.PagerDuty, report string) PagerDutyClient {
+	severity := settings.Severity
+	if severity == "" {
+		severity = "warning"
+	}
+	return PagerDutyClient{
+		report:     report,
+		routingKey: settings.RoutingKey,
+		severity:   severity,
+		condition: SpikeCondition{
+			Threshold: positiveCondition("spike threshold", settings.SpikeThreshold),
+			Ratio:     positiveCondition("spike ratio", settings.SpikeRatio),
+		},
+		eventsURL:  PagerDutyEventsURL,
+		httpClient: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+func positiveCondition(name string, value float64) float32 {
+	if value < 0 {
+		log.Printf("Invalid %s '%g'. The condition is disabled.", name, value)
+		return 0
+	}
+	return float32(value)
+}
+
+// Send method triggers an incident if the Invoice meets the spike condition,
+// otherwise resolves the incident of the day before.
+//
+// The incidents are deduplicated per report and date (see SpikeDedupKey),
+// so the reports sharing the routing key do not resolve the incidents of each other.
+// A spike on consecutive days also resolves the incident of the day before,
+// so that only the incident of the latest spike is open.
+// PagerDuty ignores the resolve event when no incident is open.
+//
+// Messages other than an Invoice (e.g. errors) are not sent (see Accepts).
+func (c *PagerDutyClient) Send(messenger Messenger) (string, *utils.CustomError) {
+	invoice, ok := messenger.(*billing.Invoice)
+	if !ok {
+		return "", nil
+	}
+
+	reportingDate := invoice.BillingPeriod.To
+	resolve := pagerDutyEvent{
+		RoutingKey:  c.routingKey,
+		EventAction: "resolve",
+		DedupKey:    SpikeDedupKey(c.report, reportingDate.AddDate(0, 0, -1)),
+	}
+	events := []pagerDutyEvent{resolve}
+	message := fmt.Sprintf("GCP cost on %s is back to normal", reportingDate.Format("2006-01-02"))
+	if reason, spike := c.condition.IsSpike(invoice); spike {
+		message = fmt.Sprintf("GCP cost spike on %s: %s", reportingDate.Format("2006-01-02"), reason)
+		trigger := pagerDutyEvent{
+			RoutingKey:  c.routingKey,
+			EventAction: "trigger",
+			DedupKey:    SpikeDedupKey(c.report, reportingDate),
+			Payload: &pagerDutyPayload{
+				Summary:   message,
+				Source:    "gcp-cost-notification",
+				Severity:  c.severity,
+				Timestamp: time.Now().UTC().Format(time.RFC3339),
+				CustomDetails: map[string]string{
+					"period":    invoice.BillingPeriod.Format(invoice.Catalog()),
+					"monthly":   invoice.FormatMoney(invoice.Total.Monthly),
+					"yesterday": invoice.FormatMoney(invoice.Total.Yesterday),
+				},
+			},
+		}
+		// The new incident is triggered before the old one is resolved not to miss the spike.
+		events = []pagerDutyEvent{trigger, resolve}
+	}
+
+	for _, event := range events {
+		if err := postJSON(c.httpClient, c.eventsURL, event); err != nil {
+			return "", NewPagerDutyError("Could not send event!", err)
+		}
+	}
+	return message, nil
+}
+
+// Accepts method returns true only for an Invoice,
+// since the incidents are about the cost spikes and not about the errors.
+func (c *PagerDutyClient) Accepts(messenger Messenger) bool {
+	_, ok := messenger.(*billing.Invoice)
+	return ok
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp"`
+	CustomDetails map[string]string `json:"custom_details"`
+}
@@ -0,0 +1,159 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+)
+
+func TestDetectSpikeByThreshold(t *testing.T) {
+	condition := SpikeCondition{Threshold: 300}
+
+	reason, spike := condition.IsSpike(newInputInvoice())
+
+	assert.True(t, spike)
+	assert.EqualValues(t, "¥ 400 exceeds the threshold ¥ 300", reason)
+}
+
+func TestDetectSpikeByRatioToDailyAverage(t *testing.T) {
+	condition := SpikeCondition{Ratio: 2}
+	invoice := newInputInvoice()
+	invoice.Total = &billing.Cost{Monthly: 1100, Yesterday: 400}
+
+	reason, spike := condition.IsSpike(invoice)
+
+	assert.True(t, spike)
+	assert.EqualValues(t, "¥ 400 is 4.0 times the daily average ¥ 100", reason)
+
+	invoice.Total = &billing.Cost{Monthly: 1600, Yesterday: 300}
+	_, spike = condition.IsSpike(invoice)
+	assert.False(t, spike)
+}
+
+// newPagerDutyServerStub records the events sent to the server.
+func newPagerDutyServerStub(events *[]pagerDutyEvent) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event pagerDutyEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		*events = append(*events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+func TestTriggerIncidentOnSpike(t *testing.T) {
+	var events []pagerDutyEvent
+	server := newPagerDutyServerStub(&events)
+	defer server.Close()
+
+	client := PagerDutyClient{
+		report:     "finance",
+		routingKey: "key",
+		severity:   "warning",
+		condition:  SpikeCondition{Threshold: 300},
+		eventsURL:  server.URL,
+		httpClient: server.Client(),
+	}
+
+	sentMessage, err := client.Send(newInputInvoice())
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "GCP cost spike on 2021-05-08: ¥ 400 exceeds the threshold ¥ 300", sentMessage)
+
+	assert.Len(t, events, 2)
+	event := events[0]
+	assert.EqualValues(t, "key", event.RoutingKey)
+	assert.EqualValues(t, "trigger", event.EventAction)
+	assert.EqualValues(t, "gcp-cost-spike/finance/2021-05-08", event.DedupKey)
+	assert.EqualValues(t, sentMessage, event.Payload.Summary)
+	assert.EqualValues(t, "warning", event.Payload.Severity)
+	assert.EqualValues(t, "¥ 400", event.Payload.CustomDetails["yesterday"])
+	assert.EqualValues(t, pagerDutyEvent{RoutingKey: "key", EventAction: "resolve", DedupKey: "gcp-cost-spike/finance/2021-05-07"}, events[1])
+}
+
+func TestResolveIncidentOfPreviousDayWhenBackToNormal(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusAccepted, &received)
+	defer server.Close()
+
+	client := PagerDutyClient{
+		routingKey: "key",
+		condition:  SpikeCondition{Threshold: 500},
+		eventsURL:  server.URL,
+		httpClient: server.Client(),
+	}
+
+	_, err := client.Send(newInputInvoice())
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"routing_key": "key", "event_action": "resolve", "dedup_key": "gcp-cost-spike/default/2021-05-07"}`, string(received))
+}
+
+func TestKeepOnlyIncidentOfLatestSpike(t *testing.T) {
+	var events []pagerDutyEvent
+	server := newPagerDutyServerStub(&events)
+	defer server.Close()
+
+	client := PagerDutyClient{
+		report:     "finance",
+		routingKey: "key",
+		condition:  SpikeCondition{Threshold: 300},
+		eventsURL:  server.URL,
+		httpClient: server.Client(),
+	}
+
+	spike := newInputInvoice()
+	nextSpike := newInputInvoice()
+	nextSpike.BillingPeriod.To = nextSpike.BillingPeriod.To.AddDate(0, 0, 1)
+	normal := newInputInvoice()
+	normal.BillingPeriod.To = normal.BillingPeriod.To.AddDate(0, 0, 2)
+	normal.Total = &billing.Cost{Monthly: 1100, Yesterday: 100}
+
+	for _, invoice := range []*billing.Invoice{spike, nextSpike, normal} {
+		_, err := client.Send(invoice)
+		assert.Nil(t, err)
+	}
+
+	var actions []string
+	for _, event := range events {
+		actions = append(actions, event.EventAction+" "+event.DedupKey)
+	}
+	assert.EqualValues(t, []string{
+		"trigger gcp-cost-spike/finance/2021-05-08",
+		"resolve gcp-cost-spike/finance/2021-05-07",
+		"trigger gcp-cost-spike/finance/2021-05-09",
+		"resolve gcp-cost-spike/finance/2021-05-08",
+		"resolve gcp-cost-spike/finance/2021-05-09",
+	}, actions)
+}
+
+func TestSkipMessagesOtherThanInvoice(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusAccepted, &received)
+	defer server.Close()
+
+	client := PagerDutyClient{eventsURL: server.URL, httpClient: server.Client()}
+
+	sentMessage, err := client.Send(&messengerStub{message: "Process Failed!"})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "", sentMessage)
+	assert.Nil(t, received)
+}
+
+func TestReturnPagerDutyErrorWithResponseBody(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusBadRequest, &received)
+	defer server.Close()
+
+	client := PagerDutyClient{eventsURL: server.URL, httpClient: server.Client()}
+
+	_, err := client.Send(newInputInvoice())
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in PagerDuty Alert. Could not send event!: 400 Bad Request: response body"), err)
+}
@@ -0,0 +1,143 @@
+package notification
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+)
+
+// Slack allows up to 50 blocks in a message and 10 fields in a section block.
+const (
+	maxSlackBlocks        = 50
+	maxSlackSectionFields = 10
+)
+
+// invoiceBlocks renders an Invoice as Slack Block Kit blocks:
+// a header with the billing period, a section with the total cost,
+// sections with the budgets, the anomalies and the forecast,
+// sections with the breakdowns, and a context with the data freshness.
+//
+// The breakdowns beyond the block limit are omitted with a context of the number of them.
+func invoiceBlocks(invoice *billing.Invoice) []slack.Block {
+	catalog := invoice.Catalog()
+
+	heading := fmt.Sprintf(catalog.Heading, invoice.BillingPeriod.Format(catalog))
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, heading, false, false)),
+	}
+
+	totalFields := []*slack.TextBlockObject{
+		mrkdwnField(catalog.MonthlyLabel, invoice.FormatMoney(invoice.Total.Monthly)),
+		mrkdwnField(catalog.YesterdayLabel, invoice.FormatMoney(invoice.Total.Yesterday)),
+	}
+	if invoice.Total.MonthlyCredits != 0 || invoice.Total.YesterdayCredits != 0 {
+		totalFields = append(totalFields, mrkdwnField(catalog.Credits, costValue(invoice, invoice.Total.MonthlyCredits, invoice.Total.YesterdayCredits)))
+	}
+	blocks = append(blocks, slack.NewSectionBlock(nil, totalFields, nil))
+
+	for _, section := range invoice.Highlights() {
+		var fields []*slack.TextBlockObject
+		for _, item := range section.Items {
+			fields = append(fields, mrkdwnField(item.Name, item.Value))
+		}
+		title := slack.NewTextBlockObject(slack.MarkdownType, "*"+sectionTitle(section.Header)+"*", false, false)
+		for start := 0; start < len(fields); start += maxSlackSectionFields {
+			end := start + maxSlackSectionFields
+			if end > len(fields) {
+				end = len(fields)
+			}
+			blocks = append(blocks, slack.NewSectionBlock(title, fields[start:end], nil))
+			title = nil
+		}
+	}
+
+	var breakdowns [][]*slack.TextBlockObject
+	var headers []string
+	if len(invoice.Services) > 0 {
+		var fields []*slack.TextBlockObject
+		for _, cost := range invoice.Services {
+			value := costValue(invoice, cost.Monthly, cost.Yesterday)
+			for _, sku := range cost.SKUs {
+				value += fmt.Sprintf("\n• %s: %s", sku.SKU, invoice.FormatMoney(sku.Monthly))
+			}
+			fields = append(fields, mrkdwnField(cost.Service, value))
+		}
+		headers = append(headers, catalog.DetailsHeader)
+		breakdowns = append(breakdowns, fields)
+	}
+	if len(invoice.Projects) > 0 {
+		var fields []*slack.TextBlockObject
+		for _, project := range invoice.Projects {
+			value := costValue(invoice, project.Monthly, project.Yesterday)
+			for _, cost := range project.Services {
+				value += fmt.Sprintf("\n• %s: %s", cost.Service, invoice.FormatMoney(cost.Monthly))
+			}
+			fields = append(fields, mrkdwnField(project.DisplayName(), value))
+		}
+		headers = append(headers, catalog.ProjectsHeader)
+		breakdowns = append(breakdowns, fields)
+	}
+	for i, label := range invoice.Labels {
+		if i == 0 || label.Key != invoice.Labels[i-1].Key {
+			headers = append(headers, fmt.Sprintf(catalog.LabelsHeader, label.Key))
+			breakdowns = append(breakdowns, nil)
+		}
+		value := label.Value
+		if value == "" {
+			value = catalog.UnlabelledValue
+		}
+		last := len(breakdowns) - 1
+		breakdowns[last] = append(breakdowns[last], mrkdwnField(value, costValue(invoice, label.Monthly, label.Yesterday)))
+	}
+	if len(invoice.Credits) > 0 {
+		var fields []*slack.TextBlockObject
+		for _, credit := range invoice.Credits {
+			fields = append(fields, mrkdwnField(credit.Type, costValue(invoice, credit.Monthly, credit.Yesterday)))
+		}
+		headers = append(headers, catalog.CreditsHeader)
+		breakdowns = append(breakdowns, fields)
+	}
+
+	// A breakdown needs a divider, a header and at least one section,
+	// and the last two blocks are kept for the contexts.
+	limit := maxSlackBlocks - 2
+	omitted := 0
+	for i, fields := range breakdowns {
+		if len(blocks)+3 > limit {
+			omitted += len(fields)
+			continue
+		}
+		blocks = append(blocks, slack.NewDividerBlock())
+		headerText := strings.Trim(headers[i], "- ")
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*"+headerText+"*", false, false), nil, nil))
+		for start := 0; start < len(fields); start += maxSlackSectionFields {
+			if len(blocks)+1 > limit {
+				omitted += len(fields) - start
+				break
+			}
+			end := start + maxSlackSectionFields
+			if end > len(fields) {
+				end = len(fields)
+			}
+			blocks = append(blocks, slack.NewSectionBlock(nil, fields[start:end], nil))
+		}
+	}
+	if omitted > 0 {
+		blocks = append(blocks, slack.NewContextBlock("",
+			slack.NewTextBlockObject(slack.MarkdownType, "…"+fmt.Sprintf(catalog.MoreItems, omitted), false, false),
+		))
+	}
+
+	if !invoice.LastExportTime.IsZero() {
+		blocks = append(blocks, slack.NewContextBlock("",
+			slack.NewTextBlockObject(slack.MarkdownType, exportTimeText(invoice), false, false),
+		))
+	}
+	return blocks
+}
+
+func mrkdwnField(name string, value string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n%s", name, value), false, false)
+}
@@ -0,0 +1,167 @@
+package notification
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/analysis"
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+)
+
+func newInputInvoice() *billing.Invoice {
+	return &billing.Invoice{
+		BillingPeriod: billing.BillingPeriod{
+			From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2021, 5, 8, 0, 0, 0, 0, time.UTC),
+		},
+		Total: &billing.Cost{Service: "Total", Monthly: 1000.07, Yesterday: 400.0},
+		Services: []*billing.Cost{
+			{Service: "Cloud SQL", Monthly: 1000.0, Yesterday: 400.0},
+			{Service: "BigQuery", Monthly: 0.07, Yesterday: 0.0},
+		},
+		LastExportTime: time.Date(2021, 5, 9, 3, 4, 0, 0, time.UTC),
+	}
+}
+
+// newHighlightedInputInvoice returns the input Invoice
+// with a crossed budget, an anomaly and the forecast.
+func newHighlightedInputInvoice() *billing.Invoice {
+	invoice := newInputInvoice()
+	invoice.Budgets = []*billing.BudgetStatus{
+		{Budget: billing.Budget{Scope: billing.BudgetScopeTotal, Amount: 1200.0}, Spent: 1000.07, Percent: 83.3, Reached: 80, Crossed: 80},
+	}
+	invoice.Anomalies = []*analysis.Anomaly{{Service: "Cloud SQL", Cost: 400.0, Baseline: 100.0, Direction: 1}}
+	invoice.Forecast = &analysis.Forecast{Total: 3875.0, Services: []*analysis.ServiceForecast{{Service: "Cloud SQL", Amount: 3875.0}}}
+	return invoice
+}
+
+// newCreditedInputInvoice returns the input Invoice
+// with the credits broken down by type.
+func newCreditedInputInvoice() *billing.Invoice {
+	invoice := newInputInvoice()
+	invoice.Total.MonthlyCredits = -150.0
+	invoice.Total.YesterdayCredits = -60.0
+	invoice.Credits = []*billing.CreditCost{
+		{Type: "SUSTAINED_USAGE_DISCOUNT", Monthly: -100.0, Yesterday: -40.0},
+		{Type: "PROMOTION", Monthly: -50.0, Yesterday: -20.0},
+	}
+	return invoice
+}
+
+func TestRenderInvoiceAsBlocks(t *testing.T) {
+	blocks := invoiceBlocks(newInputInvoice())
+
+	var blockTypes []slack.MessageBlockType
+	for _, block := range blocks {
+		blockTypes = append(blockTypes, block.BlockType())
+	}
+	assert.EqualValues(t,
+		[]slack.MessageBlockType{
+			slack.MBTHeader, slack.MBTSection, slack.MBTDivider, slack.MBTSection, slack.MBTSection, slack.MBTContext,
+		},
+		blockTypes,
+	)
+
+	header := blocks[0].(*slack.HeaderBlock)
+	assert.EqualValues(t, "5/1 ~ 5/8 の GCP 利用料金", header.Text.Text)
+
+	total := blocks[1].(*slack.SectionBlock)
+	assert.EqualValues(t, "*月間合計*\n¥ 1,000.07", total.Fields[0].Text)
+	assert.EqualValues(t, "*前日分*\n¥ 400", total.Fields[1].Text)
+
+	services := blocks[4].(*slack.SectionBlock)
+	assert.EqualValues(t, "*Cloud SQL*\n¥ 1,000 (¥ 400)", services.Fields[0].Text)
+
+	context := blocks[5].(*slack.ContextBlock)
+	assert.EqualValues(t, "データ更新日時: 2021-05-09 03:04 UTC", context.ContextElements.Elements[0].(*slack.TextBlockObject).Text)
+}
+
+func TestRenderHighlightsAsBlocks(t *testing.T) {
+	blocks := invoiceBlocks(newHighlightedInputInvoice())
+
+	alert := blocks[2].(*slack.SectionBlock)
+	assert.EqualValues(t, "*🚨 予算アラート*", alert.Text.Text)
+	assert.EqualValues(t, "*Total*\n予算の 80% を超えました (¥ 1,000.07 / ¥ 1,200, 83.3%)", alert.Fields[0].Text)
+
+	budgets := blocks[3].(*slack.SectionBlock)
+	assert.EqualValues(t, "*予算*", budgets.Text.Text)
+	assert.EqualValues(t, "*Total*\n¥ 1,000.07 / ¥ 1,200 (83.3%) 🟠", budgets.Fields[0].Text)
+
+	anomalies := blocks[4].(*slack.SectionBlock)
+	assert.EqualValues(t, "*⚠️ 異常値*", anomalies.Text.Text)
+	assert.EqualValues(t, "*Cloud SQL*\n¥ 400 ↑ (通常 ¥ 100)", anomalies.Fields[0].Text)
+
+	forecast := blocks[5].(*slack.SectionBlock)
+	assert.EqualValues(t, "*月末予測*", forecast.Text.Text)
+	assert.EqualValues(t, "*Total*\n¥ 3,875", forecast.Fields[0].Text)
+	assert.EqualValues(t, "*Cloud SQL*\n¥ 3,875", forecast.Fields[1].Text)
+
+	assert.EqualValues(t, slack.MBTDivider, blocks[6].BlockType())
+}
+
+func TestRenderCreditsByTypeAsBlocks(t *testing.T) {
+	blocks := invoiceBlocks(newCreditedInputInvoice())
+
+	header := blocks[6].(*slack.SectionBlock)
+	assert.EqualValues(t, "*クレジット内訳*", header.Text.Text)
+	credits := blocks[7].(*slack.SectionBlock)
+	assert.EqualValues(t, "*SUSTAINED_USAGE_DISCOUNT*\n¥ -100 (¥ -40)", credits.Fields[0].Text)
+	assert.EqualValues(t, "*PROMOTION*\n¥ -50 (¥ -20)", credits.Fields[1].Text)
+}
+
+func TestSplitServiceFieldsIntoSectionsAndLimitBlocks(t *testing.T) {
+	invoice := newInputInvoice()
+	invoice.Services = []*billing.Cost{}
+	for i := 0; i < 1000; i++ {
+		invoice.Services = append(invoice.Services, &billing.Cost{Service: "Service", Monthly: 1.0})
+	}
+
+	blocks := invoiceBlocks(invoice)
+
+	assert.EqualValues(t, maxSlackBlocks, len(blocks))
+	assert.EqualValues(t, maxSlackSectionFields, len(blocks[4].(*slack.SectionBlock).Fields))
+	omission := blocks[len(blocks)-2].(*slack.ContextBlock)
+	assert.EqualValues(t, "…ほか 560 件", omission.ContextElements.Elements[0].(*slack.TextBlockObject).Text)
+	assert.EqualValues(t, slack.MBTContext, blocks[len(blocks)-1].BlockType())
+}
+
+func TestSendInvoiceAsBlocksWithTextFallback(t *testing.T) {
+	var received slack.WebhookMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	client := SlackClient{webhookURL: server.URL, format: SlackBlocksFormat}
+	invoice := newInputInvoice()
+
+	sentMessage, err := client.Send(invoice)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, invoice.AsMessage(), sentMessage)
+	assert.EqualValues(t, invoice.AsMessage(), received.Text)
+	assert.True(t, strings.Contains(received.Blocks.BlockSet[0].(*slack.HeaderBlock).Text.Text, "5/1 ~ 5/8"))
+}
+
+func TestSendPlainTextInTextFormat(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	client := SlackClient{webhookURL: server.URL, format: SlackTextFormat}
+
+	_, err := client.Send(newInputInvoice())
+
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(body), "blocks"), string(body))
+}
@@ -0,0 +1,130 @@
+package notification
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+type slackAPI interface {
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	UpdateMessage(channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+}
+
+// PostedMessage identifies a message posted to a Slack channel
+// to update it or reply to it later.
+type PostedMessage struct {
+	Channel   string
+	Timestamp string
+}
+
+// SlackBotClient is an object to send a message to Slack channels
+// via Web API (`chat.postMessage`) with a bot token.
+type SlackBotClient struct {
+	api      slackAPI
+	channels []string
+	posted   []PostedMessage // messages posted by the last Send
+}
+
+// NewSlackBotClient constructs a SlackBotClient object.
+//
+// The bot token is fetched from the environment variable `SLACK_BOT_TOKEN`
+// and the comma-separated channel IDs to post to from `SLACK_CHANNELS`.
+// The bot must be invited to the channels.
+func NewSlackBotClient() SlackBotClient {
+	return NewSlackBotClientWith(config.FromEnv().Slack)
+}
+
+// NewSlackBotClientWith constructs a SlackBotClient object with the bot token and the channels in the settings.
+func NewSlackBotClientWith(settings config.Slack) SlackBotClient {
+	return SlackBotClient{
+		api:      slack.New(settings.BotToken),
+		channels: settings.Channels,
+	}
+}
+
+// Send method receives an object which can be converted into
+// a notification message and posts it to all the channels.
+//
+// The posted messages are available from Posted method afterwards.
+// If posting to some of the channels fails, the message is returned with the error.
+func (c *SlackBotClient) Send(messenger Messenger) (string, *utils.CustomError) {
+	posted, err := c.Post(messenger)
+	c.posted = posted
+	if len(posted) == 0 {
+		return "", err
+	}
+	return messenger.AsMessage(), err
+}
+
+// Posted method returns the channels and timestamps of the messages posted by the last Send.
+func (c *SlackBotClient) Posted() []PostedMessage {
+	return c.posted
+}
+
+// Post method posts the message to all the channels
+// and returns the channels and timestamps of the posted messages.
+//
+// An Invoice is posted as a short summary with the breakdown as a thread reply.
+// The returned timestamps are those of the summaries.
+//
+// Even if posting to a channel fails, the message is posted to the other channels
+// and an error listing the failed channels is returned.
+func (c *SlackBotClient) Post(messenger Messenger) ([]PostedMessage, *utils.CustomError) {
+	if len(c.channels) == 0 {
+		return nil, NewSlackError("Could not send message!", fmt.Errorf("No channel is designated"))
+	}
+
+	summary, reply := threadMessages(messenger)
+
+	var posted []PostedMessage
+	var failures []string
+	for _, channel := range c.channels {
+		channelID, timestamp, err := c.api.PostMessage(channel, slack.MsgOptionText(summary, false))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", channel, err))
+			continue
+		}
+		posted = append(posted, PostedMessage{Channel: channelID, Timestamp: timestamp})
+
+		if reply == "" {
+			continue
+		}
+		_, _, err = c.api.PostMessage(channelID, slack.MsgOptionText(reply, false), slack.MsgOptionTS(timestamp))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s (thread reply): %s", channel, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return posted, NewSlackError(
+			"Could not send message!",
+			fmt.Errorf("Failed in posting to %s", strings.Join(failures, ", ")),
+		)
+	}
+	return posted, nil
+}
+
+// Update method replaces the text of a posted message with a new message.
+func (c *SlackBotClient) Update(message PostedMessage, messenger Messenger) *utils.CustomError {
+	_, _, _, err := c.api.UpdateMessage(message.Channel, message.Timestamp, slack.MsgOptionText(messenger.AsMessage(), false))
+	if err != nil {
+		return NewSlackError("Could not update message!", err)
+	}
+	return nil
+}
+
+// threadMessages splits the message into a summary to post to the channel
+// and a reply to post in the thread.
+// The reply is empty if the message is not an Invoice with a breakdown.
+func threadMessages(messenger Messenger) (string, string) {
+	invoice, ok := messenger.(*billing.Invoice)
+	if !ok || invoice.HasCustomMessage() {
+		return messenger.AsMessage(), ""
+	}
+	return invoice.SummaryMessage(), invoice.BreakdownMessage()
+}
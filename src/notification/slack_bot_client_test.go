@@ -0,0 +1,133 @@
+package notification
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+type postedStub struct {
+	channel  string
+	threadTS string
+}
+
+type slackAPIStub struct {
+	posted        []postedStub
+	failedChannel string
+	updated       []string
+}
+
+func (s *slackAPIStub) PostMessage(channelID string, options ...slack.MsgOption) (string, string, error) {
+	if channelID == s.failedChannel {
+		return "", "", fmt.Errorf("channel_not_found")
+	}
+	_, values, _ := slack.UnsafeApplyMsgOptions("", channelID, "", options...)
+	s.posted = append(s.posted, postedStub{channel: channelID, threadTS: values.Get("thread_ts")})
+	return channelID, fmt.Sprintf("1620000000.00000%d", len(s.posted)), nil
+}
+
+func (s *slackAPIStub) UpdateMessage(channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	s.updated = append(s.updated, channelID+"/"+timestamp)
+	return channelID, timestamp, "", nil
+}
+
+func TestPostInvoiceSummaryWithBreakdownInThread(t *testing.T) {
+	api := &slackAPIStub{}
+	client := SlackBotClient{api: api, channels: []string{"C1", "C2"}}
+
+	posted, err := client.Post(newInputInvoice())
+
+	assert.Nil(t, err)
+	assert.EqualValues(t,
+		[]PostedMessage{
+			{Channel: "C1", Timestamp: "1620000000.000001"},
+			{Channel: "C2", Timestamp: "1620000000.000003"},
+		},
+		posted,
+	)
+	assert.EqualValues(t,
+		[]postedStub{
+			{channel: "C1"}, {channel: "C1", threadTS: "1620000000.000001"},
+			{channel: "C2"}, {channel: "C2", threadTS: "1620000000.000003"},
+		},
+		api.posted,
+	)
+}
+
+func TestPostErrorWithoutThread(t *testing.T) {
+	api := &slackAPIStub{}
+	client := SlackBotClient{api: api, channels: []string{"C1"}}
+
+	sentMessage, err := client.Send(&messengerStub{message: "Process Failed!"})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "Process Failed!", sentMessage)
+	assert.EqualValues(t, []postedStub{{channel: "C1"}}, api.posted)
+	assert.EqualValues(t, []PostedMessage{{Channel: "C1", Timestamp: "1620000000.000001"}}, client.Posted())
+}
+
+func TestContinuePostingWhenAChannelFails(t *testing.T) {
+	api := &slackAPIStub{failedChannel: "C1"}
+	client := SlackBotClient{api: api, channels: []string{"C1", "C2"}}
+
+	posted, err := client.Post(&messengerStub{message: "test"})
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Slack Notification. Could not send message!: Failed in posting to C1: channel_not_found", err.Error())
+	assert.EqualValues(t, []PostedMessage{{Channel: "C2", Timestamp: "1620000000.000001"}}, posted)
+}
+
+func TestKeepPostedMessagesOfPartiallyFailedSend(t *testing.T) {
+	api := &slackAPIStub{failedChannel: "C1"}
+	client := SlackBotClient{api: api, channels: []string{"C1", "C2"}}
+
+	sentMessage, err := client.Send(&messengerStub{message: "test"})
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "test", sentMessage)
+	assert.EqualValues(t, []PostedMessage{{Channel: "C2", Timestamp: "1620000000.000001"}}, client.Posted())
+}
+
+func TestReturnErrorWhenNoChannelIsDesignated(t *testing.T) {
+	client := SlackBotClient{api: &slackAPIStub{}}
+
+	_, err := client.Send(&messengerStub{message: "test"})
+
+	assert.NotNil(t, err)
+}
+
+func TestUpdatePostedMessage(t *testing.T) {
+	api := &slackAPIStub{}
+	client := SlackBotClient{api: api, channels: []string{"C1"}}
+
+	err := client.Update(PostedMessage{Channel: "C1", Timestamp: "1620000000.000001"}, &messengerStub{message: "updated"})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"C1/1620000000.000001"}, api.updated)
+}
+
+func TestPostMessageViaWebAPI(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests = append(requests, r.URL.Path+" "+r.Form.Get("channel")+" "+r.Form.Get("token"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok": true, "channel": "C1", "ts": "1620000000.000001"}`)
+	}))
+	defer server.Close()
+
+	client := SlackBotClient{
+		api:      slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/")),
+		channels: []string{"C1"},
+	}
+
+	sentMessage, err := client.Send(&messengerStub{message: "test"})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "test", sentMessage)
+	assert.EqualValues(t, []string{"/chat.postMessage C1 xoxb-test"}, requests)
+}
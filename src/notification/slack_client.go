@@ -2,9 +2,11 @@
 package notification
 
 import (
-	"os"
+	"log"
 
 	"github.com/slack-go/slack"
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
 	"github.com/tatamiya/gcp-cost-notification/src/utils"
 )
 
@@ -22,27 +24,73 @@ type Messenger interface {
 	AsMessage() string
 }
 
+// Formats of the message sent to Slack.
+const (
+	SlackTextFormat   = "text"   // plain text message
+	SlackBlocksFormat = "blocks" // Block Kit message with plain text fallback
+)
+
 // SlackClient is an object to send a message to Slack
 // via webhook URL.
 type SlackClient struct {
 	webhookURL string
+	format     string
 }
 
 // NewSlackClient constructs a SlackClient object.
 // The webhook URL is fetched from the environment variable
 // `SLACK_WEBHOOK_URL` in construction.
+//
+// The message format is selected from `text` (default) and `blocks`
+// by the environment variable `SLACK_MESSAGE_FORMAT`.
 func NewSlackClient() SlackClient {
-	webhookURL := os.Getenv("SLACK_WEBHOOK_URL")
-	return SlackClient{webhookURL: webhookURL}
+	return NewSlackClientWith(config.FromEnv().Slack)
+}
+
+// NewSlackClientWith constructs a SlackClient object with the webhook URL and the message format in the settings.
+func NewSlackClientWith(settings config.Slack) SlackClient {
+	return SlackClient{
+		webhookURL: settings.WebhookURL,
+		format:     slackMessageFormat(settings.MessageFormat),
+	}
+}
+
+func slackMessageFormat(format string) string {
+	switch format {
+	case SlackTextFormat, SlackBlocksFormat:
+		return format
+	case "":
+		return SlackTextFormat
+	default:
+		log.Printf("Unknown Slack message format '%s'. '%s' is set instead.", format, SlackTextFormat)
+		return SlackTextFormat
+	}
+}
+
+// slackBlocks renders the messenger as Block Kit blocks
+// if it is an Invoice without a custom message template.
+// Otherwise, nil is returned and the message is sent as plain text.
+func slackBlocks(messenger Messenger) *slack.Blocks {
+	invoice, ok := messenger.(*billing.Invoice)
+	if !ok || invoice.HasCustomMessage() {
+		return nil
+	}
+	return &slack.Blocks{BlockSet: invoiceBlocks(invoice)}
 }
 
 // Send method receives an object which can be converted into
 // a notification message and sends it to Slack.
+//
+// In the `blocks` format, an Invoice is rendered as Block Kit blocks
+// and the plain text message is used as the fallback for notifications.
 func (c *SlackClient) Send(messenger Messenger) (string, *utils.CustomError) {
 	message := messenger.AsMessage()
 	msg := slack.WebhookMessage{
 		Text: message,
 	}
+	if c.format == SlackBlocksFormat {
+		msg.Blocks = slackBlocks(messenger)
+	}
 	err := slack.PostWebhook(c.webhookURL, &msg)
 	if err != nil {
 		return "", NewSlackError(
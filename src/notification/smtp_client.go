@@ -0,0 +1,322 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func NewSMTPError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Email Notification",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// SMTPClient is an object to send a message by email via an SMTP server.
+type SMTPClient struct {
+	host      string
+	port      string
+	username  string
+	password  string
+	from      string
+	to        []string
+	startTLS  bool
+	tlsConfig *tls.Config
+	timeout   time.Duration // of the whole session including the connection
+}
+
+// NewSMTPClient constructs an SMTPClient object from the environment variables.
+//
+// `SMTP_HOST`, `SMTP_PORT` (default: 587) ... the address of the SMTP server.
+//
+// `SMTP_USERNAME`, `SMTP_PASSWORD` ... the credentials for PLAIN authentication.
+// If the username is empty, no authentication is performed.
+//
+// `SMTP_FROM` ... the sender address.
+//
+// `SMTP_TO` ... the comma-separated recipient addresses.
+//
+// `SMTP_STARTTLS` ... whether to require STARTTLS (default: true).
+// It can be disabled only for a trusted local relay.
+func NewSMTPClient() SMTPClient {
+	return NewSMTPClientWith(config.FromEnv().Email)
+}
+
+// NewSMTPClientWith constructs an SMTPClient object with the server, the credentials and the addresses in the settings.
+func NewSMTPClientWith(settings config.Email) SMTPClient {
+	port := settings.Port
+	if port == 0 {
+		port = 587
+	}
+	startTLS := settings.StartTLS == nil || *settings.StartTLS
+	return SMTPClient{
+		host:      settings.Host,
+		port:      strconv.Itoa(port),
+		username:  settings.Username,
+		password:  settings.Password,
+		from:      settings.From,
+		to:        settings.To,
+		startTLS:  startTLS,
+		tlsConfig: &tls.Config{ServerName: settings.Host},
+		timeout:   httpTimeout,
+	}
+}
+
+// Send method receives an object which can be converted into
+// a notification message and sends it by email to all the recipients.
+//
+// An Invoice is sent as a multipart email with an HTML table and the plain text message.
+// The other messages are sent as plain text.
+func (c *SMTPClient) Send(messenger Messenger) (string, *utils.CustomError) {
+	if len(c.to) == 0 {
+		return "", NewSMTPError("Could not send message!", fmt.Errorf("No recipient is designated"))
+	}
+
+	message := messenger.AsMessage()
+	mail, err := buildEmail(c.from, c.to, messenger, time.Now())
+	if err != nil {
+		return "", NewSMTPError("Could not build email!", err)
+	}
+
+	err = c.sendMail(mail)
+	if err != nil {
+		return "", NewSMTPError("Could not send message!", err)
+	}
+	return message, nil
+}
+
+func (c *SMTPClient) sendMail(mail []byte) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.host, c.port), c.timeout)
+	if err != nil {
+		return err
+	}
+	// The deadline keeps a stalled server from hanging the function.
+	if err = conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if c.startTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("The SMTP server does not support STARTTLS")
+		}
+		if err = client.StartTLS(c.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if c.username != "" {
+		if err = client.Auth(smtp.PlainAuth("", c.username, c.password, c.host)); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(c.from); err != nil {
+		return err
+	}
+	for _, to := range c.to {
+		if err = client.Rcpt(to); err != nil {
+			return fmt.Errorf("%s: %s", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(mail); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildEmail renders the message as an email with the headers.
+func buildEmail(from string, to []string, messenger Messenger, date time.Time) ([]byte, error) {
+	subject := "GCP Cost Notification"
+	invoice, isInvoice := messenger.(*billing.Invoice)
+	if isInvoice {
+		catalog := invoice.Catalog()
+		subject = fmt.Sprintf(catalog.Heading, invoice.BillingPeriod.Format(catalog))
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+
+	if !isInvoice || invoice.HasCustomMessage() {
+		fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n")
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		err := writeQuotedPrintable(&buf, messenger.AsMessage())
+		return buf.Bytes(), err
+	}
+
+	html, err := InvoiceHTML(invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	w := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", invoice.AsMessage()},
+		{"text/html; charset=utf-8", html},
+	}
+	for _, part := range parts {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(pw, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(strings.Replace(text, "\n", "\r\n", -1))); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+var invoiceHTMLTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{"title": sectionTitle}).Parse(`<html>
+<body>
+<h2>{{.Heading}}</h2>
+{{range .Highlights}}<p style="margin-bottom: 16px;"><strong>{{title .Header}}</strong>
+{{range .Items}}<br>{{.Name}}: {{.Value}}
+{{end}}</p>
+{{end}}{{range .Tables}}<table border="1" cellpadding="4" cellspacing="0" style="border-collapse: collapse; margin-bottom: 16px;">
+{{if .Header}}<caption style="text-align: left; font-weight: bold;">{{.Header}}</caption>
+{{end}}<tr><th></th><th>{{$.MonthlyLabel}}</th><th>{{$.YesterdayLabel}}</th></tr>
+{{range .Rows}}<tr><td>{{.Name}}</td><td style="text-align: right;">{{.Monthly}}</td><td style="text-align: right;">{{.Yesterday}}</td></tr>
+{{end}}</table>
+{{end}}{{if .ExportTime}}<p style="color: #888888;">{{.ExportTime}}</p>
+{{end}}</body>
+</html>
+`))
+
+type htmlTable struct {
+	Header string
+	Rows   []htmlRow
+}
+
+type htmlRow struct {
+	Name      string
+	Monthly   string
+	Yesterday string
+}
+
+// InvoiceHTML renders an Invoice as HTML:
+// the budgets, the anomalies and the forecast as paragraphs,
+// and the tables of the total cost and the breakdowns.
+func InvoiceHTML(invoice *billing.Invoice) (string, error) {
+	catalog := invoice.Catalog()
+	row := func(name string, monthly float32, yesterday float32) htmlRow {
+		return htmlRow{Name: name, Monthly: invoice.FormatMoney(monthly), Yesterday: invoice.FormatMoney(yesterday)}
+	}
+
+	total := htmlTable{Rows: []htmlRow{row(catalog.Total, invoice.Total.Monthly, invoice.Total.Yesterday)}}
+	if invoice.Total.MonthlyCredits != 0 || invoice.Total.YesterdayCredits != 0 {
+		total.Rows = append(total.Rows, row(catalog.Credits, invoice.Total.MonthlyCredits, invoice.Total.YesterdayCredits))
+	}
+	tables := []htmlTable{total}
+
+	if len(invoice.Services) > 0 {
+		table := htmlTable{Header: strings.Trim(catalog.DetailsHeader, "- ")}
+		for _, cost := range invoice.Services {
+			table.Rows = append(table.Rows, row(cost.Service, cost.Monthly, cost.Yesterday))
+			for _, sku := range cost.SKUs {
+				table.Rows = append(table.Rows, row("- "+sku.SKU, sku.Monthly, sku.Yesterday))
+			}
+		}
+		tables = append(tables, table)
+	}
+	if len(invoice.Projects) > 0 {
+		table := htmlTable{Header: strings.Trim(catalog.ProjectsHeader, "- ")}
+		for _, project := range invoice.Projects {
+			table.Rows = append(table.Rows, row(project.DisplayName(), project.Monthly, project.Yesterday))
+			for _, cost := range project.Services {
+				table.Rows = append(table.Rows, row("- "+cost.Service, cost.Monthly, cost.Yesterday))
+			}
+		}
+		tables = append(tables, table)
+	}
+	for i, label := range invoice.Labels {
+		if i == 0 || label.Key != invoice.Labels[i-1].Key {
+			tables = append(tables, htmlTable{Header: strings.Trim(fmt.Sprintf(catalog.LabelsHeader, label.Key), "- ")})
+		}
+		value := label.Value
+		if value == "" {
+			value = catalog.UnlabelledValue
+		}
+		last := len(tables) - 1
+		tables[last].Rows = append(tables[last].Rows, row(value, label.Monthly, label.Yesterday))
+	}
+	if len(invoice.Credits) > 0 {
+		table := htmlTable{Header: strings.Trim(catalog.CreditsHeader, "- ")}
+		for _, credit := range invoice.Credits {
+			table.Rows = append(table.Rows, row(credit.Type, credit.Monthly, credit.Yesterday))
+		}
+		tables = append(tables, table)
+	}
+
+	data := struct {
+		Heading        string
+		MonthlyLabel   string
+		YesterdayLabel string
+		Highlights     []*billing.MessageSection
+		Tables         []htmlTable
+		ExportTime     string
+	}{
+		Heading:        fmt.Sprintf(catalog.Heading, invoice.BillingPeriod.Format(catalog)),
+		MonthlyLabel:   catalog.MonthlyLabel,
+		YesterdayLabel: catalog.YesterdayLabel,
+		Highlights:     invoice.Highlights(),
+		Tables:         tables,
+	}
+	if !invoice.LastExportTime.IsZero() {
+		data.ExportTime = exportTimeText(invoice)
+	}
+
+	var buf bytes.Buffer
+	err := invoiceHTMLTemplate.Execute(&buf, data)
+	return buf.String(), err
+}
@@ -0,0 +1,239 @@
+package notification
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTPServer is a minimal SMTP server recording the received email.
+type fakeSMTPServer struct {
+	listener   net.Listener
+	extensions []string
+	auth       string
+	from       string
+	to         []string
+	data       string
+	done       chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T, extensions ...string) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: listener, extensions: extensions, done: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			reply("250-localhost")
+			for _, extension := range s.extensions {
+				reply("250-" + extension)
+			}
+			reply("250 OK")
+		case "AUTH":
+			s.auth = line
+			reply("235 Authenticated")
+		case "MAIL":
+			s.from = line
+			reply("250 OK")
+		case "RCPT":
+			if strings.Contains(line, "rejected") {
+				reply("550 No such user")
+				continue
+			}
+			s.to = append(s.to, line)
+			reply("250 OK")
+		case "DATA":
+			reply("354 Go ahead")
+			var data []string
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil || dataLine == ".\r\n" {
+					break
+				}
+				data = append(data, dataLine)
+			}
+			s.data = strings.Join(data, "")
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) client(to ...string) SMTPClient {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return SMTPClient{
+		host:    host,
+		port:    port,
+		from:    "billing@example.com",
+		to:      to,
+		timeout: time.Second,
+	}
+}
+
+func (s *fakeSMTPServer) close() {
+	s.listener.Close()
+	<-s.done
+}
+
+func TestSendInvoiceAsMultipartEmail(t *testing.T) {
+	server := newFakeSMTPServer(t, "AUTH PLAIN")
+	client := server.client("finance@example.com", "cfo@example.com")
+	client.username = "user"
+	client.password = "pass"
+	invoice := newInputInvoice()
+
+	sentMessage, err := client.Send(invoice)
+	server.close()
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, invoice.AsMessage(), sentMessage)
+	assert.True(t, strings.HasPrefix(server.auth, "AUTH PLAIN"))
+	assert.True(t, strings.HasPrefix(server.from, "MAIL FROM:<billing@example.com>"), server.from)
+	assert.EqualValues(t, []string{"RCPT TO:<finance@example.com>", "RCPT TO:<cfo@example.com>"}, server.to)
+
+	msg, parseErr := mail.ReadMessage(strings.NewReader(server.data))
+	assert.Nil(t, parseErr)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.EqualValues(t, "5/1 ~ 5/8 の GCP 利用料金", subject)
+	assert.EqualValues(t, "finance@example.com, cfo@example.com", msg.Header.Get("To"))
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.EqualValues(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	plain, _ := reader.NextPart()
+	plainBody, _ := ioutil.ReadAll(plain)
+	assert.EqualValues(t, "text/plain; charset=utf-8", plain.Header.Get("Content-Type"))
+	assert.EqualValues(t, strings.Replace(invoice.AsMessage(), "\n", "\r\n", -1), string(plainBody))
+
+	html, _ := reader.NextPart()
+	htmlBody, _ := ioutil.ReadAll(html)
+	assert.EqualValues(t, "text/html; charset=utf-8", html.Header.Get("Content-Type"))
+	assert.Contains(t, string(htmlBody), "<tr><td>Cloud SQL</td><td style=\"text-align: right;\">¥ 1,000</td><td style=\"text-align: right;\">¥ 400</td></tr>")
+	assert.Contains(t, string(htmlBody), "<caption style=\"text-align: left; font-weight: bold;\">内訳</caption>")
+}
+
+func TestRenderHighlightsInHTML(t *testing.T) {
+	html, err := InvoiceHTML(newHighlightedInputInvoice())
+
+	assert.Nil(t, err)
+	assert.Contains(t, html, "<strong>🚨 予算アラート</strong>\n<br>Total: 予算の 80% を超えました (¥ 1,000.07 / ¥ 1,200, 83.3%)\n")
+	assert.Contains(t, html, "<br>Cloud SQL: ¥ 400 ↑ (通常 ¥ 100)")
+	assert.Contains(t, html, "<strong>月末予測</strong>\n<br>Total: ¥ 3,875\n<br>Cloud SQL: ¥ 3,875\n")
+}
+
+func TestRenderCreditsByTypeInHTML(t *testing.T) {
+	html, err := InvoiceHTML(newCreditedInputInvoice())
+
+	assert.Nil(t, err)
+	assert.Contains(t, html, "<caption style=\"text-align: left; font-weight: bold;\">クレジット内訳</caption>")
+	assert.Contains(t, html, "<tr><td>PROMOTION</td><td style=\"text-align: right;\">¥ -50</td><td style=\"text-align: right;\">¥ -20</td></tr>")
+}
+
+func TestSendErrorAsPlainTextEmail(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	client := server.client("finance@example.com")
+
+	_, err := client.Send(&messengerStub{message: "Process Failed!"})
+	server.close()
+
+	assert.Nil(t, err)
+	msg, _ := mail.ReadMessage(strings.NewReader(server.data))
+	body, _ := ioutil.ReadAll(msg.Body)
+	assert.EqualValues(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+	assert.EqualValues(t, "Process Failed!\r\n", string(body))
+}
+
+func TestReturnSMTPErrorWhenRecipientIsRejected(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	client := server.client("finance@example.com", "rejected@example.com")
+
+	sentMessage, err := client.Send(&messengerStub{message: "test"})
+	server.close()
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "", sentMessage)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Email Notification. Could not send message!: rejected@example.com: 550 \"No such user\""), err)
+}
+
+func TestReturnSMTPErrorWhenStartTLSIsNotSupported(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	client := server.client("finance@example.com")
+	client.startTLS = true
+
+	_, err := client.Send(&messengerStub{message: "test"})
+	server.close()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "does not support STARTTLS")
+}
+
+func TestReturnSMTPErrorWithoutRecipients(t *testing.T) {
+	client := SMTPClient{}
+
+	_, err := client.Send(&messengerStub{message: "test"})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "No recipient is designated")
+}
+
+func TestReturnSMTPErrorWhenServerStalls(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		// Accept the connection but never send the greeting.
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	client := SMTPClient{host: host, port: port, from: "billing@example.com", to: []string{"team@example.com"}, timeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	_, sendError := client.Send(&messengerStub{message: "test"})
+
+	assert.NotNil(t, sendError)
+	assert.True(t, time.Since(start) < time.Second, time.Since(start).String())
+}
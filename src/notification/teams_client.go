@@ -0,0 +1,210 @@
+package notification
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func NewTeamsError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Teams Notification",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// TeamsClient is an object to send a message to Microsoft Teams
+// via incoming webhook URL.
+type TeamsClient struct {
+	webhookURL string
+	httpClient *http.Client
+}
+
+// NewTeamsClient constructs a TeamsClient object.
+// The webhook URL is fetched from the environment variable
+// `TEAMS_WEBHOOK_URL` in construction.
+func NewTeamsClient() TeamsClient {
+	return NewTeamsClientWith(config.FromEnv().Teams)
+}
+
+// NewTeamsClientWith constructs a TeamsClient object with the webhook URL in the settings.
+func NewTeamsClientWith(settings config.Teams) TeamsClient {
+	return TeamsClient{
+		webhookURL: settings.WebhookURL,
+		httpClient: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// Send method receives an object which can be converted into
+// a notification message and sends it to Teams.
+//
+// An Invoice is rendered as an Adaptive Card,
+// and the other messages (e.g. errors) are sent as plain text.
+func (c *TeamsClient) Send(messenger Messenger) (string, *utils.CustomError) {
+	message := messenger.AsMessage()
+
+	var payload interface{}
+	invoice, ok := messenger.(*billing.Invoice)
+	if ok && !invoice.HasCustomMessage() {
+		payload = teamsCardMessage(invoice)
+	} else {
+		payload = teamsTextMessage{Text: message}
+	}
+
+	err := postJSON(c.httpClient, c.webhookURL, payload)
+	if err != nil {
+		return "", NewTeamsError("Could not send message!", err)
+	}
+	return message, nil
+}
+
+type teamsTextMessage struct {
+	Text string `json:"text"`
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     adaptiveCard `json:"content"`
+}
+
+type adaptiveCard struct {
+	Schema  string                 `json:"$schema"`
+	Type    string                 `json:"type"`
+	Version string                 `json:"version"`
+	Body    []adaptiveCardElement  `json:"body"`
+	MSTeams map[string]interface{} `json:"msteams,omitempty"`
+}
+
+// adaptiveCardElement is a TextBlock or a FactSet of an Adaptive Card.
+type adaptiveCardElement struct {
+	Type     string         `json:"type"`
+	Text     string         `json:"text,omitempty"`
+	Size     string         `json:"size,omitempty"`
+	Weight   string         `json:"weight,omitempty"`
+	IsSubtle bool           `json:"isSubtle,omitempty"`
+	Wrap     bool           `json:"wrap,omitempty"`
+	Spacing  string         `json:"spacing,omitempty"`
+	Facts    []adaptiveFact `json:"facts,omitempty"`
+}
+
+type adaptiveFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+func headingBlock(text string) adaptiveCardElement {
+	return adaptiveCardElement{Type: "TextBlock", Text: text, Weight: "Bolder", Wrap: true, Spacing: "Medium"}
+}
+
+func factSet(facts []adaptiveFact) adaptiveCardElement {
+	return adaptiveCardElement{Type: "FactSet", Facts: facts}
+}
+
+// teamsCardMessage renders an Invoice as an Adaptive Card:
+// the billing period, the total cost, the budgets, the anomalies, the forecast
+// and the breakdowns as fact sets, and the data freshness.
+func teamsCardMessage(invoice *billing.Invoice) teamsMessage {
+	catalog := invoice.Catalog()
+	heading := fmt.Sprintf(catalog.Heading, invoice.BillingPeriod.Format(catalog))
+
+	body := []adaptiveCardElement{
+		{Type: "TextBlock", Text: heading, Size: "Large", Weight: "Bolder", Wrap: true},
+	}
+
+	totalFacts := []adaptiveFact{
+		{Title: catalog.MonthlyLabel, Value: invoice.FormatMoney(invoice.Total.Monthly)},
+		{Title: catalog.YesterdayLabel, Value: invoice.FormatMoney(invoice.Total.Yesterday)},
+	}
+	if invoice.Total.MonthlyCredits != 0 || invoice.Total.YesterdayCredits != 0 {
+		totalFacts = append(totalFacts, adaptiveFact{Title: catalog.Credits, Value: costValue(invoice, invoice.Total.MonthlyCredits, invoice.Total.YesterdayCredits)})
+	}
+	body = append(body, factSet(totalFacts))
+
+	for _, section := range invoice.Highlights() {
+		var facts []adaptiveFact
+		for _, item := range section.Items {
+			facts = append(facts, adaptiveFact{Title: item.Name, Value: item.Value})
+		}
+		body = append(body, headingBlock(section.Header), factSet(facts))
+	}
+
+	if len(invoice.Services) > 0 {
+		var facts []adaptiveFact
+		for _, cost := range invoice.Services {
+			facts = append(facts, adaptiveFact{Title: cost.Service, Value: costValue(invoice, cost.Monthly, cost.Yesterday)})
+			for _, sku := range cost.SKUs {
+				facts = append(facts, adaptiveFact{Title: "- " + sku.SKU, Value: costValue(invoice, sku.Monthly, sku.Yesterday)})
+			}
+		}
+		body = append(body, headingBlock(catalog.DetailsHeader), factSet(facts))
+	}
+
+	if len(invoice.Projects) > 0 {
+		var facts []adaptiveFact
+		for _, project := range invoice.Projects {
+			facts = append(facts, adaptiveFact{Title: project.DisplayName(), Value: costValue(invoice, project.Monthly, project.Yesterday)})
+			for _, cost := range project.Services {
+				facts = append(facts, adaptiveFact{Title: "- " + cost.Service, Value: costValue(invoice, cost.Monthly, cost.Yesterday)})
+			}
+		}
+		body = append(body, headingBlock(catalog.ProjectsHeader), factSet(facts))
+	}
+
+	var labelFacts []adaptiveFact
+	for i, label := range invoice.Labels {
+		if i == 0 || label.Key != invoice.Labels[i-1].Key {
+			if len(labelFacts) > 0 {
+				body = append(body, factSet(labelFacts))
+				labelFacts = nil
+			}
+			body = append(body, headingBlock(fmt.Sprintf(catalog.LabelsHeader, label.Key)))
+		}
+		value := label.Value
+		if value == "" {
+			value = catalog.UnlabelledValue
+		}
+		labelFacts = append(labelFacts, adaptiveFact{Title: value, Value: costValue(invoice, label.Monthly, label.Yesterday)})
+	}
+	if len(labelFacts) > 0 {
+		body = append(body, factSet(labelFacts))
+	}
+
+	if len(invoice.Credits) > 0 {
+		var facts []adaptiveFact
+		for _, credit := range invoice.Credits {
+			facts = append(facts, adaptiveFact{Title: credit.Type, Value: costValue(invoice, credit.Monthly, credit.Yesterday)})
+		}
+		body = append(body, headingBlock(catalog.CreditsHeader), factSet(facts))
+	}
+
+	if !invoice.LastExportTime.IsZero() {
+		body = append(body, adaptiveCardElement{
+			Type: "TextBlock", Text: exportTimeText(invoice), Size: "Small", IsSubtle: true, Wrap: true,
+		})
+	}
+
+	return teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{
+			{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content: adaptiveCard{
+					Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+					Type:    "AdaptiveCard",
+					Version: "1.2",
+					Body:    body,
+					MSTeams: map[string]interface{}{"width": "Full"},
+				},
+			},
+		},
+	}
+}
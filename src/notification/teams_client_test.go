@@ -0,0 +1,93 @@
+package notification
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newWebhookServerStub(status int, received *[]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*received, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte("response body"))
+	}))
+}
+
+func TestSendInvoiceToTeamsAsAdaptiveCard(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusOK, &received)
+	defer server.Close()
+
+	client := TeamsClient{webhookURL: server.URL, httpClient: server.Client()}
+	invoice := newInputInvoice()
+
+	sentMessage, err := client.Send(invoice)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, invoice.AsMessage(), sentMessage)
+
+	var payload teamsMessage
+	json.Unmarshal(received, &payload)
+	card := payload.Attachments[0].Content
+	assert.EqualValues(t, "application/vnd.microsoft.card.adaptive", payload.Attachments[0].ContentType)
+	assert.EqualValues(t, "AdaptiveCard", card.Type)
+	assert.EqualValues(t, "5/1 ~ 5/8 の GCP 利用料金", card.Body[0].Text)
+	assert.EqualValues(t, adaptiveFact{Title: "月間合計", Value: "¥ 1,000.07"}, card.Body[1].Facts[0])
+	assert.EqualValues(t, adaptiveFact{Title: "Cloud SQL", Value: "¥ 1,000 (¥ 400)"}, card.Body[3].Facts[0])
+	assert.EqualValues(t, "データ更新日時: 2021-05-09 03:04 UTC", card.Body[4].Text)
+}
+
+func TestRenderHighlightsInAdaptiveCard(t *testing.T) {
+	card := teamsCardMessage(newHighlightedInputInvoice()).Attachments[0].Content
+
+	assert.EqualValues(t, "🚨 ----- 予算アラート -----", card.Body[2].Text)
+	assert.EqualValues(t, adaptiveFact{Title: "Total", Value: "予算の 80% を超えました (¥ 1,000.07 / ¥ 1,200, 83.3%)"}, card.Body[3].Facts[0])
+	assert.EqualValues(t, "----- 予算 -----", card.Body[4].Text)
+	assert.EqualValues(t, "⚠️ ----- 異常値 -----", card.Body[6].Text)
+	assert.EqualValues(t, adaptiveFact{Title: "Cloud SQL", Value: "¥ 400 ↑ (通常 ¥ 100)"}, card.Body[7].Facts[0])
+	assert.EqualValues(t, "----- 月末予測 -----", card.Body[8].Text)
+	assert.EqualValues(t, adaptiveFact{Title: "Total", Value: "¥ 3,875"}, card.Body[9].Facts[0])
+}
+
+func TestRenderCreditsByTypeInAdaptiveCard(t *testing.T) {
+	body := teamsCardMessage(newCreditedInputInvoice()).Attachments[0].Content.Body
+
+	assert.EqualValues(t, "----- クレジット内訳 -----", body[len(body)-3].Text)
+	assert.EqualValues(t, []adaptiveFact{
+		{Title: "SUSTAINED_USAGE_DISCOUNT", Value: "¥ -100 (¥ -40)"},
+		{Title: "PROMOTION", Value: "¥ -50 (¥ -20)"},
+	}, body[len(body)-2].Facts)
+}
+
+func TestSendErrorToTeamsAsPlainText(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusOK, &received)
+	defer server.Close()
+
+	client := TeamsClient{webhookURL: server.URL, httpClient: server.Client()}
+
+	_, err := client.Send(&messengerStub{message: "Process Failed!"})
+
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"text": "Process Failed!"}`, string(received))
+}
+
+func TestReturnTeamsErrorWithResponseBody(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusBadRequest, &received)
+	defer server.Close()
+
+	client := TeamsClient{webhookURL: server.URL, httpClient: server.Client()}
+
+	sentMessage, err := client.Send(&messengerStub{message: "test"})
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "", sentMessage)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Teams Notification. Could not send message!: 400 Bad Request: response body"), err)
+}
@@ -0,0 +1,269 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+// WebhookPayloadVersion is the version of the JSON document sent by WebhookClient.
+// It is incremented when an incompatible change is made to the document.
+const WebhookPayloadVersion = "2"
+
+// WebhookSignatureHeader is the HTTP header carrying the HMAC-SHA256 signature
+// of the request body in the "sha256=<hex>" format.
+const WebhookSignatureHeader = "X-Cost-Notification-Signature"
+
+func NewWebhookError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Webhook Notification",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// WebhookClient is an object to POST the costs as a JSON document
+// to an arbitrary URL.
+type WebhookClient struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+}
+
+// NewWebhookClient constructs a WebhookClient object.
+//
+// The URL is fetched from the environment variable `WEBHOOK_URL`
+// and the secret to sign the body from `WEBHOOK_SECRET`.
+// If the secret is empty, the body is not signed.
+func NewWebhookClient() WebhookClient {
+	return NewWebhookClientWith(config.FromEnv().Webhook)
+}
+
+// NewWebhookClientWith constructs a WebhookClient object with the URL and the secret in the settings.
+func NewWebhookClientWith(settings config.Webhook) WebhookClient {
+	return WebhookClient{
+		url:        settings.URL,
+		secret:     settings.Secret,
+		httpClient: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// Send method receives an object which can be converted into
+// a notification message and POSTs it as a JSON document.
+//
+// An Invoice is sent as a document of type "invoice" with the costs,
+// and the other messages (e.g. errors) as a document of type "message".
+func (c *WebhookClient) Send(messenger Messenger) (string, *utils.CustomError) {
+	message := messenger.AsMessage()
+
+	body, err := MarshalMessage(messenger)
+	if err != nil {
+		return "", NewWebhookError("Could not encode payload!", err)
+	}
+
+	var headers map[string]string
+	if c.secret != "" {
+		headers = map[string]string{WebhookSignatureHeader: Sign(c.secret, body)}
+	}
+	err = postBody(c.httpClient, c.url, body, headers)
+	if err != nil {
+		return "", NewWebhookError("Could not send message!", err)
+	}
+	return message, nil
+}
+
+// MarshalMessage encodes the messenger into the JSON document sent by WebhookClient.
+// An Invoice is encoded with the costs and the others only with the message.
+func MarshalMessage(messenger Messenger) ([]byte, error) {
+	var payload webhookPayload
+	if invoice, ok := messenger.(*billing.Invoice); ok {
+		payload = invoicePayload(invoice)
+	} else {
+		payload = webhookPayload{Version: WebhookPayloadVersion, Type: "message"}
+	}
+	payload.Message = messenger.AsMessage()
+	return json.Marshal(payload)
+}
+
+// Sign computes the signature of the body with the secret
+// in the "sha256=<hex>" format.
+// Receivers can verify a request by comparing it with WebhookSignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookPayload struct {
+	Version        string            `json:"version"`
+	Type           string            `json:"type"`
+	Message        string            `json:"message"`
+	Period         *webhookPeriod    `json:"period,omitempty"`
+	Currency       string            `json:"currency,omitempty"`
+	LastExportTime string            `json:"last_export_time,omitempty"`
+	Total          *webhookCost      `json:"total,omitempty"`
+	Services       []*webhookCost    `json:"services,omitempty"`
+	Projects       []*webhookCost    `json:"projects,omitempty"`
+	Labels         []*webhookLabel   `json:"labels,omitempty"`
+	Credits        []*webhookCredit  `json:"credits,omitempty"`
+	Anomalies      []*webhookAnomaly `json:"anomalies,omitempty"`
+	Forecast       *webhookForecast  `json:"forecast,omitempty"`
+	Budgets        []*webhookBudget  `json:"budgets,omitempty"`
+}
+
+type webhookPeriod struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// webhookCost contains a cost with the changes from the day before and the previous month
+// if the costs to compare with are available.
+// The previous month is compared only for month-to-date and full-month periods.
+type webhookCost struct {
+	Name             string         `json:"name"`
+	DisplayName      string         `json:"display_name,omitempty"`
+	Monthly          float32        `json:"monthly"`
+	Yesterday        float32        `json:"yesterday"`
+	MonthlyCredits   float32        `json:"monthly_credits,omitempty"`
+	YesterdayCredits float32        `json:"yesterday_credits,omitempty"`
+	Breakdown        []*webhookCost `json:"breakdown,omitempty"`
+
+	DayBeforeYesterday float32  `json:"day_before_yesterday,omitempty"`
+	PreviousMonthly    float32  `json:"previous_monthly,omitempty"`
+	DayOverDay         *float32 `json:"day_over_day,omitempty"`
+	MonthOverMonth     *float32 `json:"month_over_month,omitempty"`
+}
+
+type webhookLabel struct {
+	Key       string  `json:"key"`
+	Value     string  `json:"value"`
+	Monthly   float32 `json:"monthly"`
+	Yesterday float32 `json:"yesterday"`
+}
+
+type webhookForecast struct {
+	Total    float32          `json:"total"`
+	Services []*webhookAmount `json:"services"`
+}
+
+type webhookAmount struct {
+	Name   string  `json:"name"`
+	Amount float32 `json:"amount"`
+}
+
+type webhookAnomaly struct {
+	Service  string  `json:"service"`
+	Cost     float32 `json:"cost"`
+	Baseline float32 `json:"baseline"`
+	Score    float64 `json:"score"`
+}
+
+// webhookBudget contains the percent consumed of a budget.
+// Crossed is the threshold first crossed on this run (omitted if none).
+type webhookBudget struct {
+	Scope   string  `json:"scope"`
+	Name    string  `json:"name,omitempty"`
+	Amount  float32 `json:"amount"`
+	Spent   float32 `json:"spent"`
+	Percent float32 `json:"percent"`
+	Crossed float32 `json:"crossed,omitempty"`
+}
+
+type webhookCredit struct {
+	Type      string  `json:"type"`
+	Monthly   float32 `json:"monthly"`
+	Yesterday float32 `json:"yesterday"`
+}
+
+// invoicePayload converts an Invoice into a JSON document.
+func invoicePayload(invoice *billing.Invoice) webhookPayload {
+	newCost := func(name string, monthly float32, yesterday float32) *webhookCost {
+		return &webhookCost{Name: name, Monthly: monthly, Yesterday: yesterday}
+	}
+	newComparedCost := func(name string, source *billing.Cost) *webhookCost {
+		cost := newCost(name, source.Monthly, source.Yesterday)
+		cost.MonthlyCredits = source.MonthlyCredits
+		cost.YesterdayCredits = source.YesterdayCredits
+		cost.DayBeforeYesterday = source.DayBeforeYesterday
+		if invoice.HasMonthComparison() {
+			cost.PreviousMonthly = source.PreviousMonthly
+		}
+		if invoice.HasComparison() {
+			dayOverDay := source.DayOverDay()
+			cost.DayOverDay = &dayOverDay
+			if invoice.HasMonthComparison() {
+				monthOverMonth := source.MonthOverMonth()
+				cost.MonthOverMonth = &monthOverMonth
+			}
+		}
+		return cost
+	}
+
+	payload := webhookPayload{
+		Version: WebhookPayloadVersion,
+		Type:    "invoice",
+		Period: &webhookPeriod{
+			From: invoice.BillingPeriod.From.Format("2006-01-02"),
+			To:   invoice.BillingPeriod.To.Format("2006-01-02"),
+		},
+		Currency: billing.LookupCurrency(invoice.Currency).Code,
+	}
+	if !invoice.LastExportTime.IsZero() {
+		payload.LastExportTime = invoice.LastExportTime.UTC().Format(time.RFC3339)
+	}
+
+	payload.Total = newComparedCost("Total", invoice.Total)
+
+	for _, service := range invoice.Services {
+		cost := newComparedCost(service.Service, service)
+		for _, sku := range service.SKUs {
+			cost.Breakdown = append(cost.Breakdown, newCost(sku.SKU, sku.Monthly, sku.Yesterday))
+		}
+		payload.Services = append(payload.Services, cost)
+	}
+	for _, project := range invoice.Projects {
+		cost := newCost(project.Project, project.Monthly, project.Yesterday)
+		cost.DisplayName = project.Name
+		cost.MonthlyCredits = project.MonthlyCredits
+		cost.YesterdayCredits = project.YesterdayCredits
+		for _, service := range project.Services {
+			cost.Breakdown = append(cost.Breakdown, newComparedCost(service.Service, service))
+		}
+		payload.Projects = append(payload.Projects, cost)
+	}
+	for _, label := range invoice.Labels {
+		payload.Labels = append(payload.Labels, &webhookLabel{
+			Key: label.Key, Value: label.Value, Monthly: label.Monthly, Yesterday: label.Yesterday,
+		})
+	}
+	for _, credit := range invoice.Credits {
+		payload.Credits = append(payload.Credits, &webhookCredit{
+			Type: credit.Type, Monthly: credit.Monthly, Yesterday: credit.Yesterday,
+		})
+	}
+	for _, anomaly := range invoice.Anomalies {
+		payload.Anomalies = append(payload.Anomalies, &webhookAnomaly{
+			Service: anomaly.Service, Cost: anomaly.Cost, Baseline: anomaly.Baseline, Score: anomaly.Score,
+		})
+	}
+	if invoice.Forecast != nil {
+		payload.Forecast = &webhookForecast{Total: invoice.Forecast.Total}
+		for _, service := range invoice.Forecast.Services {
+			payload.Forecast.Services = append(payload.Forecast.Services, &webhookAmount{Name: service.Service, Amount: service.Amount})
+		}
+	}
+	for _, status := range invoice.Budgets {
+		payload.Budgets = append(payload.Budgets, &webhookBudget{
+			Scope: status.Budget.Scope, Name: status.Budget.Name, Amount: status.Budget.Amount,
+			Spent: status.Spent, Percent: status.Percent, Crossed: status.Crossed,
+		})
+	}
+	return payload
+}
@@ -0,0 +1,146 @@
+package notification
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/billing"
+)
+
+func TestSendInvoiceAsSignedJSONDocument(t *testing.T) {
+	var received []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get(WebhookSignatureHeader)
+	}))
+	defer server.Close()
+
+	client := WebhookClient{url: server.URL, secret: "secret", httpClient: server.Client()}
+	invoice := newInputInvoice()
+
+	sentMessage, err := client.Send(invoice)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, invoice.AsMessage(), sentMessage)
+	assert.EqualValues(t, Sign("secret", received), signature)
+	assert.JSONEq(t, `{
+		"version": "2",
+		"type": "invoice",
+		"message": `+string(mustMarshal(invoice.AsMessage()))+`,
+		"period": {"from": "2021-05-01", "to": "2021-05-08"},
+		"currency": "JPY",
+		"last_export_time": "2021-05-09T03:04:00Z",
+		"total": {"name": "Total", "monthly": 1000.07, "yesterday": 400},
+		"services": [
+			{"name": "Cloud SQL", "monthly": 1000, "yesterday": 400},
+			{"name": "BigQuery", "monthly": 0.07, "yesterday": 0}
+		]
+	}`, string(received))
+}
+
+func TestIncludeChangesInPayloadWhenComparisonIsAvailable(t *testing.T) {
+	invoice := newInputInvoice()
+	invoice.Total = &billing.Cost{Service: "Total", Monthly: 1000, Yesterday: 400, DayBeforeYesterday: 300, PreviousMonthly: 1100}
+
+	payload, _ := json.Marshal(invoicePayload(invoice).Total)
+
+	assert.JSONEq(t, `{
+		"name": "Total", "monthly": 1000, "yesterday": 400,
+		"day_before_yesterday": 300, "previous_monthly": 1100,
+		"day_over_day": 100, "month_over_month": -100
+	}`, string(payload))
+}
+
+func TestOmitMonthOverMonthInPayloadOutsideMonthToDate(t *testing.T) {
+	invoice := newInputInvoice()
+	invoice.BillingPeriod.From = time.Date(2021, 5, 2, 0, 0, 0, 0, time.UTC)
+	invoice.Total = &billing.Cost{Service: "Total", Monthly: 1000, Yesterday: 400, DayBeforeYesterday: 300}
+
+	payload, _ := json.Marshal(invoicePayload(invoice).Total)
+
+	assert.JSONEq(t, `{
+		"name": "Total", "monthly": 1000, "yesterday": 400,
+		"day_before_yesterday": 300, "day_over_day": 100
+	}`, string(payload))
+}
+
+func TestIncludeBudgetsInPayload(t *testing.T) {
+	invoice := newInputInvoice()
+	invoice.Budgets = []*billing.BudgetStatus{
+		{Budget: billing.Budget{Scope: "total", Amount: 1200}, Spent: 1000.07, Percent: 83.3, Reached: 80, Crossed: 80},
+		{Budget: billing.Budget{Scope: "service", Name: "BigQuery", Amount: 1}, Spent: 0.07, Percent: 7},
+	}
+
+	payload, _ := json.Marshal(invoicePayload(invoice).Budgets)
+
+	assert.JSONEq(t, `[
+		{"scope": "total", "amount": 1200, "spent": 1000.07, "percent": 83.3, "crossed": 80},
+		{"scope": "service", "name": "BigQuery", "amount": 1, "spent": 0.07, "percent": 7}
+	]`, string(payload))
+}
+
+func TestSendErrorAsMessageDocumentWithoutSignature(t *testing.T) {
+	var received []byte
+	signed := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		_, signed = r.Header[WebhookSignatureHeader]
+	}))
+	defer server.Close()
+
+	client := WebhookClient{url: server.URL, httpClient: server.Client()}
+
+	_, err := client.Send(&messengerStub{message: "Process Failed!"})
+
+	assert.Nil(t, err)
+	assert.False(t, signed)
+	assert.JSONEq(t, `{"version": "2", "type": "message", "message": "Process Failed!"}`, string(received))
+}
+
+func TestSignBodyWithHMACSHA256(t *testing.T) {
+	assert.EqualValues(t,
+		"sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		Sign("key", []byte("The quick brown fox jumps over the lazy dog")),
+	)
+}
+
+func TestReturnWebhookErrorWithResponseBody(t *testing.T) {
+	var received []byte
+	server := newWebhookServerStub(http.StatusInternalServerError, &received)
+	defer server.Close()
+
+	client := WebhookClient{url: server.URL, httpClient: server.Client()}
+
+	sentMessage, err := client.Send(&messengerStub{message: "test"})
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "", sentMessage)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Webhook Notification. Could not send message!: 500 Internal Server Error: response body"), err)
+}
+
+func TestLimitResponseBodyInWebhookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(strings.Repeat("x", 1<<20)))
+	}))
+	defer server.Close()
+
+	client := WebhookClient{url: server.URL, httpClient: server.Client()}
+
+	_, err := client.Send(&messengerStub{message: "test"})
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, maxResponseBytes, strings.Count(err.Error(), "x"))
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
@@ -6,16 +6,45 @@ import (
 	"bytes"
 	"fmt"
 	"html/template"
+	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/tatamiya/gcp-cost-notification/src/config"
 	"github.com/tatamiya/gcp-cost-notification/src/datetime"
 )
 
+// Bases of the reported costs.
+const (
+	NetCost   = "net"   // costs with credits applied
+	GrossCost = "gross" // costs before credits are applied
+)
+
+// Dimensions to break down the GCP cost.
+const (
+	GroupByService        = "service"         // costs for each service
+	GroupByProject        = "project"         // costs for each project
+	GroupByProjectService = "project_service" // costs for each service in each project
+)
+
 // QueryBuilder is an object to build a query from a template.
 type QueryBuilder struct {
-	tableID      string
-	templatePath string
+	tableID           string
+	templatePath      string
+	dailyTemplatePath string
+	grouping          string
+	labelKeys         []string
+
+	skuTopServices int     // number of services to drill down into SKUs (0: disabled)
+	skuMinCost     float64 // minimum monthly cost of a SKU to report
+
+	creditBreakdown bool // whether to break down the credits by type
+	grossCost       bool // whether to report the costs before credits are applied
+
+	filters []template.HTML // conditions to narrow down the billing data
 }
 
 // NewQueryBuilder constructs QueryBuilder.
@@ -26,6 +55,21 @@ type QueryBuilder struct {
 //
 // `FILE_DIRECTORY` ... the directory name where a query template file `template.sql` is.
 // On Cloud Functions, it must be `serverless_function_source_code/`.
+//
+// Optionally, `COST_GROUPING` selects the dimension of the cost breakdown
+// from `service` (default), `project` and `project_service`,
+// and `COST_LABEL_KEYS` lists comma-separated resource label keys (e.g. `team,env`)
+// to additionally break down the cost by their values.
+//
+// `SKU_TOP_SERVICES` enables SKU-level drill-down for the top N services
+// and `SKU_MIN_COST` sets the minimum monthly cost of the SKUs to report.
+// The drill-down is available only when the cost is grouped by service.
+//
+// `CREDIT_BREAKDOWN=true` additionally breaks down the credits
+// (e.g. sustained use discounts, committed use discounts, promotions) by type.
+//
+// `COST_BASIS=gross` reports the costs before credits are applied instead of the net costs (`net`, default)
+// in both the report and the daily costs.
 func NewQueryBuilder() QueryBuilder {
 
 	projectID := os.Getenv("GCP_PROJECT")
@@ -35,13 +79,169 @@ func NewQueryBuilder() QueryBuilder {
 
 	fileDir := os.Getenv("FILE_DIRECTORY")
 
+	grouping := os.Getenv("COST_GROUPING")
+	switch grouping {
+	case GroupByService, GroupByProject, GroupByProjectService:
+	case "":
+		grouping = GroupByService
+	default:
+		log.Printf("Unknown cost grouping '%s' in environment variable. '%s' is set instead.", grouping, GroupByService)
+		grouping = GroupByService
+	}
+
+	return QueryBuilder{
+		tableID:           tableID,
+		templatePath:      "./" + fileDir + "src/query/template.sql",
+		dailyTemplatePath: "./" + fileDir + "src/query/daily_template.sql",
+		grouping:          grouping,
+		labelKeys:         parseLabelKeys(os.Getenv("COST_LABEL_KEYS")),
+
+		skuTopServices: parseSKUTopServices(os.Getenv("SKU_TOP_SERVICES")),
+		skuMinCost:     parseSKUMinCost(os.Getenv("SKU_MIN_COST")),
+
+		creditBreakdown: parseCreditBreakdown(os.Getenv("CREDIT_BREAKDOWN")),
+		grossCost:       parseCostBasis(os.Getenv("COST_BASIS")) == GrossCost,
+	}
+}
+
+// NewQueryBuilderWith constructs QueryBuilder with the table and the settings of the cost aggregation
+// validated in the config package.
+func NewQueryBuilderWith(table config.BigQuery, settings config.Query) QueryBuilder {
 	return QueryBuilder{
-		tableID:      tableID,
-		templatePath: "./" + fileDir + "src/query/template.sql",
+		tableID:           table.TableID(),
+		templatePath:      "./" + settings.FileDirectory + "src/query/template.sql",
+		dailyTemplatePath: "./" + settings.FileDirectory + "src/query/daily_template.sql",
+		grouping:          settings.Grouping,
+		labelKeys:         validLabelKeys(settings.LabelKeys),
+
+		skuTopServices: settings.SKUTopServices,
+		skuMinCost:     settings.SKUMinCost,
+
+		creditBreakdown: settings.CreditBreakdown,
+		grossCost:       settings.CostBasis == GrossCost,
+
+		filters: filterConditions(settings.Filters),
+	}
+}
+
+// filterConditions converts the filters into the conditions of the query.
+// The values are rendered as escaped string literals
+// and the filters with invalid label keys are skipped.
+func filterConditions(filters config.Filters) []template.HTML {
+	var conditions []template.HTML
+	if len(filters.Projects) > 0 {
+		conditions = append(conditions, template.HTML("IFNULL(project.id, '(no project)') IN ("+sqlStringList(filters.Projects)+")"))
+	}
+	if len(filters.Services) > 0 {
+		conditions = append(conditions, template.HTML("service.description IN ("+sqlStringList(filters.Services)+")"))
+	}
+
+	var keys []string
+	for key := range filters.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !config.LabelKeyPattern.MatchString(key) {
+			log.Printf("Label filter with invalid key '%s' is ignored.", key)
+			continue
+		}
+		conditions = append(conditions, template.HTML(fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM UNNEST(labels) AS l WHERE l.key = %s AND l.value IN (%s))",
+			sqlString(key), sqlStringList(filters.Labels[key]),
+		)))
+	}
+	return conditions
+}
+
+var sqlStringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`)
+
+// sqlString quotes the value as a string literal of BigQuery.
+func sqlString(value string) string {
+	return "'" + sqlStringEscaper.Replace(value) + "'"
+}
+
+func sqlStringList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = sqlString(value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func parseSKUTopServices(value string) int {
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Invalid number of services for SKU drill-down '%s'. The drill-down is disabled.", value)
+		return 0
+	}
+	return n
+}
+
+func parseSKUMinCost(value string) float64 {
+	if value == "" {
+		return 0
+	}
+	minCost, err := strconv.ParseFloat(value, 64)
+	if err != nil || minCost < 0 {
+		log.Printf("Invalid minimum SKU cost '%s'. 0 is set instead.", value)
+		return 0
+	}
+	return minCost
+}
+
+// parseLabelKeys splits comma-separated label keys.
+func parseLabelKeys(value string) []string {
+	return validLabelKeys(strings.Split(value, ","))
+}
+
+// validLabelKeys skips invalid label keys so that they are never rendered into the query.
+func validLabelKeys(keys []string) []string {
+	var labelKeys []string
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if !config.LabelKeyPattern.MatchString(key) {
+			log.Printf("Invalid label key '%s' is ignored.", key)
+			continue
+		}
+		labelKeys = append(labelKeys, key)
+	}
+	return labelKeys
+}
+
+func parseCreditBreakdown(value string) bool {
+	if value == "" {
+		return false
+	}
+	creditBreakdown, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid credit breakdown flag '%s'. The breakdown is disabled.", value)
+		return false
+	}
+	return creditBreakdown
+}
+
+func parseCostBasis(value string) string {
+	switch value {
+	case NetCost, GrossCost:
+		return value
+	case "":
+		return NetCost
+	default:
+		log.Printf("Unknown cost basis '%s' in environment variable. '%s' is set instead.", value, NetCost)
+		return NetCost
 	}
 }
 
 // Build method renders a query tamplate with the cost aggregation period to report and BQ table ID.
+// The costs are compared with the same period of the previous month
+// only if the period is month-to-date or a full month.
 func (b *QueryBuilder) Build(period datetime.ReportingPeriod) string {
 
 	reportingToTimestamp := period.To.Format(time.RFC3339)
@@ -50,16 +250,41 @@ func (b *QueryBuilder) Build(period datetime.ReportingPeriod) string {
 	reportingFromTimestamp := period.From.Format(time.RFC3339)
 	reportingDateFrom := template.HTML(reportingFromTimestamp)
 
+	groupByProject := b.grouping == GroupByProject || b.grouping == GroupByProjectService
+
+	skuTopServices := b.skuTopServices
+	if groupByProject {
+		skuTopServices = 0
+	}
+
 	params := struct {
 		TableName         string
 		TimeZone          string
 		ReportingDateFrom template.HTML
 		ReportingDateTo   template.HTML
+		GroupByService    bool
+		GroupByProject    bool
+		LabelKeys         []string
+		SKUTopServices    int
+		SKUMinCost        template.HTML
+		CreditBreakdown   bool
+		GrossCost         bool
+		CompareMonth      bool
+		Filters           []template.HTML
 	}{
 		TableName:         b.tableID,
 		TimeZone:          period.TimeZone,
 		ReportingDateFrom: reportingDateFrom,
 		ReportingDateTo:   reportingDateTo,
+		GroupByService:    b.grouping != GroupByProject,
+		GroupByProject:    groupByProject,
+		LabelKeys:         b.labelKeys,
+		SKUTopServices:    skuTopServices,
+		SKUMinCost:        template.HTML(strconv.FormatFloat(b.skuMinCost, 'f', -1, 64)),
+		CreditBreakdown:   b.creditBreakdown,
+		GrossCost:         b.grossCost,
+		CompareMonth:      period.IsMonthToDate(),
+		Filters:           b.filters,
 	}
 	var buf bytes.Buffer
 	t := template.Must(template.ParseFiles(b.templatePath))
@@ -67,3 +292,33 @@ func (b *QueryBuilder) Build(period datetime.ReportingPeriod) string {
 
 	return buf.String()
 }
+
+// BuildDaily method renders a query template to retrieve the daily cost of each service
+// from the number of days before the end of the reporting period to the end.
+// The daily costs are on the same basis as the report.
+func (b *QueryBuilder) BuildDaily(period datetime.ReportingPeriod, windowDays int) string {
+
+	reportingToTimestamp := period.To.Format(time.RFC3339)
+	reportingDateTo := template.HTML(reportingToTimestamp)
+
+	params := struct {
+		TableName       string
+		TimeZone        string
+		ReportingDateTo template.HTML
+		WindowDays      int
+		GrossCost       bool
+		Filters         []template.HTML
+	}{
+		TableName:       b.tableID,
+		TimeZone:        period.TimeZone,
+		ReportingDateTo: reportingDateTo,
+		WindowDays:      windowDays,
+		GrossCost:       b.grossCost,
+		Filters:         b.filters,
+	}
+	var buf bytes.Buffer
+	t := template.Must(template.ParseFiles(b.dailyTemplatePath))
+	t.Execute(&buf, params)
+
+	return buf.String()
+}
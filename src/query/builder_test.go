@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
 	"github.com/tatamiya/gcp-cost-notification/src/datetime"
 )
 
@@ -30,4 +31,275 @@ func TestRenderQueryFromTemplateCorrectly(t *testing.T) {
 	assert.True(t, strings.Contains(outputQuery, "2021-05-01T00:00:00+09:00"), outputQuery)
 	assert.True(t, strings.Contains(outputQuery, "2021-05-07T00:00:00+09:00"), outputQuery)
 	assert.True(t, strings.Contains(outputQuery, inputTableID), outputQuery)
+	assert.True(t, strings.Contains(outputQuery, "AS previous_monthly"), outputQuery)
+}
+
+func TestRenderQueryGroupedByProjectAndService(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:      "sample_project.sample_dataset.sample_table",
+		templatePath: "./template.sql",
+		grouping:     GroupByProjectService,
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+
+	assert.True(t, strings.Contains(outputQuery, "GROUP BY\n    project,\n    service\n"), outputQuery)
+	assert.True(t, strings.Contains(outputQuery, "ANY_VALUE(project_name) AS project_name"), outputQuery)
+}
+
+func TestRenderQueryGroupedByProjectOnly(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:      "sample_project.sample_dataset.sample_table",
+		templatePath: "./template.sql",
+		grouping:     GroupByProject,
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+
+	assert.True(t, strings.Contains(outputQuery, "'' AS service,"), outputQuery)
+	assert.True(t, strings.Contains(outputQuery, "GROUP BY\n    project\n"), outputQuery)
+}
+
+func TestRenderQueryWithLabelKeys(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:      "sample_project.sample_dataset.sample_table",
+		templatePath: "./template.sql",
+		labelKeys:    []string{"team", "env"},
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+
+	assert.True(t, strings.Contains(outputQuery, "UNNEST(['team', 'env']) AS label_key"), outputQuery)
+	assert.True(t, strings.Contains(outputQuery, "FROM\n    label_details"), outputQuery)
+}
+
+func TestRenderQueryWithoutLabelKeys(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:      "sample_project.sample_dataset.sample_table",
+		templatePath: "./template.sql",
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+
+	assert.False(t, strings.Contains(outputQuery, "label_details"), outputQuery)
+}
+
+func TestParseLabelKeysSkipsInvalidKeys(t *testing.T) {
+	actualKeys := parseLabelKeys(" team, env ,,Invalid,cost-center,x'); DROP TABLE")
+
+	assert.EqualValues(t, []string{"team", "env", "cost-center"}, actualKeys)
+}
+
+func TestRenderQueryWithSKUDrillDown(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:        "sample_project.sample_dataset.sample_table",
+		templatePath:   "./template.sql",
+		grouping:       GroupByService,
+		skuTopServices: 3,
+		skuMinCost:     0.5,
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+
+	assert.True(t, strings.Contains(outputQuery, "LIMIT\n      3)"), outputQuery)
+	assert.True(t, strings.Contains(outputQuery, "monthly >= 0.5 )"), outputQuery)
+}
+
+func TestNotRenderSKUDrillDownWhenGroupedByProject(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:        "sample_project.sample_dataset.sample_table",
+		templatePath:   "./template.sql",
+		grouping:       GroupByProjectService,
+		skuTopServices: 3,
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+
+	assert.False(t, strings.Contains(outputQuery, "sku_details"), outputQuery)
+}
+
+func TestParseSKUDrillDownSettings(t *testing.T) {
+	assert.EqualValues(t, 5, parseSKUTopServices("5"))
+	assert.EqualValues(t, 0, parseSKUTopServices(""))
+	assert.EqualValues(t, 0, parseSKUTopServices("-1"))
+	assert.EqualValues(t, 0, parseSKUTopServices("five"))
+
+	assert.EqualValues(t, 10.5, parseSKUMinCost("10.5"))
+	assert.EqualValues(t, 0, parseSKUMinCost(""))
+	assert.EqualValues(t, 0, parseSKUMinCost("ten"))
+}
+
+func TestRenderQueryWithCreditBreakdown(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:         "sample_project.sample_dataset.sample_table",
+		templatePath:    "./template.sql",
+		creditBreakdown: true,
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+
+	assert.True(t, strings.Contains(outputQuery, "WHEN is_this_month THEN cost + credit"), outputQuery)
+	assert.True(t, strings.Contains(outputQuery, "FROM\n    credit_details"), outputQuery)
+}
+
+func TestRenderQueryComparingWithPreviousMonth(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:      "sample_project.sample_dataset.sample_table",
+		templatePath: "./template.sql",
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 4, 30, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+
+	assert.True(t, strings.Contains(outputQuery,
+		"SET previous_date_to = IF(date_to = LAST_DAY(date_to), LAST_DAY(previous_date_from), DATE_SUB(date_to, INTERVAL 1 MONTH));"), outputQuery)
+	assert.True(t, strings.Contains(outputQuery,
+		"IFNULL(AVG(IF(is_this_month, currency_conversion_rate, NULL)), 0) AS currency_conversion_rate"), outputQuery)
+}
+
+func TestRenderQueryNotComparingOtherPeriodsWithPreviousMonth(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:      "sample_project.sample_dataset.sample_table",
+		templatePath: "./template.sql",
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 4, 24, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 4, 30, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+
+	assert.True(t, strings.Contains(outputQuery, "SET previous_date_from = DATE_SUB(date_from, INTERVAL 1 DAY);"), outputQuery)
+	assert.False(t, strings.Contains(outputQuery, "SET previous_date_to"), outputQuery)
+}
+
+func TestRenderDailyQueryWithWindowDays(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:           "sample_project.sample_dataset.sample_table",
+		dailyTemplatePath: "./daily_template.sql",
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.BuildDaily(inputReportingPeriod, 28)
+
+	assert.True(t, strings.Contains(outputQuery, "2021-05-07T00:00:00Z"), outputQuery)
+	assert.True(t, strings.Contains(outputQuery, "DATE_SUB(date_to, INTERVAL 28 DAY)"), outputQuery)
+	assert.True(t, strings.Contains(outputQuery, "FORMAT_DATE('%Y-%m-%d', DATE(usage_end_time, timezone)) AS usage_date"), outputQuery)
+	assert.True(t, strings.Contains(outputQuery, "`sample_project.sample_dataset.sample_table`"), outputQuery)
+}
+
+func TestRenderGrossCostsInBothQueries(t *testing.T) {
+	builder := QueryBuilder{
+		tableID:           "sample_project.sample_dataset.sample_table",
+		templatePath:      "./template.sql",
+		dailyTemplatePath: "./daily_template.sql",
+		grossCost:         true,
+	}
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+	outputQuery := builder.Build(inputReportingPeriod)
+	outputDailyQuery := builder.BuildDaily(inputReportingPeriod, 28)
+
+	assert.True(t, strings.Contains(outputQuery, "WHEN is_this_month THEN cost\n"), outputQuery)
+	assert.False(t, strings.Contains(outputQuery, "THEN cost + credit"), outputQuery)
+	assert.True(t, strings.Contains(outputDailyQuery, "ROUND(SUM(cost),2) AS cost"), outputDailyQuery)
+}
+
+func TestConstructQueryBuilderFromConfig(t *testing.T) {
+	builder := NewQueryBuilderWith(
+		config.BigQuery{ProjectID: "sample_project", DatasetName: "sample_dataset", TableName: "sample_table"},
+		config.Query{FileDirectory: "functions/", Grouping: GroupByProject, LabelKeys: []string{"team", "Invalid"}, SKUTopServices: 3, CostBasis: GrossCost},
+	)
+
+	assert.EqualValues(t, QueryBuilder{
+		tableID:           "sample_project.sample_dataset.sample_table",
+		templatePath:      "./functions/src/query/template.sql",
+		dailyTemplatePath: "./functions/src/query/daily_template.sql",
+		grouping:          GroupByProject,
+		labelKeys:         []string{"team"},
+		skuTopServices:    3,
+		grossCost:         true,
+	}, builder)
+}
+
+func TestRenderQueryWithFilters(t *testing.T) {
+	builder := NewQueryBuilderWith(
+		config.BigQuery{ProjectID: "sample_project", DatasetName: "sample_dataset", TableName: "sample_table"},
+		config.Query{Filters: config.Filters{
+			Projects: []string{"project-a", "project-b"},
+			Services: []string{"Cloud SQL"},
+			Labels:   map[string][]string{"team": {"data"}, "env": {"prod", "x'); DROP TABLE"}},
+		}},
+	)
+	builder.templatePath = "./template.sql"
+	builder.dailyTemplatePath = "./daily_template.sql"
+
+	inputReportingPeriod := datetime.ReportingPeriod{
+		TimeZone: "UTC",
+		From:     time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2021, 5, 7, 0, 0, 0, 0, time.UTC),
+	}
+
+	expectedConditions := `
+    AND IFNULL(project.id, '(no project)') IN ('project-a', 'project-b')
+    AND service.description IN ('Cloud SQL')
+    AND EXISTS (SELECT 1 FROM UNNEST(labels) AS l WHERE l.key = 'env' AND l.value IN ('prod', 'x\'); DROP TABLE'))
+    AND EXISTS (SELECT 1 FROM UNNEST(labels) AS l WHERE l.key = 'team' AND l.value IN ('data'))),`
+	outputQuery := builder.Build(inputReportingPeriod)
+	assert.True(t, strings.Contains(outputQuery, "BETWEEN previous_date_from AND date_to"+expectedConditions), outputQuery)
+
+	outputDailyQuery := builder.BuildDaily(inputReportingPeriod, 28)
+	assert.True(t, strings.Contains(outputDailyQuery, "AND service.description IN ('Cloud SQL')\n"), outputDailyQuery)
+}
+
+func TestQuoteSQLString(t *testing.T) {
+	assert.EqualValues(t, `'it\'s a \\ test\n'`, sqlString("it's a \\ test\n"))
 }
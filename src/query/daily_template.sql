@@ -0,0 +1,34 @@
+DECLARE timezone STRING;
+DECLARE date_from DATE;
+DECLARE date_to DATE;
+
+SET timezone = '{{.TimeZone}}';
+SET date_to = DATE(TIMESTAMP('{{.ReportingDateTo}}'), timezone);
+SET date_from = DATE_SUB(date_to, INTERVAL {{.WindowDays}} DAY);
+
+SELECT
+  service.description AS service,
+  FORMAT_DATE('%Y-%m-%d', DATE(usage_end_time, timezone)) AS usage_date,
+{{- if .GrossCost}}
+  ROUND(SUM(cost),2) AS cost
+{{- else}}
+  ROUND(SUM(cost + IFNULL((
+        SELECT
+          SUM(c.amount)
+        FROM
+          UNNEST(credits) AS c), 0)),2) AS cost
+{{- end}}
+FROM
+  `{{.TableName}}`
+WHERE
+  DATE(_PARTITIONTIME, timezone) BETWEEN date_from AND date_to
+  AND DATE(usage_end_time, timezone) BETWEEN date_from AND date_to
+{{- range .Filters}}
+  AND {{.}}
+{{- end}}
+GROUP BY
+  service,
+  usage_date
+ORDER BY
+  service,
+  usage_date
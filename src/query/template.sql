@@ -1,50 +1,358 @@
 DECLARE timezone STRING;
 DECLARE date_from DATE;
 DECLARE date_to DATE;
+DECLARE previous_date_from DATE;
+DECLARE previous_date_to DATE;
 
 SET timezone = '{{.TimeZone}}';
 SET date_from = DATE(TIMESTAMP('{{.ReportingDateFrom}}'), timezone);
 SET date_to = DATE(TIMESTAMP('{{.ReportingDateTo}}'), timezone);
+-- The range from previous_date_from to date_to also covers the day before date_to.
+{{- if .CompareMonth}}
+-- The same period in the previous month to compare the costs with.
+-- A period ending on the last day of the month is compared up to the last day of the previous month.
+SET previous_date_from = DATE_SUB(date_from, INTERVAL 1 MONTH);
+SET previous_date_to = IF(date_to = LAST_DAY(date_to), LAST_DAY(previous_date_from), DATE_SUB(date_to, INTERVAL 1 MONTH));
+{{- else}}
+-- Other periods are not compared with the previous month: previous_date_to is left NULL.
+SET previous_date_from = DATE_SUB(date_from, INTERVAL 1 DAY);
+{{- end}}
 
 WITH
-  this_month AS(
+  usage AS(
   SELECT
     service.description AS service,
-    cost AS monthly,
+    sku.description AS sku,
+    IFNULL(project.id, '(no project)') AS project,
+    IFNULL(project.name, '') AS project_name,
+    labels,
+    credits,
+    currency,
+    currency_conversion_rate,
+    export_time,
+    cost,
+    IFNULL((
+      SELECT
+        SUM(c.amount)
+      FROM
+        UNNEST(credits) AS c), 0) AS credit,
+    DATE(usage_end_time, timezone) AS usage_date,
+    DATE(usage_end_time, timezone) BETWEEN date_from AND date_to AS is_this_month,
+    DATE(usage_end_time, timezone) = date_to AS is_yesterday
+  FROM
+    `{{.TableName}}`
+  WHERE
+    DATE(_PARTITIONTIME, timezone) BETWEEN previous_date_from AND date_to
+    AND DATE(usage_end_time, timezone) BETWEEN previous_date_from AND date_to
+{{- range .Filters}}
+    AND {{.}}
+{{- end}}),
+  this_month AS(
+  SELECT
+    service,
+    sku,
+    project,
+    project_name,
+    labels,
+    CASE
+      WHEN is_this_month THEN credits
+    ELSE
+      NULL
+    END
+    AS credits,
+    currency,
+    currency_conversion_rate,
+    export_time,
+    is_this_month,
+    is_yesterday,
+    CASE
+      WHEN is_this_month THEN {{if .GrossCost}}cost{{else}}cost + credit{{end}}
+    ELSE
+      0
+    END
+    AS monthly,
+    CASE
+      WHEN is_this_month THEN credit
+    ELSE
+      0
+    END
+    AS monthly_credits,
+    CASE
+      WHEN is_yesterday THEN {{if .GrossCost}}cost{{else}}cost + credit{{end}}
+    ELSE
+      0
+    END
+    AS yesterday,
+    CASE
+      WHEN is_yesterday THEN credit
+    ELSE
+      0
+    END
+    AS yesterday_credits,
     CASE
-      WHEN DATE(usage_end_time, timezone) = date_to THEN cost
+      WHEN usage_date = DATE_SUB(date_to, INTERVAL 1 DAY) THEN {{if .GrossCost}}cost{{else}}cost + credit{{end}}
     ELSE
       0
     END
-    AS yesterday
+    AS day_before_yesterday,
+    CASE
+      WHEN usage_date BETWEEN previous_date_from AND previous_date_to THEN {{if .GrossCost}}cost{{else}}cost + credit{{end}}
+    ELSE
+      0
+    END
+    AS previous_monthly
   FROM
-    `{{.TableName}}`
-  WHERE
-    DATE(_PARTITIONTIME, timezone) BETWEEN date_from AND date_to
-    AND DATE(usage_end_time, timezone) BETWEEN date_from AND date_to),
+    usage),
   details AS (
   SELECT
+{{- if .GroupByService}}
     service,
+{{- else}}
+    '' AS service,
+{{- end}}
+{{- if .GroupByProject}}
+    project,
+    ANY_VALUE(project_name) AS project_name,
+{{- else}}
+    '' AS project,
+    '' AS project_name,
+{{- end}}
     ROUND(SUM(monthly),2) AS monthly,
-    ROUND(SUM(yesterday),2) AS yesterday
+    ROUND(SUM(yesterday),2) AS yesterday,
+    ROUND(SUM(monthly_credits),2) AS monthly_credits,
+    ROUND(SUM(yesterday_credits),2) AS yesterday_credits,
+    ROUND(SUM(day_before_yesterday),2) AS day_before_yesterday,
+    ROUND(SUM(previous_monthly),2) AS previous_monthly
   FROM
     this_month
   GROUP BY
+{{- if .GroupByProject}}
+    project{{if .GroupByService}},{{end}}
+{{- end}}
+{{- if .GroupByService}}
     service
+{{- end}}
   HAVING
     monthly > 0 )
+{{- if .LabelKeys}},
+  labelled AS (
+  SELECT
+    label_key,
+    label_order,
+    IFNULL((
+      SELECT
+        l.value
+      FROM
+        UNNEST(labels) AS l
+      WHERE
+        l.key = label_key
+      LIMIT
+        1), '') AS label_value,
+    monthly,
+    yesterday,
+    monthly_credits,
+    yesterday_credits,
+    day_before_yesterday,
+    previous_monthly
+  FROM
+    this_month,
+    UNNEST([{{range $i, $key := .LabelKeys}}{{if $i}}, {{end}}'{{$key}}'{{end}}]) AS label_key
+  WITH
+  OFFSET
+    AS label_order),
+  label_details AS (
+  SELECT
+    label_key,
+    label_order,
+    label_value,
+    ROUND(SUM(monthly),2) AS monthly,
+    ROUND(SUM(yesterday),2) AS yesterday,
+    ROUND(SUM(monthly_credits),2) AS monthly_credits,
+    ROUND(SUM(yesterday_credits),2) AS yesterday_credits,
+    ROUND(SUM(day_before_yesterday),2) AS day_before_yesterday,
+    ROUND(SUM(previous_monthly),2) AS previous_monthly
+  FROM
+    labelled
+  GROUP BY
+    label_key,
+    label_order,
+    label_value
+  HAVING
+    monthly > 0 )
+{{- end}}
+{{- if .SKUTopServices}},
+  sku_details AS (
+  SELECT
+    service,
+    sku,
+    ROUND(SUM(monthly),2) AS monthly,
+    ROUND(SUM(yesterday),2) AS yesterday,
+    ROUND(SUM(monthly_credits),2) AS monthly_credits,
+    ROUND(SUM(yesterday_credits),2) AS yesterday_credits,
+    ROUND(SUM(day_before_yesterday),2) AS day_before_yesterday,
+    ROUND(SUM(previous_monthly),2) AS previous_monthly
+  FROM
+    this_month
+  WHERE
+    service IN (
+    SELECT
+      service
+    FROM
+      this_month
+    GROUP BY
+      service
+    ORDER BY
+      SUM(monthly) DESC
+    LIMIT
+      {{.SKUTopServices}})
+  GROUP BY
+    service,
+    sku
+  HAVING
+    monthly > 0
+    AND monthly >= {{.SKUMinCost}} )
+{{- end}}
+{{- if .CreditBreakdown}},
+  credit_details AS (
+  SELECT
+    IFNULL(c.type, c.name) AS credit_type,
+    ROUND(SUM(c.amount),2) AS monthly,
+    ROUND(SUM(
+        CASE
+          WHEN is_yesterday THEN c.amount
+        ELSE
+          0
+        END
+        ),2) AS yesterday
+  FROM
+    this_month,
+    UNNEST(credits) AS c
+  GROUP BY
+    credit_type
+  HAVING
+    monthly < 0 )
+{{- end}}
 SELECT
-  'Total' AS service,
-  ROUND(SUM(monthly),2) AS monthly,
-  ROUND(SUM(yesterday),2) AS yesterday
-FROM
-  this_month
-UNION ALL
-SELECT
-  service,
-  monthly,
-  yesterday
-FROM
-  details
+  * EXCEPT(row_order,
+    label_order)
+FROM (
+  SELECT
+    'Total' AS service,
+    '' AS sku,
+    '' AS project,
+    '' AS project_name,
+    '' AS label_key,
+    '' AS label_value,
+    '' AS credit_type,
+    ROUND(SUM(monthly),2) AS monthly,
+    ROUND(SUM(yesterday),2) AS yesterday,
+    ROUND(SUM(monthly_credits),2) AS monthly_credits,
+    ROUND(SUM(yesterday_credits),2) AS yesterday_credits,
+    ROUND(SUM(day_before_yesterday),2) AS day_before_yesterday,
+    ROUND(SUM(previous_monthly),2) AS previous_monthly,
+    IFNULL(ANY_VALUE(currency), '') AS currency,
+    IFNULL(AVG(IF(is_this_month, currency_conversion_rate, NULL)), 0) AS currency_conversion_rate,
+    IFNULL(MAX(export_time), TIMESTAMP_SECONDS(0)) AS last_export_time,
+    0 AS row_order,
+    0 AS label_order
+  FROM
+    this_month
+  UNION ALL
+  SELECT
+    service,
+    '' AS sku,
+    project,
+    project_name,
+    '' AS label_key,
+    '' AS label_value,
+    '' AS credit_type,
+    monthly,
+    yesterday,
+    monthly_credits,
+    yesterday_credits,
+    day_before_yesterday,
+    previous_monthly,
+    '' AS currency,
+    0.0 AS currency_conversion_rate,
+    TIMESTAMP_SECONDS(0) AS last_export_time,
+    1 AS row_order,
+    0 AS label_order
+  FROM
+    details
+{{- if .LabelKeys}}
+  UNION ALL
+  SELECT
+    '' AS service,
+    '' AS sku,
+    '' AS project,
+    '' AS project_name,
+    label_key,
+    label_value,
+    '' AS credit_type,
+    monthly,
+    yesterday,
+    monthly_credits,
+    yesterday_credits,
+    day_before_yesterday,
+    previous_monthly,
+    '' AS currency,
+    0.0 AS currency_conversion_rate,
+    TIMESTAMP_SECONDS(0) AS last_export_time,
+    2 AS row_order,
+    label_order
+  FROM
+    label_details
+{{- end}}
+{{- if .SKUTopServices}}
+  UNION ALL
+  SELECT
+    service,
+    sku,
+    '' AS project,
+    '' AS project_name,
+    '' AS label_key,
+    '' AS label_value,
+    '' AS credit_type,
+    monthly,
+    yesterday,
+    monthly_credits,
+    yesterday_credits,
+    day_before_yesterday,
+    previous_monthly,
+    '' AS currency,
+    0.0 AS currency_conversion_rate,
+    TIMESTAMP_SECONDS(0) AS last_export_time,
+    3 AS row_order,
+    0 AS label_order
+  FROM
+    sku_details
+{{- end}}
+{{- if .CreditBreakdown}}
+  UNION ALL
+  SELECT
+    '' AS service,
+    '' AS sku,
+    '' AS project,
+    '' AS project_name,
+    '' AS label_key,
+    '' AS label_value,
+    credit_type,
+    monthly,
+    yesterday,
+    monthly AS monthly_credits,
+    yesterday AS yesterday_credits,
+    0.0 AS day_before_yesterday,
+    0.0 AS previous_monthly,
+    '' AS currency,
+    0.0 AS currency_conversion_rate,
+    TIMESTAMP_SECONDS(0) AS last_export_time,
+    4 AS row_order,
+    0 AS label_order
+  FROM
+    credit_details
+{{- end}}
+  )
 ORDER BY
-  monthly DESC
\ No newline at end of file
+  row_order,
+  label_order,
+  ABS(monthly) DESC
@@ -0,0 +1,84 @@
+package trigger
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+// SignatureAttribute is the attribute of the Pub/Sub message with the signature of the data.
+const SignatureAttribute = "signature"
+
+func NewPublishError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Trigger Publication",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// Publisher is a client to publish a Request to the Pub/Sub topic of the cost notification,
+// so that the report is run by another invocation of the function.
+type Publisher struct {
+	projectID string
+	topic     string
+	secret    string
+}
+
+// NewPublisherWith constructs a Publisher to the topic in the project
+// signing the requests with the secret.
+func NewPublisherWith(projectID string, topic string, secret string) Publisher {
+	return Publisher{projectID: projectID, topic: topic, secret: secret}
+}
+
+// Publish method publishes the request as the data of a message with its signature
+// and waits until the topic accepts it.
+func (p *Publisher) Publish(request *Request) *utils.CustomError {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return NewPublishError("Could not encode the request!", err)
+	}
+
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, p.projectID)
+	if err != nil {
+		return NewPublishError("Failed in connecting to Pub/Sub", err)
+	}
+	defer client.Close()
+
+	topic := client.Topic(p.topic)
+	defer topic.Stop()
+	message := &pubsub.Message{
+		Data:       data,
+		Attributes: map[string]string{SignatureAttribute: Sign(data, p.secret)},
+	}
+	if _, err := topic.Publish(ctx, message).Get(ctx); err != nil {
+		return NewPublishError("Failed in publishing the request", err)
+	}
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the data with the secret.
+func Sign(data []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature of the data published by Publisher.
+// It fails without the secret, so that an unsigned request is never trusted.
+func VerifySignature(data []byte, signature string, secret string) *utils.CustomError {
+	if secret == "" {
+		return NewTriggerError("Unverified message!", fmt.Errorf("the secret to verify the signature is not set"))
+	}
+	if !hmac.Equal([]byte(Sign(data, secret)), []byte(signature)) {
+		return NewTriggerError("Unverified message!", fmt.Errorf("the signature does not match the data"))
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package trigger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySignedRequest(t *testing.T) {
+	data := []byte(`{"response_url":"https://hooks.slack.com/commands/T/1/x"}`)
+
+	err := VerifySignature(data, Sign(data, "secret"), "secret")
+
+	assert.Nil(t, err)
+}
+
+func TestRejectUnverifiedRequest(t *testing.T) {
+	data := []byte(`{"response_url":"https://hooks.slack.com/commands/T/1/x"}`)
+	signature := Sign(data, "secret")
+
+	err := VerifySignature([]byte(`{"response_url":"https://hooks.slack.com/commands/T/2/y"}`), signature, "secret")
+	assert.EqualValues(t, "Error in Trigger Message. Unverified message!: the signature does not match the data", err.Error())
+
+	err = VerifySignature(data, "", "secret")
+	assert.NotNil(t, err)
+
+	err = VerifySignature(data, Sign(data, ""), "")
+	assert.EqualValues(t, "Error in Trigger Message. Unverified message!: the secret to verify the signature is not set", err.Error())
+}
@@ -0,0 +1,378 @@
+// trigger package implements parsing of the Pub/Sub message and the HTTP request
+// which control a run of the cost notification.
+package trigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+	"github.com/tatamiya/gcp-cost-notification/src/datetime"
+	"github.com/tatamiya/gcp-cost-notification/src/notification"
+	"github.com/tatamiya/gcp-cost-notification/src/query"
+	"github.com/tatamiya/gcp-cost-notification/src/utils"
+)
+
+func NewTriggerError(message string, err error) *utils.CustomError {
+	return &utils.CustomError{
+		Process: "Trigger Message",
+		Message: message,
+		Err:     err,
+	}
+}
+
+// DateLayout is the layout of the dates in the message.
+const DateLayout = "2006-01-02"
+
+// SlackResponseHost is the only host accepted in the response URL of a slash command.
+const SlackResponseHost = "hooks.slack.com"
+
+// MaxPeriodDays is the maximum number of days from From to To.
+// It keeps the queries of an explicit period as small as a quarter.
+const MaxPeriodDays = 92
+
+// Request is the JSON payload of the Pub/Sub message, e.g.
+// `{"report": "finance", "reporting_date": "2021-08-01", "period": "previous_month", "dry_run": true, "destinations": ["slack"]}`.
+// All the fields are optional.
+//
+// From and To set the reporting period explicitly instead of the reporting date and the period rule.
+//
+// ResponseURL is set in the requests of the slash commands published by Publisher.
+// The report is posted only to the response URL instead of the destinations,
+// and such a request must be signed (see VerifySignature).
+type Request struct {
+	Report        string          `json:"report,omitempty"`         // name of the report to run (all the reports if empty)
+	ReportingDate string          `json:"reporting_date,omitempty"` // date to run the report as of (the execution date if empty)
+	Period        string          `json:"period,omitempty"`         // period rule overriding that of the reports
+	From          string          `json:"from,omitempty"`           // first date of the reporting period
+	To            string          `json:"to,omitempty"`             // last date of the reporting period
+	Grouping      string          `json:"grouping,omitempty"`       // cost grouping overriding that of the reports
+	Filters       *config.Filters `json:"filters,omitempty"`        // filters replacing those of the reports
+	DryRun        bool            `json:"dry_run,omitempty"`        // log the messages instead of sending them
+	Destinations  []string        `json:"destinations,omitempty"`   // destinations overriding those of the reports
+	ResponseURL   string          `json:"response_url,omitempty"`   // response URL of the slash command to post the report to
+}
+
+// Parse parses and validates the payload of a Pub/Sub message.
+// An empty payload runs all the reports as configured.
+//
+// Unknown fields, invalid values and unknown destinations are reported at once in the returned error.
+func Parse(data []byte) (*Request, *utils.CustomError) {
+	request := &Request{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return request, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(request)
+	if err == nil && decoder.More() {
+		err = fmt.Errorf("unexpected data after the JSON object")
+	}
+	if err != nil {
+		return nil, NewTriggerError("Malformed message payload!", err)
+	}
+
+	problems := request.problems()
+	if len(problems) > 0 {
+		return nil, NewTriggerError("Invalid message payload!", fmt.Errorf("%s", strings.Join(problems, "; ")))
+	}
+	return request, nil
+}
+
+// ParseQuery parses and validates the query parameters of an HTTP request
+// to report the costs on demand, e.g.
+// `?period=previous_month&grouping=service&project=my-project&label=team:data`.
+//
+// `report`, `reporting_date`, `period`, `from`, `to` and `grouping` are the same as the fields of Request.
+// `project`, `service` and `label` (`key:value`) can be repeated to filter the costs.
+func ParseQuery(values url.Values) (*Request, *utils.CustomError) {
+	request := &Request{}
+	var problems []string
+
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch name {
+		case "report", "reporting_date", "period", "from", "to", "grouping":
+			if len(values[name]) > 1 {
+				problems = append(problems, fmt.Sprintf("%s must not be repeated", name))
+			}
+		case "project", "service", "label":
+			if request.Filters == nil {
+				request.Filters = &config.Filters{}
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("unknown parameter: '%s'", name))
+		}
+	}
+
+	request.Report = values.Get("report")
+	request.ReportingDate = values.Get("reporting_date")
+	request.Period = values.Get("period")
+	request.From = values.Get("from")
+	request.To = values.Get("to")
+	request.Grouping = values.Get("grouping")
+	if request.Filters != nil {
+		request.Filters.Projects = values["project"]
+		request.Filters.Services = values["service"]
+		for _, label := range values["label"] {
+			separator := strings.Index(label, ":")
+			if separator < 0 {
+				problems = append(problems, fmt.Sprintf("label must be in key:value format: '%s'", label))
+				continue
+			}
+			if request.Filters.Labels == nil {
+				request.Filters.Labels = map[string][]string{}
+			}
+			key := label[:separator]
+			request.Filters.Labels[key] = append(request.Filters.Labels[key], label[separator+1:])
+		}
+	}
+
+	problems = append(problems, request.problems()...)
+	if len(problems) > 0 {
+		return nil, NewTriggerError("Invalid query parameters!", fmt.Errorf("%s", strings.Join(problems, "; ")))
+	}
+	return request, nil
+}
+
+// Aliases of the period rules in a slash command.
+var commandPeriods = map[string]string{
+	"mtd":                        datetime.PeriodMonthToDate,
+	datetime.PeriodMonthToDate:   datetime.PeriodMonthToDate,
+	"last_month":                 datetime.PeriodPreviousMonth,
+	datetime.PeriodPreviousMonth: datetime.PeriodPreviousMonth,
+	"last_week":                  datetime.PeriodLast7Days,
+	"7d":                         datetime.PeriodLast7Days,
+	datetime.PeriodLast7Days:     datetime.PeriodLast7Days,
+}
+
+// ParseCommand parses and validates the text of a slash command `[project] [period]`, e.g. `my-project last_month`.
+//
+// The period is `mtd` (default), `last_month`, `last_week` (the 7 days before) or `2021-08-01..2021-08-07`,
+// and the other argument is the project ID to filter the costs.
+func ParseCommand(text string) (*Request, *utils.CustomError) {
+	values := url.Values{}
+	var problems []string
+	for _, arg := range strings.Fields(text) {
+		if period, ok := commandPeriods[strings.ToLower(arg)]; ok {
+			values.Add("period", period)
+			continue
+		}
+		if dates := strings.Split(arg, ".."); len(dates) == 2 {
+			values.Add("from", dates[0])
+			values.Add("to", dates[1])
+			continue
+		}
+		if values.Get("project") != "" {
+			problems = append(problems, fmt.Sprintf("unexpected argument: '%s'", arg))
+			continue
+		}
+		values.Add("project", arg)
+	}
+	if len(values["period"])+len(values["from"]) > 1 {
+		problems = append(problems, "period must not be repeated")
+		values.Del("period")
+	}
+	if len(problems) > 0 {
+		return nil, NewTriggerError("Invalid command arguments!", fmt.Errorf("%s", strings.Join(problems, "; ")))
+	}
+
+	request, err := ParseQuery(values)
+	if err != nil {
+		return nil, NewTriggerError("Invalid command arguments!", err.Err)
+	}
+	return request, nil
+}
+
+// problems lists the invalid values of the request.
+func (r *Request) problems() []string {
+	var problems []string
+	parseDate := func(name string, value string) (time.Time, bool) {
+		date, err := time.Parse(DateLayout, value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be in YYYY-MM-DD format: '%s'", name, value))
+			return date, false
+		}
+		return date, true
+	}
+
+	if r.ReportingDate != "" {
+		parseDate("reporting_date", r.ReportingDate)
+	}
+	switch r.Period {
+	case "", datetime.PeriodMonthToDate, datetime.PeriodPreviousMonth, datetime.PeriodLast7Days:
+	default:
+		problems = append(problems, fmt.Sprintf("period must be one of %s, %s, %s: '%s'",
+			datetime.PeriodMonthToDate, datetime.PeriodPreviousMonth, datetime.PeriodLast7Days, r.Period))
+	}
+
+	if r.From != "" || r.To != "" {
+		if r.From == "" || r.To == "" {
+			problems = append(problems, "from and to must be set together")
+		} else {
+			from, fromOK := parseDate("from", r.From)
+			to, toOK := parseDate("to", r.To)
+			if fromOK && toOK && from.After(to) {
+				problems = append(problems, fmt.Sprintf("from must not be after to: '%s' > '%s'", r.From, r.To))
+			} else if fromOK && toOK && int(to.Sub(from).Hours()/24)+1 > MaxPeriodDays {
+				problems = append(problems, fmt.Sprintf("from and to must be within %d days: '%s'..'%s'", MaxPeriodDays, r.From, r.To))
+			}
+		}
+		if r.ReportingDate != "" || r.Period != "" {
+			problems = append(problems, "from and to cannot be used with reporting_date or period")
+		}
+	}
+
+	switch r.Grouping {
+	case "", query.GroupByService, query.GroupByProject, query.GroupByProjectService:
+	default:
+		problems = append(problems, fmt.Sprintf("grouping must be one of %s, %s, %s: '%s'",
+			query.GroupByService, query.GroupByProject, query.GroupByProjectService, r.Grouping))
+	}
+	if r.Filters != nil {
+		var keys []string
+		for key := range r.Filters.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !config.LabelKeyPattern.MatchString(key) {
+				problems = append(problems, fmt.Sprintf("label key is invalid: '%s'", key))
+			}
+		}
+	}
+
+	if r.ResponseURL != "" {
+		if parsed, err := url.Parse(r.ResponseURL); err != nil || parsed.Scheme != "https" || parsed.Host != SlackResponseHost {
+			problems = append(problems, fmt.Sprintf("response_url must be an https URL of %s: '%s'", SlackResponseHost, r.ResponseURL))
+		}
+		if r.DryRun || r.Destinations != nil {
+			problems = append(problems, "response_url cannot be used with dry_run or destinations")
+		}
+	}
+
+	if r.Destinations != nil && len(r.Destinations) == 0 {
+		problems = append(problems, "destinations must not be empty")
+	}
+	for _, destination := range r.Destinations {
+		if !notification.HasNotifier(destination) {
+			problems = append(problems, fmt.Sprintf("destinations has an unknown destination: '%s'", destination))
+		}
+	}
+	return problems
+}
+
+// HasExplicitDate returns true if the request designates the reporting date or the period explicitly,
+// e.g. to backfill a report of the past.
+func (r *Request) HasExplicitDate() bool {
+	return r.ReportingDate != "" || r.From != "" || r.To != ""
+}
+
+// ValidatePeriod checks that the explicit period ends by the day before the current date,
+// since the costs of the current date are not complete yet.
+func (r *Request) ValidatePeriod(now time.Time) *utils.CustomError {
+	if r.To == "" {
+		return nil
+	}
+	to, err := time.Parse(DateLayout, r.To)
+	if err != nil {
+		return NewTriggerError("Invalid reporting period!", err)
+	}
+	yesterday := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.UTC)
+	if to.After(yesterday) {
+		return NewTriggerError("Invalid reporting period!", fmt.Errorf("to must not be later than yesterday (%s): '%s'", yesterday.Format(DateLayout), r.To))
+	}
+	return nil
+}
+
+// ReportingDateTime returns the beginning of the reporting date in the location of the current datetime,
+// or the current datetime if the reporting date is not set.
+func (r *Request) ReportingDateTime(now time.Time) time.Time {
+	if r.ReportingDate == "" {
+		return now
+	}
+	date, _ := time.Parse(DateLayout, r.ReportingDate)
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// ReportingPeriod returns the period from From to To in the location of the current datetime if they are set.
+// Otherwise, the period is decided by the period rule of the report as of the reporting date.
+func (r *Request) ReportingPeriod(now time.Time, report config.Report) datetime.ReportingPeriod {
+	if r.From == "" {
+		return datetime.NewReportingPeriodByRule(r.ReportingDateTime(now), report.Period)
+	}
+	location := now.Location()
+	from, _ := time.ParseInLocation(DateLayout, r.From, location)
+	to, _ := time.ParseInLocation(DateLayout, r.To, location)
+	return datetime.ReportingPeriod{TimeZone: location.String(), From: from, To: to}
+}
+
+// Select returns the reports to run with the settings overridden.
+// It fails if the report is not found or the overridden settings are invalid.
+func (r *Request) Select(settings *config.Config) ([]config.Report, *utils.CustomError) {
+	var reports []config.Report
+	var names []string
+	for _, report := range settings.ReportList() {
+		names = append(names, report.Name)
+		if r.Report != "" && report.Name != r.Report {
+			continue
+		}
+		overridden, err := r.override(report)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, overridden)
+	}
+
+	if len(reports) == 0 {
+		return nil, NewTriggerError("Unknown report!", fmt.Errorf("'%s' is not in the reports (%s)", r.Report, strings.Join(names, ", ")))
+	}
+	return reports, nil
+}
+
+// SelectOne returns the report with the settings overridden,
+// which is the default report if no report is designated.
+func (r *Request) SelectOne(settings *config.Config) (config.Report, *utils.CustomError) {
+	if r.Report == "" {
+		return r.override(settings.Report)
+	}
+	reports, err := r.Select(settings)
+	if err != nil {
+		return config.Report{}, err
+	}
+	return reports[0], nil
+}
+
+// override replaces the settings of the report with those of the request.
+// The budgets are of the costs as the report is configured,
+// so they are disabled when the grouping or the filters are overridden.
+func (r *Request) override(report config.Report) (config.Report, *utils.CustomError) {
+	if r.Period != "" {
+		report.Period = r.Period
+	}
+	if r.Grouping != "" && r.Grouping != report.Query.Grouping {
+		report.Query.Grouping = r.Grouping
+		report.Budget = config.Budget{}
+	}
+	if r.Filters != nil {
+		report.Query.Filters = *r.Filters
+		report.Budget = config.Budget{}
+	}
+	if r.Destinations != nil {
+		report.Notifier.Destinations = r.Destinations
+		if err := report.Validate(); err != nil {
+			return config.Report{}, err
+		}
+	}
+	return report, nil
+}
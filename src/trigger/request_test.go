@@ -0,0 +1,233 @@
+package trigger
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tatamiya/gcp-cost-notification/src/config"
+)
+
+func newInputConfig() *config.Config {
+	return &config.Config{
+		Report: config.Report{
+			BigQuery: config.BigQuery{ProjectID: "p", DatasetName: "d", TableName: "t"},
+			Query:    config.Query{Grouping: "service"},
+			Period:   "month_to_date",
+			Slack:    config.Slack{WebhookURL: "https://hooks.slack.com/services/XXX", MessageFormat: "text"},
+			Webhook:  config.Webhook{URL: "https://example.com/costs"},
+			Notifier: config.Notifier{Destinations: []string{"slack"}, FailurePolicy: "all"},
+		},
+		Reports: []config.Report{{Name: "finance"}, {Name: "team-a"}},
+	}
+}
+
+func TestRunAllReportsWithEmptyPayload(t *testing.T) {
+	request, err := Parse([]byte(" "))
+	assert.Nil(t, err)
+
+	reports, err := request.Select(newInputConfig())
+
+	assert.Nil(t, err)
+	assert.Len(t, reports, 2)
+	now := time.Date(2021, 8, 7, 20, 15, 0, 0, time.Local)
+	assert.EqualValues(t, now, request.ReportingDateTime(now))
+}
+
+func TestParsePayloadToControlRun(t *testing.T) {
+	request, err := Parse([]byte(`{"report": "team-a", "reporting_date": "2021-08-01", "period": "previous_month", "dry_run": true, "destinations": ["webhook"]}`))
+	assert.Nil(t, err)
+	assert.True(t, request.DryRun)
+
+	reports, err := request.Select(newInputConfig())
+
+	assert.Nil(t, err)
+	assert.Len(t, reports, 1)
+	assert.EqualValues(t, "team-a", reports[0].Name)
+	assert.EqualValues(t, "previous_month", reports[0].Period)
+	assert.EqualValues(t, []string{"webhook"}, reports[0].Notifier.Destinations)
+
+	AsiaTokyo, _ := time.LoadLocation("Asia/Tokyo")
+	assert.EqualValues(t,
+		time.Date(2021, 8, 1, 0, 0, 0, 0, AsiaTokyo),
+		request.ReportingDateTime(time.Date(2021, 8, 7, 20, 15, 0, 0, AsiaTokyo)),
+	)
+}
+
+func TestReturnErrorWhenPayloadIsMalformed(t *testing.T) {
+	for _, payload := range []string{
+		`not json`,
+		`{"report": 1}`,
+		`{"reprot": "finance"}`,
+		`{"report": "finance"} {}`,
+	} {
+		_, err := Parse([]byte(payload))
+
+		assert.NotNil(t, err, payload)
+		assert.True(t, strings.HasPrefix(err.Error(), "Error in Trigger Message. Malformed message payload!"), err)
+	}
+}
+
+func TestReportAllInvalidValuesAtOnce(t *testing.T) {
+	_, err := Parse([]byte(`{"reporting_date": "2021/08/01", "period": "weekly", "destinations": ["slack", "fax"]}`))
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Trigger Message. Invalid message payload!: "+strings.Join([]string{
+		"reporting_date must be in YYYY-MM-DD format: '2021/08/01'",
+		"period must be one of month_to_date, previous_month, last_7_days: 'weekly'",
+		"destinations has an unknown destination: 'fax'",
+	}, "; "), err.Error())
+}
+
+func TestRejectExplicitPeriodLongerThanMaxPeriodDays(t *testing.T) {
+	_, err := Parse([]byte(`{"from": "2021-05-01", "to": "2021-07-31"}`))
+	assert.Nil(t, err)
+
+	_, err = Parse([]byte(`{"from": "2021-05-01", "to": "2021-08-01"}`))
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Trigger Message. Invalid message payload!: from and to must be within 92 days: '2021-05-01'..'2021-08-01'", err.Error())
+}
+
+func TestRejectExplicitPeriodEndingAfterYesterday(t *testing.T) {
+	AsiaTokyo, _ := time.LoadLocation("Asia/Tokyo")
+	now := time.Date(2021, 8, 7, 0, 15, 0, 0, AsiaTokyo)
+
+	request, _ := Parse([]byte(`{"from": "2021-08-01", "to": "2021-08-06"}`))
+	assert.Nil(t, request.ValidatePeriod(now))
+
+	request, _ = Parse([]byte(`{"from": "2021-08-01", "to": "2021-08-07"}`))
+	err := request.ValidatePeriod(now)
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Trigger Message. Invalid reporting period!: to must not be later than yesterday (2021-08-06): '2021-08-07'", err.Error())
+
+	request, _ = Parse([]byte(`{"period": "previous_month"}`))
+	assert.Nil(t, request.ValidatePeriod(now))
+}
+
+func TestParsePublishedSlashCommand(t *testing.T) {
+	command, _ := ParseCommand("project-x last_week")
+	command.ResponseURL = "https://hooks.slack.com/commands/T/1/x"
+	data, _ := json.Marshal(command)
+
+	request, err := Parse(data)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, `{"period":"last_7_days","filters":{"projects":["project-x"],"services":null,"labels":null},"response_url":"https://hooks.slack.com/commands/T/1/x"}`, string(data))
+	assert.EqualValues(t, command, request)
+}
+
+func TestRejectInvalidResponseURL(t *testing.T) {
+	_, err := Parse([]byte(`{"response_url": "http://example.com/x", "dry_run": true}`))
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Trigger Message. Invalid message payload!: "+strings.Join([]string{
+		"response_url must be an https URL of hooks.slack.com: 'http://example.com/x'",
+		"response_url cannot be used with dry_run or destinations",
+	}, "; "), err.Error())
+
+	_, err = Parse([]byte(`{"response_url": "https://attacker.example.com/hooks.slack.com/commands/T/1/x"}`))
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Trigger Message. Invalid message payload!: response_url must be an https URL of hooks.slack.com: 'https://attacker.example.com/hooks.slack.com/commands/T/1/x'", err.Error())
+}
+
+func TestDetectExplicitDate(t *testing.T) {
+	for payload, explicit := range map[string]bool{
+		``:                                 false,
+		`{"period": "previous_month"}`:     false,
+		`{"reporting_date": "2021-08-01"}`: true,
+		`{"from": "2021-07-01", "to": "2021-07-31"}`: true,
+	} {
+		request, _ := Parse([]byte(payload))
+
+		assert.EqualValues(t, explicit, request.HasExplicitDate(), payload)
+	}
+}
+
+func TestRejectEmptyDestinations(t *testing.T) {
+	_, err := Parse([]byte(`{"destinations": []}`))
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasSuffix(err.Error(), ": destinations must not be empty"), err)
+}
+
+func TestReturnErrorWhenReportIsUnknown(t *testing.T) {
+	request, _ := Parse([]byte(`{"report": "marketing"}`))
+
+	_, err := request.Select(newInputConfig())
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Trigger Message. Unknown report!: 'marketing' is not in the reports (finance, team-a)", err.Error())
+}
+
+func TestValidateOverriddenDestinations(t *testing.T) {
+	settings := newInputConfig()
+	settings.Slack.WebhookURL = ""
+	settings.Notifier.Destinations = []string{"email"}
+	request, _ := Parse([]byte(`{"report": "finance", "destinations": ["slack"]}`))
+
+	_, err := request.Select(settings)
+
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Error in Configuration. Invalid settings of report 'finance'!: slack.webhook_url is required"), err)
+}
+
+func TestDisableBudgetsWhenGroupingOrFiltersAreOverridden(t *testing.T) {
+	settings := newInputConfig()
+	settings.Budget = config.Budget{File: "budgets.json", StateObject: "gs://bucket/state.json"}
+
+	for payload, budgetEnabled := range map[string]bool{
+		`{"period": "month_to_date"}`:               true,
+		`{"grouping": "service"}`:                   true,
+		`{"grouping": "project"}`:                   false,
+		`{"filters": {"projects": ["my-project"]}}`: false,
+	} {
+		request, _ := Parse([]byte(payload))
+
+		report, err := request.SelectOne(settings)
+
+		assert.Nil(t, err, payload)
+		assert.EqualValues(t, budgetEnabled, report.Budget.File != "", payload)
+	}
+}
+
+func TestParseSlashCommandText(t *testing.T) {
+	request, err := ParseCommand("  my-project  last_month ")
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "previous_month", request.Period)
+	assert.EqualValues(t, &config.Filters{Projects: []string{"my-project"}}, request.Filters)
+
+	request, err = ParseCommand("2021-07-26..2021-08-01")
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "2021-07-26", request.From)
+	assert.EqualValues(t, "2021-08-01", request.To)
+	assert.Nil(t, request.Filters)
+
+	request, err = ParseCommand("")
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, &Request{}, request)
+}
+
+func TestReturnErrorWhenCommandArgumentsAreInvalid(t *testing.T) {
+	_, err := ParseCommand("project-a project-b mtd 7d")
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Trigger Message. Invalid command arguments!: unexpected argument: 'project-b'; period must not be repeated", err.Error())
+
+	_, err = ParseCommand("2021-08-07..2021-08-01")
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Trigger Message. Invalid command arguments!: from must not be after to: '2021-08-07' > '2021-08-01'", err.Error())
+
+	_, err = ParseCommand("2015-01-01..2021-08-01")
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "Error in Trigger Message. Invalid command arguments!: from and to must be within 92 days: '2015-01-01'..'2021-08-01'", err.Error())
+}